@@ -0,0 +1,249 @@
+package jsonb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DefaultBackfillBatchSize is the number of rows fetched per batch when
+// Backfill.BatchSize isn't set.
+const DefaultBackfillBatchSize = 500
+
+// Backfill is a bulk pass over a jsonb column which validates every row,
+// fixes what it can (via schema migrations or coercion) and writes the fixed
+// rows back.
+//
+// Rows are read in batches ordered by Key (so Key must be unique and
+// sortable), and each batch's updates are committed in their own
+// transaction, so a long run doesn't hold locks on the whole table and an
+// interrupted run keeps the batches it finished. A row is only
+// overwritten if it still contains the document that was read, so concurrent
+// writers aren't clobbered (such rows are reported with ErrConflict).
+type Backfill struct {
+	// Table, Column and Key name the table, the jsonb column and the
+	// primary key column, respectively. Table may be schema-qualified.
+	Table  string
+	Column string
+	Key    string
+
+	// Schema, if set, is used to upgrade each document to the latest
+	// version. Otherwise Type is used to validate each document.
+	Schema *Schema
+	Type   *Type
+
+	// Coerce enables Type.Coerce for documents that don't match Type. It's
+	// ignored when Schema is set.
+	Coerce bool
+
+	// BatchSize is the number of rows fetched at a time.
+	BatchSize int
+
+	// DryRun does everything except commit the updates (each batch's
+	// transaction is rolled back instead).
+	DryRun bool
+
+	// Progress, if set, is called after each batch with the running totals.
+	Progress func(*BackfillReport)
+}
+
+// BackfillReport summarizes a Backfill run.
+type BackfillReport struct {
+	// Rows is the number of non-NULL rows read.
+	Rows int
+
+	// Updated is the number of rows that were (or, in a dry run, would
+	// have been) rewritten.
+	Updated int
+
+	// Unfixable lists the rows which couldn't be made valid.
+	Unfixable []BackfillFailure
+}
+
+// BackfillFailure records a row which Backfill couldn't fix.
+type BackfillFailure struct {
+	// Key is the row's primary key, formatted with fmt.Sprint.
+	Key string
+
+	// Err is the reason the row couldn't be fixed.
+	Err error
+}
+
+func (f BackfillFailure) String() string {
+	return fmt.Sprintf("%s: %s", f.Key, f.Err)
+}
+
+type backfillRow struct {
+	key interface{}
+	raw []byte
+}
+
+// Run performs the backfill. An error is only returned if the run itself
+// fails (e.g. a database error); rows which can't be fixed are recorded in
+// the report instead.
+func (b *Backfill) Run(ctx context.Context, db *sql.DB) (*BackfillReport, error) {
+	if b.Schema == nil && b.Type == nil {
+		return nil, ErrSchema
+	}
+
+	batchSize := b.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBackfillBatchSize
+	}
+
+	col := quoteIdent(b.Column)
+	key := quoteIdent(b.Key)
+	first := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL ORDER BY %s LIMIT %d",
+		key, col, quoteName(b.Table), col, key, batchSize)
+	next := fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s IS NOT NULL AND %s > $1 ORDER BY %s LIMIT %d",
+		key, col, quoteName(b.Table), col, key, key, batchSize)
+	update := fmt.Sprintf("UPDATE %s SET %s = $1::jsonb WHERE %s = $2 AND %s = $3::jsonb",
+		quoteName(b.Table), col, key, col)
+
+	report := &BackfillReport{}
+
+	var (
+		batch []backfillRow
+		er    error
+	)
+
+	for {
+		if batch == nil {
+			batch, er = b.fetch(ctx, db, first)
+		} else {
+			batch, er = b.fetch(ctx, db, next, batch[len(batch)-1].key)
+		}
+
+		if er != nil {
+			return report, er
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		if er := b.runBatch(ctx, db, update, batch, report); er != nil {
+			return report, er
+		}
+
+		if b.Progress != nil {
+			b.Progress(report)
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// runBatch fixes and writes back a batch of rows in its own transaction.
+func (b *Backfill) runBatch(ctx context.Context, db *sql.DB, query string, batch []backfillRow, report *BackfillReport) error {
+	tx, er := db.BeginTx(ctx, nil)
+	if er != nil {
+		return er
+	}
+	defer tx.Rollback()
+
+	update, er := tx.PrepareContext(ctx, query)
+	if er != nil {
+		return er
+	}
+	defer update.Close()
+
+	for _, row := range batch {
+		report.Rows++
+
+		fixed, er := b.fix(row.raw)
+		if er != nil {
+			report.Unfixable = append(report.Unfixable, BackfillFailure{
+				Key: fmt.Sprint(row.key),
+				Err: er,
+			})
+			continue
+		}
+
+		if fixed == nil {
+			continue
+		}
+
+		res, er := update.ExecContext(ctx, fixed, row.key, row.raw)
+		if er != nil {
+			return er
+		}
+
+		if n, er := res.RowsAffected(); er != nil {
+			return er
+		} else if n == 0 {
+			report.Unfixable = append(report.Unfixable, BackfillFailure{
+				Key: fmt.Sprint(row.key),
+				Err: ErrConflict,
+			})
+			continue
+		}
+
+		report.Updated++
+	}
+
+	if b.DryRun {
+		return nil
+	}
+
+	return tx.Commit()
+}
+
+func (b *Backfill) fetch(ctx context.Context, db *sql.DB, query string, args ...interface{}) (batch []backfillRow, er error) {
+	rows, er := db.QueryContext(ctx, query, args...)
+	if er != nil {
+		return nil, er
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row backfillRow
+		if er := rows.Scan(&row.key, &row.raw); er != nil {
+			return nil, er
+		}
+
+		if bs, ok := row.key.([]byte); ok {
+			row.key = string(bs)
+		}
+
+		batch = append(batch, row)
+	}
+
+	return batch, rows.Err()
+}
+
+// fix returns the fixed document, or nil if the document is fine as-is.
+func (b *Backfill) fix(raw []byte) ([]byte, error) {
+	var (
+		t  Table
+		mt *MutableTable
+		er error
+	)
+
+	if er = t.Scan(raw); er != nil {
+		return nil, er
+	}
+
+	switch {
+	case b.Schema != nil:
+		mt, er = t.AsSchema(b.Schema)
+	case b.Coerce:
+		mt, _, er = t.AsCoerce(b.Type)
+	default:
+		mt, er = t.As(b.Type)
+	}
+
+	if er != nil {
+		return nil, er
+	}
+
+	if !mt.Dirty() {
+		return nil, nil
+	}
+
+	return mt.MarshalJSON()
+}
@@ -0,0 +1,114 @@
+package jsonb
+
+import (
+	"context"
+	"testing"
+)
+
+func TestBackfillFix(t *testing.T) {
+	b := &Backfill{
+		Type: NewTableType(TableDef{
+			"n": TypeNumber,
+		}),
+	}
+
+	if fixed, er := b.fix([]byte(`{"n":1}`)); er != nil || fixed != nil {
+		t.Errorf("valid row shouldn't change: %s (%v)", fixed, er)
+	}
+	if _, er := b.fix([]byte(`{"n":"1"}`)); er != ErrSchema {
+		t.Errorf("expected ErrSchema, got %v", er)
+	}
+
+	b.Coerce = true
+	if fixed, er := b.fix([]byte(`{"n":"1"}`)); er != nil {
+		t.Error(er)
+	} else if string(fixed) != `{"n":1}` {
+		t.Errorf("wrong fix %s", fixed)
+	}
+	if _, er := b.fix([]byte(`[1]`)); er != ErrInvalidJsonType {
+		t.Errorf("expected ErrInvalidJsonType, got %v", er)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+
+	// NB: Temporary tables are per-connection.
+	db.SetMaxOpenConns(1)
+
+	setup := []string{
+		`CREATE TEMPORARY TABLE backfill_test (id integer PRIMARY KEY, doc jsonb)`,
+		`INSERT INTO backfill_test VALUES
+			(1, '{"n":1}'),
+			(2, '{"n":"2"}'),
+			(3, '{"n":"three"}'),
+			(4, NULL),
+			(5, '{"n":"5"}')`,
+	}
+	for _, q := range setup {
+		if _, er := db.Exec(q); er != nil {
+			t.Fatal(er)
+		}
+	}
+	b := &Backfill{
+		Table:     "backfill_test",
+		Column:    "doc",
+		Key:       "id",
+		Type:      NewTableType(TableDef{"n": TypeNumber}),
+		Coerce:    true,
+		BatchSize: 2,
+		DryRun:    true,
+	}
+
+	batches := 0
+	b.Progress = func(*BackfillReport) {
+		batches++
+	}
+
+	report, er := b.Run(context.Background(), db)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if report.Rows != 4 || report.Updated != 2 || len(report.Unfixable) != 1 {
+		t.Errorf("wrong report %#v", report)
+	} else if report.Unfixable[0].Key != "3" {
+		t.Errorf("wrong unfixable row %s", report.Unfixable[0])
+	}
+	if batches != 2 {
+		t.Errorf("wrong number of batches %d", batches)
+	}
+
+	var n int
+	if er := db.QueryRow(`SELECT count(*) FROM backfill_test WHERE doc->>'n' = '2' AND jsonb_typeof(doc->'n') = 'number'`).Scan(&n); er != nil {
+		t.Fatal(er)
+	} else if n != 0 {
+		t.Error("dry run modified rows")
+	}
+
+	// Each batch is committed as it goes, so the first batch's fix is
+	// visible before the run finishes.
+	b.DryRun = false
+	b.Progress = func(r *BackfillReport) {
+		if r.Rows != 2 {
+			return
+		}
+
+		var n int
+		if er := db.QueryRow(`SELECT count(*) FROM backfill_test WHERE jsonb_typeof(doc->'n') = 'number'`).Scan(&n); er != nil {
+			t.Error(er)
+		} else if n != 2 {
+			t.Errorf("first batch wasn't committed (%d fixed rows)", n)
+		}
+	}
+
+	if _, er := b.Run(context.Background(), db); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := db.QueryRow(`SELECT count(*) FROM backfill_test WHERE jsonb_typeof(doc->'n') = 'number'`).Scan(&n); er != nil {
+		t.Fatal(er)
+	} else if n != 3 {
+		t.Errorf("wrong number of fixed rows %d", n)
+	}
+}
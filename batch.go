@@ -0,0 +1,187 @@
+package jsonb
+
+// TableBatch stages several changes to a MutableTable so they're applied
+// all at once, or not at all. Changes aren't checked until Commit, so the
+// document may be invalid part way through a batch (e.g. while a field is
+// renamed).
+type TableBatch struct {
+	mt   *MutableTable
+	sets []tableBatchOp
+}
+
+type tableBatchOp struct {
+	key string
+	val interface{}
+	del bool
+}
+
+// Batch starts a new batch of changes to the MutableTable.
+func (mt *MutableTable) Batch() *TableBatch {
+	return &TableBatch{mt: mt}
+}
+
+// Update runs fn with a new batch, committing it if fn returns nil. If fn
+// fails, the batch is discarded and fn's error is returned.
+func (mt *MutableTable) Update(fn func(b *TableBatch) error) error {
+	b := mt.Batch()
+	if er := fn(b); er != nil {
+		b.Rollback()
+		return er
+	}
+
+	return b.Commit()
+}
+
+// Set stages setting key to val.
+func (b *TableBatch) Set(key string, val interface{}) *TableBatch {
+	b.sets = append(b.sets, tableBatchOp{key: key, val: val})
+	return b
+}
+
+// Delete stages removing key.
+func (b *TableBatch) Delete(key string) *TableBatch {
+	b.sets = append(b.sets, tableBatchOp{key: key, del: true})
+	return b
+}
+
+// Commit applies the staged changes to the MutableTable. If the resulting
+// document isn't valid for the Table's Type, ErrSchema is returned and the
+// Table is left unchanged (as it is if a BeforeChange hook fails). Either
+// way, the batch is emptied.
+func (b *TableBatch) Commit() error {
+	ops := b.sets
+	b.sets = nil
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	dec, er := b.mt.decode()
+	if er != nil {
+		return er
+	}
+
+	out := deepCopy(dec).(map[string]interface{})
+	for _, op := range ops {
+		if op.del {
+			delete(out, op.key)
+		} else {
+			out[op.key] = op.val
+		}
+	}
+
+	if !b.mt.ty.validTypes(out) {
+		return ErrSchema
+	}
+
+	return b.mt.update(dec, out, diffEvents(dec, out))
+}
+
+// Rollback discards the staged changes.
+func (b *TableBatch) Rollback() {
+	b.sets = nil
+}
+
+// ListBatch stages several changes to a MutableList (see TableBatch).
+// Indices refer to the list as it will be when the change is applied, after
+// the changes staged before it.
+type ListBatch struct {
+	ml  *MutableList
+	ops []listBatchOp
+}
+
+type listBatchOp struct {
+	op  int
+	idx int
+	val interface{}
+}
+
+const (
+	listBatchAppend = iota
+	listBatchSet
+	listBatchRemove
+)
+
+// Batch starts a new batch of changes to the MutableList.
+func (ml *MutableList) Batch() *ListBatch {
+	return &ListBatch{ml: ml}
+}
+
+// Update runs fn with a new batch, committing it if fn returns nil (see
+// MutableTable.Update).
+func (ml *MutableList) Update(fn func(b *ListBatch) error) error {
+	b := ml.Batch()
+	if er := fn(b); er != nil {
+		b.Rollback()
+		return er
+	}
+
+	return b.Commit()
+}
+
+// Append stages appending val.
+func (b *ListBatch) Append(val interface{}) *ListBatch {
+	b.ops = append(b.ops, listBatchOp{op: listBatchAppend, val: val})
+	return b
+}
+
+// Set stages replacing the value at index i with val.
+func (b *ListBatch) Set(i int, val interface{}) *ListBatch {
+	b.ops = append(b.ops, listBatchOp{op: listBatchSet, idx: i, val: val})
+	return b
+}
+
+// Remove stages removing the value at index i.
+func (b *ListBatch) Remove(i int) *ListBatch {
+	b.ops = append(b.ops, listBatchOp{op: listBatchRemove, idx: i})
+	return b
+}
+
+// Commit applies the staged changes to the MutableList. ErrIndexRange is
+// returned if an index is out of range when its change is applied, and
+// ErrSchema if the resulting list isn't valid for the List's Type; either
+// way the List is left unchanged. The batch is emptied.
+func (b *ListBatch) Commit() error {
+	ops := b.ops
+	b.ops = nil
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	dec, er := b.ml.decode()
+	if er != nil {
+		return er
+	}
+
+	out := deepCopy(dec).([]interface{})
+	for _, op := range ops {
+		switch op.op {
+		case listBatchAppend:
+			out = append(out, op.val)
+
+		case listBatchSet:
+			if op.idx < 0 || op.idx >= len(out) {
+				return ErrIndexRange
+			}
+			out[op.idx] = op.val
+
+		case listBatchRemove:
+			if op.idx < 0 || op.idx >= len(out) {
+				return ErrIndexRange
+			}
+			out = listRemove(out, op.idx)
+		}
+	}
+
+	if !b.ml.ty.validTypes(out) {
+		return ErrSchema
+	}
+
+	return b.ml.update(dec, out, diffEvents(dec, out), nil, nil)
+}
+
+// Rollback discards the staged changes.
+func (b *ListBatch) Rollback() {
+	b.ops = nil
+}
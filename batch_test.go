@@ -0,0 +1,108 @@
+package jsonb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTableBatch(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada", "age": 36}`)
+
+	// Renaming a field: the document is invalid between the two Sets.
+	b := mt.Batch().Set("nick", "ada").Set("name", 1).Set("name", "ada lovelace").Delete("age")
+	if er := b.Commit(); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{"name": "ada lovelace", "nick": "ada"}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if full, _, _ := mt.changes(); !full {
+		t.Errorf("removing a top-level key should rewrite the document")
+	}
+}
+
+func TestTableBatchInvalid(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada", "age": 36}`)
+
+	er := mt.Batch().Set("name", "eve").Set("age", 37).Set("age", "old").Commit()
+	if er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	expected := map[string]interface{}{"name": "ada", "age": float64(36)}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) || mt.Dirty() {
+		t.Errorf("table changed: %#v", dec)
+	}
+}
+
+func TestTableUpdate(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada"}`)
+
+	oops := errors.New("oops")
+	er := mt.Update(func(b *TableBatch) error {
+		b.Set("name", "eve")
+		return oops
+	})
+	if er != oops {
+		t.Errorf("got %v", er)
+	}
+
+	er = mt.Update(func(b *TableBatch) error {
+		b.Set("age", 1)
+		return nil
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if dec, _ := mt.decode(); dec["name"] != "ada" || dec["age"] != 1 {
+		t.Errorf("got %#v", dec)
+	}
+
+	if full, patch, _ := mt.changes(); full || len(patch) != 1 {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+}
+
+func TestListBatch(t *testing.T) {
+	ml := NewList(NewListType(TypeNumber, 3))
+	ml.Append(1)
+	ml.Append(2)
+	ml.Append(3)
+	ml.MarkClean()
+
+	// Over MaxLen until the Remove.
+	if er := ml.Batch().Append(4).Set(0, 0).Remove(1).Commit(); er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(ml.Values(), []interface{}{0, 3, 4}) || !ml.Dirty() {
+		t.Errorf("got %#v", ml.Values())
+	}
+
+	ml.MarkClean()
+
+	tests := []struct {
+		b  *ListBatch
+		er error
+	}{
+		{ml.Batch().Append(5), ErrSchema},
+		{ml.Batch().Set(0, "zero"), ErrSchema},
+		{ml.Batch().Set(1, 1).Remove(3), ErrIndexRange},
+		{ml.Batch().Remove(-1), ErrIndexRange},
+	}
+
+	for i, test := range tests {
+		if er := test.b.Commit(); er != test.er {
+			t.Errorf("%d: got %v, expected %v", i, er, test.er)
+		}
+
+		if !reflect.DeepEqual(ml.Values(), []interface{}{0, 3, 4}) || ml.Dirty() {
+			t.Errorf("%d: list changed: %#v", i, ml.Values())
+		}
+	}
+}
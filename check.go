@@ -0,0 +1,243 @@
+package jsonb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CheckExpr returns an SQL boolean expression that is true when the jsonb
+// column satisfies ty, for use in a CHECK constraint. Tables nested within
+// tables are checked with plain jsonb operators (jsonb_typeof, ?, ->, etc.);
+// list elements are checked with a strict-mode jsonpath via
+// jsonb_path_exists, as subqueries aren't allowed in CHECK constraints.
+// jsonpath requires PostgreSQL 12.
+//
+// References are followed, but recursive Types can't be written out, so
+// ErrRecursiveType is returned for them (and ErrUnresolvedRef for
+// references that don't resolve).
+//
+// NOTE: Go measures string lengths in bytes, and so does the generated SQL,
+// except for strings inside lists: jsonpath can only count characters. For
+// ASCII strings there's no difference.
+//
+// NB: SQL NULLs always pass (as with any other CHECK constraint); use NOT
+// NULL on the column to forbid them.
+func (ty *Type) CheckExpr(column string) (string, error) {
+	expr, er := ty.checkExpr(quoteIdent(column), make(map[*Type]bool))
+	if er != nil {
+		return "", er
+	}
+
+	return checkNull(quoteIdent(column), expr), nil
+}
+
+// CheckConstraint returns an ALTER TABLE statement adding a CHECK
+// constraint (named name) that enforces ty on the given column.
+func (ty *Type) CheckConstraint(table, column, name string) (string, error) {
+	expr, er := ty.CheckExpr(column)
+	if er != nil {
+		return "", er
+	}
+
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)",
+		quoteName(table), quoteIdent(name), expr), nil
+}
+
+// CheckFunction returns a CREATE FUNCTION statement for a plpgsql function
+// (named name) which takes a jsonb argument and returns whether it
+// satisfies ty. This is useful when the same Type applies to several
+// columns, i.e. "CHECK (name(column))".
+func (ty *Type) CheckFunction(name string) (string, error) {
+	expr, er := ty.checkExpr("doc", make(map[*Type]bool))
+	if er != nil {
+		return "", er
+	}
+	body := checkNull("doc", expr)
+
+	tag := "$jsonb$"
+	for i := 0; strings.Contains(body, tag); i++ {
+		tag = "$jsonb" + strconv.Itoa(i) + "$"
+	}
+
+	return fmt.Sprintf("CREATE OR REPLACE FUNCTION %s(doc jsonb) RETURNS boolean\nLANGUAGE plpgsql IMMUTABLE AS %s\nBEGIN\n\tRETURN %s;\nEND\n%s",
+		quoteName(name), tag, body, tag), nil
+}
+
+// checkDeref follows references for checkExpr and checkPath, which are
+// expanding the Types in stack.
+func (ty *Type) checkDeref(stack map[*Type]bool) (*Type, error) {
+	ty = ty.deref()
+
+	switch {
+	case ty.Kind == KindRef:
+		return nil, ErrUnresolvedRef
+	case stack[ty]:
+		return nil, ErrRecursiveType
+	}
+
+	return ty, nil
+}
+
+// checkExpr returns the check for the jsonb expression expr, or "" if
+// anything goes. stack holds the Types being expanded, to catch recursion.
+func (ty *Type) checkExpr(expr string, stack map[*Type]bool) (string, error) {
+	ty, er := ty.checkDeref(stack)
+	if er != nil {
+		return "", er
+	}
+
+	stack[ty] = true
+	defer delete(stack, ty)
+
+	switch ty.Kind {
+	case KindNumber:
+		return fmt.Sprintf("jsonb_typeof(%s) = 'number'", expr), nil
+
+	case KindBool:
+		return fmt.Sprintf("jsonb_typeof(%s) = 'boolean'", expr), nil
+
+	case KindString:
+		check := fmt.Sprintf("jsonb_typeof(%s) = 'string'", expr)
+		if ty.MaxLen > 0 {
+			check = fmt.Sprintf("(%s AND octet_length(%s #>> '{}') <= %d)", check, expr, ty.MaxLen)
+		}
+		return check, nil
+
+	case KindList:
+		// NB: jsonb_array_length raises an error for non-arrays, so CASE
+		// is used to guarantee the order of evaluation.
+		var conds []string
+		if ty.MaxLen > 0 {
+			conds = append(conds, fmt.Sprintf("jsonb_array_length(%s) <= %d", expr, ty.MaxLen))
+		}
+
+		pred, er := ty.ListType.checkPath(stack)
+		if er != nil {
+			return "", er
+		}
+		if pred != "" {
+			path := fmt.Sprintf("strict $[*] ? (!(%s))", pred)
+			conds = append(conds, fmt.Sprintf("NOT jsonb_path_exists(%s, %s)", expr, quoteLiteral(path)))
+		}
+		return checkCase(expr, "array", conds), nil
+
+	case KindTable:
+		keys := sortedKeys(ty.Fields)
+		var conds []string
+
+		if len(keys) == 0 {
+			conds = append(conds, fmt.Sprintf("%s = '{}'::jsonb", expr))
+		} else {
+			lits := make([]string, len(keys))
+			for i, k := range keys {
+				lits[i] = quoteLiteral(k)
+			}
+			conds = append(conds, fmt.Sprintf("(%s - ARRAY[%s]::text[]) = '{}'::jsonb", expr, strings.Join(lits, ", ")))
+		}
+
+		for _, k := range keys {
+			lit := quoteLiteral(k)
+			check, er := ty.Fields[k].checkExpr(fmt.Sprintf("(%s -> %s)", expr, lit), stack)
+			if er != nil {
+				return "", er
+			}
+			if check != "" {
+				conds = append(conds, fmt.Sprintf("(NOT (%s ? %s) OR %s)", expr, lit, check))
+			}
+		}
+		return checkCase(expr, "object", conds), nil
+	}
+
+	return "", nil
+}
+
+// checkNull returns the top-level check for a column (or argument) expr,
+// which lets SQL NULL through; check is as returned by checkExpr.
+func checkNull(expr, check string) string {
+	if check == "" {
+		return "true"
+	}
+
+	return fmt.Sprintf("%s IS NULL OR (%s)", expr, check)
+}
+
+func checkCase(expr, typ string, conds []string) string {
+	if len(conds) == 0 {
+		return fmt.Sprintf("jsonb_typeof(%s) = '%s'", expr, typ)
+	}
+
+	return fmt.Sprintf("CASE WHEN jsonb_typeof(%s) = '%s' THEN %s ELSE false END",
+		expr, typ, strings.Join(conds, " AND "))
+}
+
+// checkPath returns a strict-mode jsonpath predicate on @ that is true when
+// @ satisfies ty, or "" if anything goes (see checkExpr).
+func (ty *Type) checkPath(stack map[*Type]bool) (string, error) {
+	ty, er := ty.checkDeref(stack)
+	if er != nil {
+		return "", er
+	}
+
+	stack[ty] = true
+	defer delete(stack, ty)
+
+	switch ty.Kind {
+	case KindNumber:
+		return `@.type() == "number"`, nil
+
+	case KindBool:
+		return `@.type() == "boolean"`, nil
+
+	case KindString:
+		pred := `@.type() == "string"`
+		if ty.MaxLen > 0 {
+			pred += fmt.Sprintf(` && @ like_regex "^.{0,%d}$" flag "s"`, ty.MaxLen)
+		}
+		return pred, nil
+
+	case KindList:
+		pred := `@.type() == "array"`
+		if ty.MaxLen > 0 {
+			pred += fmt.Sprintf(` && @.size() <= %d`, ty.MaxLen)
+		}
+
+		sub, er := ty.ListType.checkPath(stack)
+		if er != nil {
+			return "", er
+		}
+		if sub != "" {
+			pred += fmt.Sprintf(` && !exists(@[*] ? (!(%s)))`, sub)
+		}
+		return pred, nil
+
+	case KindTable:
+		keys := sortedKeys(ty.Fields)
+		pred := `@.type() == "object"`
+
+		// Fields are found via keyvalue() rather than accessors, since in
+		// strict mode accessing a missing key is an error.
+		if len(keys) == 0 {
+			pred += ` && !exists(@.keyvalue())`
+		} else {
+			conds := make([]string, len(keys))
+			for i, k := range keys {
+				conds[i] = "@.key != " + quotePathString(k)
+			}
+			pred += fmt.Sprintf(` && !exists(@.keyvalue() ? (%s))`, strings.Join(conds, " && "))
+		}
+
+		for _, k := range keys {
+			sub, er := ty.Fields[k].checkPath(stack)
+			if er != nil {
+				return "", er
+			}
+			if sub != "" {
+				pred += fmt.Sprintf(` && !exists(@.keyvalue() ? (@.key == %s).value ? (!(%s)))`, quotePathString(k), sub)
+			}
+		}
+		return pred, nil
+	}
+
+	return "", nil
+}
@@ -0,0 +1,169 @@
+package jsonb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckExprPrimitives(t *testing.T) {
+	cases := []struct {
+		ty  *Type
+		sql string
+	}{
+		{TypeAny, `true`},
+		{TypeNumber, `"doc" IS NULL OR (jsonb_typeof("doc") = 'number')`},
+		{TypeBool, `"doc" IS NULL OR (jsonb_typeof("doc") = 'boolean')`},
+		{NewStringType(5), `"doc" IS NULL OR ((jsonb_typeof("doc") = 'string' AND octet_length("doc" #>> '{}') <= 5))`},
+		{TypeAnyList, `"doc" IS NULL OR (jsonb_typeof("doc") = 'array')`},
+		{NewListType(TypeNumber, 3), `"doc" IS NULL OR (CASE WHEN jsonb_typeof("doc") = 'array' THEN jsonb_array_length("doc") <= 3 AND NOT jsonb_path_exists("doc", 'strict $[*] ? (!(@.type() == "number"))') ELSE false END)`},
+		{NewTableType(TableDef{}), `"doc" IS NULL OR (CASE WHEN jsonb_typeof("doc") = 'object' THEN "doc" = '{}'::jsonb ELSE false END)`},
+	}
+
+	for _, c := range cases {
+		if sql, er := c.ty.CheckExpr("doc"); er != nil || sql != c.sql {
+			t.Errorf("got\n%s (%v)\nexpected\n%s", sql, er, c.sql)
+		}
+	}
+}
+
+func TestCheckExprTable(t *testing.T) {
+	ty := NewTableType(TableDef{
+		"it's": TypeNumber,
+		"any":  TypeAny,
+	})
+
+	expected := `"doc" IS NULL OR (CASE WHEN jsonb_typeof("doc") = 'object' THEN ("doc" - ARRAY['any', 'it''s']::text[]) = '{}'::jsonb AND (NOT ("doc" ? 'it''s') OR jsonb_typeof(("doc" -> 'it''s')) = 'number') ELSE false END)`
+	if sql, er := ty.CheckExpr("doc"); er != nil || sql != expected {
+		t.Errorf("got\n%s (%v)\nexpected\n%s", sql, er, expected)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	ty := NewTableType(TableDef{
+		`a"b`: NewStringType(2),
+		"c":   NewListType(TypeBool, 1),
+	})
+
+	expected := `@.type() == "object" && !exists(@.keyvalue() ? (@.key != "a\"b" && @.key != "c")) && ` +
+		`!exists(@.keyvalue() ? (@.key == "a\"b").value ? (!(@.type() == "string" && @ like_regex "^.{0,2}$" flag "s"))) && ` +
+		`!exists(@.keyvalue() ? (@.key == "c").value ? (!(@.type() == "array" && @.size() <= 1 && !exists(@[*] ? (!(@.type() == "boolean"))))))`
+	if path, er := ty.checkPath(make(map[*Type]bool)); er != nil || path != expected {
+		t.Errorf("got\n%s (%v)\nexpected\n%s", path, er, expected)
+	}
+}
+
+func TestCheckExprRefs(t *testing.T) {
+	r := NewRegistry()
+	r.Register("User", NewTableType(TableDef{"name": TypeString}))
+	r.Register("Post", NewTableType(TableDef{
+		"author": r.Ref("User"),
+		"tags":   NewListType(r.Ref("Tag"), -1),
+	}))
+	r.Register("Tag", NewStringType(8))
+
+	expected := `"doc" IS NULL OR (CASE WHEN jsonb_typeof("doc") = 'object' THEN ("doc" - ARRAY['author', 'tags']::text[]) = '{}'::jsonb AND ` +
+		`(NOT ("doc" ? 'author') OR CASE WHEN jsonb_typeof(("doc" -> 'author')) = 'object' THEN (("doc" -> 'author') - ARRAY['name']::text[]) = '{}'::jsonb AND ` +
+		`(NOT (("doc" -> 'author') ? 'name') OR jsonb_typeof((("doc" -> 'author') -> 'name')) = 'string') ELSE false END) AND ` +
+		`(NOT ("doc" ? 'tags') OR CASE WHEN jsonb_typeof(("doc" -> 'tags')) = 'array' THEN NOT jsonb_path_exists(("doc" -> 'tags'), 'strict $[*] ? (!(@.type() == "string" && @ like_regex "^.{0,8}$" flag "s"))') ELSE false END) ELSE false END)`
+	if sql, er := r.Ref("Post").CheckExpr("doc"); er != nil || sql != expected {
+		t.Errorf("got\n%s (%v)\nexpected\n%s", sql, er, expected)
+	}
+
+	// The same Type can be used more than once, as long as it isn't
+	// recursive.
+	r.Register("Pair", NewTableType(TableDef{"a": r.Ref("User"), "b": r.Ref("User")}))
+	if _, er := r.Ref("Pair").CheckExpr("doc"); er != nil {
+		t.Error(er)
+	}
+
+	comments := testRegistry(t)
+	if _, er := comments.Ref("Comment").CheckExpr("doc"); er != ErrRecursiveType {
+		t.Errorf("got %v, expected ErrRecursiveType", er)
+	}
+	if _, er := comments.Ref("Comment").CheckFunction("f"); er != ErrRecursiveType {
+		t.Errorf("got %v, expected ErrRecursiveType", er)
+	}
+
+	if _, er := NewRegistry().Ref("Nope").CheckExpr("doc"); er != ErrUnresolvedRef {
+		t.Errorf("got %v, expected ErrUnresolvedRef", er)
+	}
+}
+
+func TestCheckFunction(t *testing.T) {
+	sql, er := TypeNumber.CheckFunction("public.is_num")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !strings.HasPrefix(sql, `CREATE OR REPLACE FUNCTION "public"."is_num"(doc jsonb)`) {
+		t.Errorf("bad function %s", sql)
+	}
+	if !strings.Contains(sql, `RETURN doc IS NULL OR (jsonb_typeof(doc) = 'number');`) {
+		t.Errorf("bad function %s", sql)
+	}
+}
+
+func TestCheckConstraint(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	ty := NewTableType(TableDef{
+		"name": NewStringType(5),
+		"tags": NewListType(NewStringType(3), 2),
+		"items": NewListType(NewTableType(TableDef{
+			"n": TypeNumber,
+		}), -1),
+		"nested": NewTableType(TableDef{
+			"b": TypeBool,
+		}),
+	})
+
+	constraint, er := ty.CheckConstraint("check_test", "doc", "check_test_doc")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	setup := []string{
+		`CREATE TEMPORARY TABLE check_test (doc jsonb)`,
+		constraint,
+	}
+	for _, q := range setup {
+		if _, er := db.Exec(q); er != nil {
+			t.Fatalf("%s\n%s", er, q)
+		}
+	}
+
+	docs := map[string]bool{
+		`{}`:                          true,
+		`{"name":"ada"}`:              true,
+		`{"name":"adalovelace"}`:      false,
+		`{"name":1}`:                  false,
+		`{"other":1}`:                 false,
+		`[]`:                          false,
+		`{"tags":["a","b"]}`:          true,
+		`{"tags":["a","b","c"]}`:      false,
+		`{"tags":["abcd"]}`:           false,
+		`{"tags":"a"}`:                false,
+		`{"items":[{"n":1},{}]}`:      true,
+		`{"items":[{"n":"1"}]}`:       false,
+		`{"items":[{"m":1}]}`:         false,
+		`{"items":[[{"n":1}]]}`:       false,
+		`{"nested":{"b":true}}`:       true,
+		`{"nested":{"b":null}}`:       false,
+		`{"nested":{"b":true,"c":1}}`: false,
+	}
+
+	for doc, valid := range docs {
+		_, er := db.Exec(`INSERT INTO check_test VALUES ($1::jsonb)`, doc)
+		if valid && er != nil {
+			t.Errorf("%s should be valid: %s", doc, er)
+		} else if !valid && er == nil {
+			t.Errorf("%s should be invalid", doc)
+		}
+	}
+
+	if _, er := db.Exec(`INSERT INTO check_test VALUES (NULL)`); er != nil {
+		t.Errorf("NULL should be valid: %s", er)
+	}
+}
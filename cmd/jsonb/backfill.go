@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+	"github.com/lye/jsonb"
+)
+
+// NOTE: Migrations are Go functions, so they can't be expressed in a schema
+// file. Programs that need them should build a jsonb.Schema and call
+// jsonb.Backfill directly; this command covers validation and coercion.
+
+func runBackfill(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	var (
+		dsn      = fs.String("db", "", "PostgreSQL connection string (defaults to the PG* environment variables)")
+		table    = fs.String("table", "", "table to backfill")
+		column   = fs.String("column", "", "jsonb column to backfill")
+		key      = fs.String("key", "id", "primary key column")
+		coerce   = fs.Bool("coerce", false, "coerce values that don't match the schema")
+		batch    = fs.Int("batch", jsonb.DefaultBackfillBatchSize, "rows per batch")
+		dryRun   = fs.Bool("dry-run", false, "don't commit any changes")
+		progress = fs.Bool("v", false, "print progress after each batch")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonb backfill [flags] schema.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *table == "" || *column == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ty, er := loadType(fs.Arg(0))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	db, er := sql.Open("postgres", *dsn)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+	defer db.Close()
+
+	b := &jsonb.Backfill{
+		Table:     *table,
+		Column:    *column,
+		Key:       *key,
+		Type:      ty,
+		Coerce:    *coerce,
+		BatchSize: *batch,
+		DryRun:    *dryRun,
+	}
+	if *progress {
+		b.Progress = func(r *jsonb.BackfillReport) {
+			fmt.Fprintf(os.Stderr, "%d rows, %d updated, %d unfixable\n", r.Rows, r.Updated, len(r.Unfixable))
+		}
+	}
+
+	report, er := b.Run(context.Background(), db)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	for _, f := range report.Unfixable {
+		fmt.Println(f)
+	}
+
+	verb := "updated"
+	if *dryRun {
+		verb = "would update"
+	}
+	fmt.Fprintf(os.Stderr, "%d rows, %s %d, %d unfixable\n", report.Rows, verb, report.Updated, len(report.Unfixable))
+
+	if len(report.Unfixable) > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var (
+		table    = fs.String("table", "", "table to add the constraint to")
+		column   = fs.String("column", "", "jsonb column to constrain")
+		name     = fs.String("name", "", "constraint name (defaults to <table>_<column>_check)")
+		function = fs.String("function", "", "emit a validation function with this name instead of a constraint")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonb check [flags] schema.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || (*function == "" && (*table == "" || *column == "")) {
+		fs.Usage()
+		return 2
+	}
+
+	ty, er := loadType(fs.Arg(0))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	var sql string
+	if *function != "" {
+		sql, er = ty.CheckFunction(*function)
+	} else {
+		if *name == "" {
+			*name = *table + "_" + *column + "_check"
+		}
+		sql, er = ty.CheckConstraint(*table, *column, *name)
+	}
+
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	fmt.Printf("%s;\n", sql)
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lye/jsonb"
+)
+
+var requireModes = map[string]func(jsonb.Compatibility) bool{
+	"none": func(c jsonb.Compatibility) bool {
+		return c != jsonb.CompatBreaking
+	},
+	"backward": func(c jsonb.Compatibility) bool {
+		return c == jsonb.CompatBackward
+	},
+	"forward": func(c jsonb.Compatibility) bool {
+		return c == jsonb.CompatForward
+	},
+	"full": func(c jsonb.Compatibility) bool {
+		return false
+	},
+}
+
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	require := fs.String("require", "none", "compatibility required of every change: none (only fail on breaking changes), backward, forward or full (no changes at all)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonb diff [flags] old.json new.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	allowed, ok := requireModes[*require]
+	if fs.NArg() != 2 || !ok {
+		fs.Usage()
+		return 2
+	}
+
+	old, er := loadType(fs.Arg(0))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	new, er := loadType(fs.Arg(1))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	status := 0
+	for _, c := range jsonb.DiffTypes(old, new) {
+		fmt.Println(c)
+		if !allowed(c.Compat) {
+			status = 1
+		}
+	}
+
+	return status
+}
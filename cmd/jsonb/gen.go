@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/lye/jsonb"
+	"github.com/lye/jsonb/gen"
+)
+
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	var (
+		pkg      = fs.String("package", os.Getenv("GOPACKAGE"), "package name of the generated file (defaults to $GOPACKAGE, as set by go generate)")
+		out      = fs.String("o", "", "file to write (defaults to stdout)")
+		registry = fs.String("registry", "", "Go expression for a *jsonb.Registry holding the types at runtime (defaults to embedding the schema)")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonb gen [flags] schema.jsonb\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *pkg == "" {
+		fs.Usage()
+		return 2
+	}
+
+	r, er := jsonb.LoadSchemaFile(fs.Arg(0))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	src, er := gen.Generate(r, gen.Config{Package: *pkg, Registry: *registry})
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return 0
+	}
+
+	if er := ioutil.WriteFile(*out, src, 0644); er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	return 0
+}
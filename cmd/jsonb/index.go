@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runIndex(args []string) int {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	var (
+		table  = fs.String("table", "", "table holding the jsonb column")
+		column = fs.String("column", "", "jsonb column to index")
+	)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: jsonb index [flags] schema.json\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *table == "" || *column == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ty, er := loadType(fs.Arg(0))
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	stmts, er := ty.IndexDDL(*table, *column)
+	if er != nil {
+		fmt.Fprintf(os.Stderr, "jsonb: %s\n", er)
+		return 1
+	}
+
+	for _, stmt := range stmts {
+		fmt.Printf("%s;\n", stmt)
+	}
+
+	return 0
+}
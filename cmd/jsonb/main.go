@@ -0,0 +1,55 @@
+// Command jsonb is a collection of tools for managing jsonb columns described
+// by jsonb Types.
+//
+// Usage:
+//
+//	jsonb <command> [flags] [args]
+//
+// Schemas are read from files containing a JSON-encoded jsonb.Type, or from
+// schema files (.jsonb, see jsonb.ParseRegistry); use file.jsonb#Name to pick
+// a type from a file which declares several. Run a command with -h for its
+// flags.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"backfill", "validate and fix every row of a jsonb column", runBackfill},
+	{"check", "generate a CHECK constraint enforcing a schema", runCheck},
+	{"diff", "compare two schemas and fail on incompatible changes", runDiff},
+	{"gen", "generate typed Go wrappers from a schema file", runGen},
+	{"index", "generate CREATE INDEX statements from schema annotations", runIndex},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: jsonb <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			os.Exit(c.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "jsonb: unknown command %q\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
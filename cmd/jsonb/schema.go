@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lye/jsonb"
+)
+
+// loadType reads a jsonb.Type from path, which is either a JSON-encoded
+// Type or a schema file (.jsonb). For schema files with more than one
+// declaration, the type is picked with a #Name suffix.
+func loadType(path string) (*jsonb.Type, error) {
+	name := ""
+	if i := strings.LastIndexByte(path, '#'); i >= 0 && strings.HasSuffix(path[:i], ".jsonb") {
+		path, name = path[:i], path[i+1:]
+	}
+
+	if strings.HasSuffix(path, ".jsonb") {
+		return loadSchemaType(path, name)
+	}
+
+	f, er := os.Open(path)
+	if er != nil {
+		return nil, er
+	}
+	defer f.Close()
+
+	ty := &jsonb.Type{}
+	if er := json.NewDecoder(f).Decode(ty); er != nil {
+		return nil, er
+	}
+
+	return ty, nil
+}
+
+func loadSchemaType(path, name string) (*jsonb.Type, error) {
+	r, er := jsonb.LoadSchemaFile(path)
+	if er != nil {
+		return nil, er
+	}
+
+	if name == "" {
+		names := r.Names()
+		if len(names) != 1 {
+			return nil, fmt.Errorf("%s declares %d types; pick one with %s#Name", path, len(names), path)
+		}
+		name = names[0]
+	}
+
+	ty, ok := r.Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't declare %q", path, name)
+	}
+
+	return ty, nil
+}
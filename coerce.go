@@ -0,0 +1,213 @@
+package jsonb
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Coerce attempts to convert val into something that satisfies ty. It's
+// intended for dealing with legacy data that was written before the schema
+// was tightened up; the following conversions are performed:
+//
+//   - numeric strings ("42", " 1.5 ") become numbers
+//   - 0/1 and "true"/"false" become bools
+//   - numbers become strings
+//   - a lone value becomes a one-element list
+//
+// Tables and lists are coerced recursively. The returned paths are JSON
+// Pointers to every value that was converted (in document order, with table
+// fields sorted by name), so the caller knows what needs to be written
+// back. val itself is never modified; containers are copied when one of
+// their members changes. If val can't be made to fit ty, ok is false.
+//
+// NB: Rules aren't checked, as coercion can't fix them; use Validate on the
+// result.
+func (ty *Type) Coerce(val interface{}) (out interface{}, paths []string, ok bool) {
+	out, ok = ty.coerce(val, "", &paths)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return out, paths, true
+}
+
+func (ty *Type) coerce(val interface{}, path string, paths *[]string) (interface{}, bool) {
+	ty = ty.deref()
+
+	switch ty.Kind {
+	case KindTable:
+		return ty.coerceTable(val, path, paths)
+
+	case KindList:
+		return ty.coerceList(val, path, paths)
+
+	case KindAny:
+		return val, true
+	}
+
+	if ty.IsValid(val) {
+		return val, true
+	}
+
+	var (
+		out interface{}
+		ok  bool
+	)
+
+	switch ty.Kind {
+	case KindNumber:
+		out, ok = coerceNumber(val)
+	case KindString:
+		out, ok = coerceString(val)
+	case KindBool:
+		out, ok = coerceBool(val)
+	}
+
+	if !ok || !ty.IsValid(out) {
+		return nil, false
+	}
+
+	*paths = append(*paths, path)
+	return out, true
+}
+
+func (ty *Type) coerceTable(val interface{}, path string, paths *[]string) (interface{}, bool) {
+	t, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	for k := range t {
+		if _, ok := ty.Fields[k]; !ok {
+			return nil, false
+		}
+	}
+
+	// Containers are only copied once something inside them actually
+	// changes, which is detected by paths growing. Fields are walked in
+	// order so the paths are too.
+	out, copied := t, false
+	for _, k := range sortedKeys(ty.Fields) {
+		v, ok := t[k]
+		if !ok {
+			continue
+		}
+		sty := ty.Fields[k]
+
+		n := len(*paths)
+		v1, ok := sty.coerce(v, pointerAppend(path, k), paths)
+		if !ok {
+			return nil, false
+		}
+
+		if len(*paths) > n {
+			if !copied {
+				out = make(map[string]interface{}, len(t))
+				for k2, v2 := range t {
+					out[k2] = v2
+				}
+				copied = true
+			}
+			out[k] = v1
+		}
+	}
+
+	return out, true
+}
+
+func (ty *Type) coerceList(val interface{}, path string, paths *[]string) (interface{}, bool) {
+	l, ok := val.([]interface{})
+	if !ok && val != nil {
+		// Wrap up single values. The element itself may need coercion
+		// too, but that's reported as part of the wrapping.
+		var elemPaths []string
+		v, ok := ty.ListType.coerce(val, pointerAppend(path, "0"), &elemPaths)
+		if !ok {
+			return nil, false
+		}
+
+		*paths = append(*paths, path)
+		return []interface{}{v}, true
+	} else if !ok {
+		return nil, false
+	}
+
+	if ty.MaxLen > 0 && ty.MaxLen < len(l) {
+		return nil, false
+	}
+
+	out, copied := l, false
+	for i, v := range l {
+		n := len(*paths)
+		v1, ok := ty.ListType.coerce(v, pointerAppend(path, strconv.Itoa(i)), paths)
+		if !ok {
+			return nil, false
+		}
+
+		if len(*paths) > n {
+			if !copied {
+				out = make([]interface{}, len(l))
+				copy(out, l)
+				copied = true
+			}
+			out[i] = v1
+		}
+	}
+
+	return out, true
+}
+
+func coerceNumber(val interface{}) (interface{}, bool) {
+	s, ok := val.(string)
+	if !ok {
+		return nil, false
+	}
+
+	f, er := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if er != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, false
+	}
+
+	return f, true
+}
+
+func coerceString(val interface{}) (interface{}, bool) {
+	switch v := val.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), true
+	case int:
+		return strconv.Itoa(v), true
+	case int32:
+		return strconv.FormatInt(int64(v), 10), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	}
+
+	return nil, false
+}
+
+func coerceBool(val interface{}) (interface{}, bool) {
+	if s, ok := val.(string); ok {
+		switch s {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		}
+		return nil, false
+	}
+
+	if f, ok := toFloat64(val); ok {
+		switch f {
+		case 0:
+			return false, true
+		case 1:
+			return true, true
+		}
+	}
+
+	return nil, false
+}
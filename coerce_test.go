@@ -0,0 +1,209 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCoercePrimitives(t *testing.T) {
+	cases := []struct {
+		ty  *Type
+		in  interface{}
+		out interface{}
+		ok  bool
+	}{
+		{TypeNumber, "42", float64(42), true},
+		{TypeNumber, " 1.5 ", float64(1.5), true},
+		{TypeNumber, "NaN", nil, false},
+		{TypeNumber, "four", nil, false},
+		{TypeBool, float64(0), false, true},
+		{TypeBool, float64(1), true, true},
+		{TypeBool, float64(2), nil, false},
+		{TypeBool, "true", true, true},
+		{TypeBool, "yes", nil, false},
+		{TypeString, float64(42), "42", true},
+		{TypeString, float64(0.25), "0.25", true},
+		{NewStringType(2), float64(123), nil, false},
+		{TypeString, true, nil, false},
+	}
+
+	for _, c := range cases {
+		out, paths, ok := c.ty.Coerce(c.in)
+		if ok != c.ok {
+			t.Errorf("%#v: ok = %v", c.in, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if out != c.out {
+			t.Errorf("%#v: got %#v, expected %#v", c.in, out, c.out)
+		}
+		if len(paths) != 1 || paths[0] != "" {
+			t.Errorf("%#v: bad paths %#v", c.in, paths)
+		}
+	}
+}
+
+func TestCoerceUnchanged(t *testing.T) {
+	v := rtJSON(t, map[string]interface{}{
+		"one": "two",
+	})
+	ty := NewTableType(TableDef{
+		"one": TypeString,
+	})
+
+	out, paths, ok := ty.Coerce(v)
+	if !ok {
+		t.Fatal("should coerce")
+	}
+	if len(paths) != 0 {
+		t.Errorf("unexpected paths %#v", paths)
+	}
+	if !reflect.DeepEqual(out, v) {
+		t.Errorf("value changed %#v", out)
+	}
+}
+
+func TestCoerceNested(t *testing.T) {
+	v := rtJSON(t, map[string]interface{}{
+		"id":      "42",
+		"enabled": 1,
+		"tags":    "solo",
+		"items": []interface{}{
+			map[string]interface{}{"price": "1.5"},
+			map[string]interface{}{"price": 2},
+		},
+	})
+	ty := NewTableType(TableDef{
+		"id":      TypeNumber,
+		"enabled": TypeBool,
+		"tags":    TypeStringList,
+		"items": NewListType(NewTableType(TableDef{
+			"price": TypeNumber,
+		}), -1),
+	})
+
+	before := rtJSON(t, v)
+	out, paths, ok := ty.Coerce(v)
+	if !ok {
+		t.Fatal("should coerce")
+	}
+
+	if !reflect.DeepEqual(v, before) {
+		t.Error("input was modified")
+	}
+	if !ty.IsValid(out) {
+		t.Errorf("coerced value is invalid %#v", out)
+	}
+
+	// Paths come out in order, every time.
+	expected := []string{"/enabled", "/id", "/items/0/price", "/tags"}
+	for i := 0; i < 10; i++ {
+		if _, paths, _ = ty.Coerce(v); !reflect.DeepEqual(paths, expected) {
+			t.Fatalf("wrong paths %#v", paths)
+		}
+	}
+}
+
+func TestCoerceUnknownField(t *testing.T) {
+	v := rtJSON(t, map[string]interface{}{
+		"nope": "42",
+	})
+	ty := NewTableType(TableDef{
+		"id": TypeNumber,
+	})
+
+	if _, _, ok := ty.Coerce(v); ok {
+		t.Error("should not coerce")
+	}
+}
+
+func TestCoerceListMaxLen(t *testing.T) {
+	ty := NewListType(TypeNumber, 1)
+
+	if _, _, ok := ty.Coerce(rtJSON(t, []string{"1", "2"})); ok {
+		t.Error("should not coerce")
+	}
+	if out, _, ok := ty.Coerce("1"); !ok {
+		t.Error("should coerce")
+	} else if !reflect.DeepEqual(out, []interface{}{float64(1)}) {
+		t.Errorf("wrong value %#v", out)
+	}
+}
+
+func TestTableAsCoerce(t *testing.T) {
+	tb := Table{
+		raw: json.RawMessage(`{"one":"1","two":2}`),
+	}
+	ty := NewTableType(TableDef{
+		"one": TypeNumber,
+		"two": TypeString,
+	})
+
+	if _, er := tb.As(ty); er != ErrSchema {
+		t.Fatal("As should fail")
+	}
+
+	mt, paths, er := tb.AsCoerce(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if len(paths) != 2 {
+		t.Errorf("wrong paths %#v", paths)
+	}
+
+	bs, er := json.Marshal(mt)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if string(bs) != `{"one":1,"two":"2"}` {
+		t.Errorf("wrong serialization %s", bs)
+	}
+}
+
+func TestListAsCoerce(t *testing.T) {
+	l := List{
+		raw: json.RawMessage(`["1",2]`),
+	}
+
+	ml, paths, er := l.AsCoerce(TypeNumberList)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if len(paths) != 1 || paths[0] != "/0" {
+		t.Errorf("wrong paths %#v", paths)
+	}
+	if !reflect.DeepEqual(ml.Values(), []interface{}{float64(1), float64(2)}) {
+		t.Errorf("wrong values %#v", ml.Values())
+	}
+
+	if _, _, er := l.AsCoerce(TypeBoolList); er != ErrSchema {
+		t.Errorf("expected ErrSchema, got %v", er)
+	}
+}
+
+func TestTableAsCoerceRules(t *testing.T) {
+	tb := Table{
+		raw: json.RawMessage(`{"a":"1","b":2}`),
+	}
+	ty := NewTableType(TableDef{
+		"a": TypeNumber,
+		"b": TypeNumber,
+	}).WithRules(MutuallyExclusive("a", "b"))
+
+	_, _, er := tb.AsCoerce(ty)
+	if errs := testRuleErrors(er); !reflect.DeepEqual(errs, []string{"/b mutually_exclusive"}) {
+		t.Errorf("got %v", er)
+	}
+
+	l := List{
+		raw: json.RawMessage(`[{"a":"1","b":2}]`),
+	}
+	if _, _, er := l.AsCoerce(NewListType(ty, -1)); !errors.Is(er, ErrSchema) {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+}
@@ -0,0 +1,193 @@
+package jsonb
+
+// DefaultMode says how the defaults of a table Type's fields are applied.
+type DefaultMode int
+
+const (
+	// DefaultsVirtual leaves missing fields out of the document; their
+	// defaults are only visible through MutableTable.Get.
+	DefaultsVirtual DefaultMode = iota
+
+	// DefaultsMaterialize adds the defaults of missing fields to the
+	// document when it's read with As (or made with NewTable), marking the
+	// Table dirty so they're written back.
+	DefaultsMaterialize
+)
+
+// WithDefault returns a copy of ty with val as its default. It panics if
+// val isn't valid for ty, as Types are meant to be built statically.
+func (ty *Type) WithDefault(val interface{}) *Type {
+	if !ty.IsValid(val) {
+		panic(ErrSchema)
+	}
+
+	out := *ty
+	out.Default = val
+	return &out
+}
+
+// WithDefaultFunc returns a copy of ty whose default is made by calling fn
+// (e.g. for timestamps or IDs). Values are checked when they're made.
+//
+// NB: With DefaultsVirtual, fn is called every time the value is read.
+func (ty *Type) WithDefaultFunc(fn func() interface{}) *Type {
+	out := *ty
+	out.DefaultFunc = fn
+	return &out
+}
+
+// WithDefaults returns a copy of the table Type ty with the given
+// DefaultMode.
+func (ty *Type) WithDefaults(mode DefaultMode) *Type {
+	out := *ty
+	out.Defaults = mode
+	return &out
+}
+
+func (ty *Type) hasDefault() bool {
+	return ty.Default != nil || ty.DefaultFunc != nil
+}
+
+// defaultValue returns a new copy of ty's default value.
+func (ty *Type) defaultValue() (interface{}, error) {
+	if ty.DefaultFunc == nil {
+		return deepCopy(ty.Default), nil
+	}
+
+	val := ty.DefaultFunc()
+	if !ty.IsValid(val) {
+		return nil, ErrSchema
+	}
+
+	return val, nil
+}
+
+// fillTable adds the defaults of fields missing from t (in place), if ty
+// uses DefaultsMaterialize, and fills in nested values too. It returns the
+// keys of t which were changed.
+func (ty *Type) fillTable(t map[string]interface{}) ([]string, error) {
+	var changed []string
+
+	for _, k := range sortedKeys(ty.Fields) {
+		fty := ty.Fields[k]
+
+		v, ok := t[k]
+		if !ok {
+			if ty.Defaults != DefaultsMaterialize || !fty.hasDefault() {
+				continue
+			}
+
+			def, er := fty.defaultValue()
+			if er != nil {
+				return changed, er
+			}
+			t[k], v = def, def
+		}
+
+		filled, er := fty.fillDefaults(v)
+		if er != nil {
+			return changed, er
+		}
+
+		if !ok || filled {
+			changed = append(changed, k)
+		}
+	}
+
+	return changed, nil
+}
+
+// fillDefaults fills in defaults wherever val contains tables (see
+// fillTable), returning true if anything changed.
+func (ty *Type) fillDefaults(val interface{}) (bool, error) {
+	ty = ty.deref()
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		if ty.Kind != KindTable {
+			return false, nil
+		}
+
+		keys, er := ty.fillTable(v)
+		return len(keys) > 0, er
+
+	case []interface{}:
+		if ty.Kind != KindList {
+			return false, nil
+		}
+
+		filled := false
+		for _, v1 := range v {
+			ok, er := ty.ListType.fillDefaults(v1)
+			if er != nil {
+				return filled, er
+			}
+			filled = filled || ok
+		}
+		return filled, nil
+	}
+
+	return false, nil
+}
+
+// fillDefaults materializes the MutableTable's defaults, marking the
+// top-level keys it changes. The defaults are filled into a copy, so if they
+// would break a Rule, the document is left alone and the ValidationErrors
+// are returned.
+func (mt *MutableTable) fillDefaults() error {
+	out := deepCopy(mt.decoded).(map[string]interface{})
+	keys, er := mt.ty.fillTable(out)
+	if er != nil || len(keys) == 0 {
+		return er
+	}
+
+	if er := newViolations(mt.ty, mt.decoded, out); er != nil {
+		return er
+	}
+
+	mt.decoded = out
+	for _, k := range keys {
+		mt.markChanged(pointerAppend("", k), false)
+	}
+
+	return nil
+}
+
+// fillDefaults materializes the defaults of the MutableList's tables,
+// marking it dirty if anything was filled in (see MutableTable.fillDefaults).
+func (ml *MutableList) fillDefaults() error {
+	out := deepCopy(ml.decoded).([]interface{})
+	filled, er := ml.ty.fillDefaults(out)
+	if er != nil || !filled {
+		return er
+	}
+
+	if er := newViolations(ml.ty, ml.decoded, out); er != nil {
+		return er
+	}
+
+	ml.decoded = out
+	ml.dirty = true
+	return nil
+}
+
+// Get returns the value of key or, if it isn't set, its default. ok is
+// false if key is neither set nor has a default (or isn't a field).
+func (mt *MutableTable) Get(key string) (val interface{}, ok bool) {
+	dec, er := mt.decode()
+	if er != nil {
+		return nil, false
+	}
+
+	if val, ok := dec[key]; ok {
+		return val, true
+	}
+
+	fty, ok := mt.ty.Fields[key]
+	if !ok || !fty.hasDefault() {
+		return nil, false
+	}
+
+	val, er = fty.defaultValue()
+	return val, er == nil
+}
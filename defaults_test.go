@@ -0,0 +1,208 @@
+package jsonb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDefaultsMaterialize(t *testing.T) {
+	n := 0
+	ty := NewTableType(TableDef{
+		"name":   TypeString,
+		"status": TypeString.WithDefault("new"),
+		"seq": TypeNumber.WithDefaultFunc(func() interface{} {
+			n++
+			return float64(n)
+		}),
+		"items": NewListType(NewTableType(TableDef{
+			"qty": TypeNumber.WithDefault(float64(1)),
+		}).WithDefaults(DefaultsMaterialize), -1),
+	}).WithDefaults(DefaultsMaterialize)
+
+	var tab Table
+	if er := tab.Scan(`{"name": "ada", "status": "old", "items": [{"qty": 2}, {}]}`); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{
+		"name":   "ada",
+		"status": "old",
+		"seq":    float64(1),
+		"items": []interface{}{
+			map[string]interface{}{"qty": float64(2)},
+			map[string]interface{}{"qty": float64(1)},
+		},
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if full, patch, _ := mt.changes(); full || len(patch) != 2 || patch["seq"] == nil || patch["items"] == nil {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+
+	mt = NewTable(ty)
+	expected = map[string]interface{}{"status": "new", "seq": float64(2)}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	// Rows with everything set stay clean.
+	if er := tab.Scan(`{"status": "x", "seq": 5}`); er != nil {
+		t.Fatal(er)
+	}
+	if mt, er := tab.As(ty); er != nil || mt.Dirty() {
+		t.Errorf("got %v, dirty %v", er, mt.Dirty())
+	}
+}
+
+func TestDefaultsList(t *testing.T) {
+	ty := NewListType(NewTableType(TableDef{
+		"qty": TypeNumber.WithDefault(float64(1)),
+	}).WithDefaults(DefaultsMaterialize), -1)
+
+	var l List
+	if er := l.Scan(`[{"qty": 2}, {}]`); er != nil {
+		t.Fatal(er)
+	}
+
+	ml, er := l.As(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []interface{}{
+		map[string]interface{}{"qty": float64(2)},
+		map[string]interface{}{"qty": float64(1)},
+	}
+	if !reflect.DeepEqual(ml.Values(), expected) || !ml.Dirty() {
+		t.Errorf("got %#v, dirty %v", ml.Values(), ml.Dirty())
+	}
+
+	if er := l.Scan(`[{}, {"qty": "3"}]`); er != nil {
+		t.Fatal(er)
+	}
+
+	ml, _, er = l.AsCoerce(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected = []interface{}{
+		map[string]interface{}{"qty": float64(1)},
+		map[string]interface{}{"qty": float64(3)},
+	}
+	if !reflect.DeepEqual(ml.Values(), expected) || !ml.Dirty() {
+		t.Errorf("got %#v, dirty %v", ml.Values(), ml.Dirty())
+	}
+
+	// Lists with everything set stay clean.
+	if er := l.Scan(`[{"qty": 2}]`); er != nil {
+		t.Fatal(er)
+	}
+	if ml, er := l.As(ty); er != nil || ml.Dirty() {
+		t.Errorf("got %v, dirty %v", er, ml.Dirty())
+	}
+}
+
+func TestDefaultsRules(t *testing.T) {
+	ty := NewTableType(TableDef{
+		"a": TypeNumber,
+		"b": TypeNumber.WithDefault(float64(1)),
+	}).WithDefaults(DefaultsMaterialize).WithRules(MutuallyExclusive("a", "b"))
+
+	var tab Table
+	if er := tab.Scan(`{"a": 1}`); er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := tab.As(ty); !errors.Is(er, ErrSchema) {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	// Nothing is left behind by the failed As.
+	if dec, _ := tab.decode(); len(dec) != 1 || tab.Dirty() {
+		t.Errorf("got %#v, dirty %v", dec, tab.Dirty())
+	}
+
+	var l List
+	if er := l.Scan(`[{"a": 1}]`); er != nil {
+		t.Fatal(er)
+	}
+	if _, er := l.As(NewListType(ty, -1)); !errors.Is(er, ErrSchema) {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	// Documents which already have b are fine.
+	if er := tab.Scan(`{"b": 2}`); er != nil {
+		t.Fatal(er)
+	}
+	if _, er := tab.As(ty); er != nil {
+		t.Error(er)
+	}
+}
+
+func TestDefaultsVirtual(t *testing.T) {
+	ty := NewTableType(TableDef{
+		"name":   TypeString,
+		"status": TypeString.WithDefault("new"),
+	})
+
+	var tab Table
+	if er := tab.Scan(`{"name": "ada"}`); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if mt.Dirty() {
+		t.Errorf("virtual defaults shouldn't dirty the table")
+	}
+
+	if val, ok := mt.Get("status"); !ok || val != "new" {
+		t.Errorf("got %v, %v", val, ok)
+	}
+	if val, ok := mt.Get("name"); !ok || val != "ada" {
+		t.Errorf("got %v, %v", val, ok)
+	}
+	if _, ok := mt.Get("nope"); ok {
+		t.Errorf("got a value for a missing field")
+	}
+
+	if dec, _ := mt.decode(); len(dec) != 1 {
+		t.Errorf("got %#v", dec)
+	}
+}
+
+func TestDefaultsInvalid(t *testing.T) {
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("WithDefault should panic on invalid values")
+			}
+		}()
+		TypeNumber.WithDefault("one")
+	}()
+
+	ty := NewTableType(TableDef{
+		"n": TypeNumber.WithDefaultFunc(func() interface{} { return "one" }),
+	}).WithDefaults(DefaultsMaterialize)
+
+	var tab Table
+	if er := tab.Scan(`{}`); er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := tab.As(ty); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+}
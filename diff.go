@@ -0,0 +1,216 @@
+package jsonb
+
+import (
+	"fmt"
+)
+
+// Compatibility describes which way a schema change can be rolled out.
+type Compatibility int
+
+const (
+	// CompatBackward changes accept everything the old Type did, so new
+	// code can read old data. Adding a field or loosening a MaxLen is
+	// backward-compatible.
+	CompatBackward Compatibility = iota
+
+	// CompatForward changes only accept things the old Type did, so old
+	// code can read new data. Removing a field or tightening a MaxLen is
+	// forward-compatible.
+	CompatForward
+
+	// CompatBreaking changes are neither backward- nor forward-compatible
+	// (e.g. changing a number field to a string).
+	CompatBreaking
+)
+
+var compatStrings = map[Compatibility]string{
+	CompatBackward: "backward-compatible",
+	CompatForward:  "forward-compatible",
+	CompatBreaking: "breaking",
+}
+
+func (c Compatibility) String() string {
+	return compatStrings[c]
+}
+
+// SchemaChangeKind enumerates the differences DiffTypes can find.
+type SchemaChangeKind int
+
+const (
+	FieldAdded SchemaChangeKind = iota
+	FieldRemoved
+	KindChanged
+	MaxLenTightened
+	MaxLenLoosened
+)
+
+var schemaChangeKindStrings = map[SchemaChangeKind]string{
+	FieldAdded:      "field added",
+	FieldRemoved:    "field removed",
+	KindChanged:     "kind changed",
+	MaxLenTightened: "max length tightened",
+	MaxLenLoosened:  "max length loosened",
+}
+
+func (k SchemaChangeKind) String() string {
+	return schemaChangeKindStrings[k]
+}
+
+// SchemaChange is a single difference between two Types.
+type SchemaChange struct {
+	// Path is a JSON Pointer to the changed value within a document. List
+	// elements are denoted by a "*" token (e.g. "/items/*/price").
+	Path string
+
+	Kind   SchemaChangeKind
+	Compat Compatibility
+
+	// Old and New are the Types at Path; Old is nil for added fields and
+	// New is nil for removed ones.
+	Old, New *Type
+}
+
+func (c SchemaChange) String() string {
+	path := c.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return fmt.Sprintf("%s: %s (%s)", path, c.Kind, c.Compat)
+}
+
+// DiffTypes compares two Types and returns every difference between them,
+// with nested differences reported at their own paths. A nil result means
+// the Types accept exactly the same documents.
+func DiffTypes(old, new *Type) []SchemaChange {
+	var changes []SchemaChange
+	diffTypes(old, new, "", &changes)
+	return changes
+}
+
+// SchemaCompat returns the overall compatibility of a set of changes, i.e.
+// CompatBreaking if any change is breaking or if both backward- and
+// forward-compatible changes are present. ok is false if changes is empty.
+func SchemaCompat(changes []SchemaChange) (compat Compatibility, ok bool) {
+	for i, c := range changes {
+		if i == 0 {
+			compat = c.Compat
+		} else if c.Compat != compat {
+			compat = CompatBreaking
+		}
+	}
+
+	return compat, len(changes) > 0
+}
+
+func diffTypes(old, new *Type, path string, changes *[]SchemaChange) {
+	if old == new {
+		return
+	}
+
+	if old.Kind != new.Kind {
+		compat := CompatBreaking
+		if new.Kind == KindAny {
+			compat = CompatBackward
+		} else if old.Kind == KindAny {
+			compat = CompatForward
+		}
+
+		*changes = append(*changes, SchemaChange{
+			Path:   path,
+			Kind:   KindChanged,
+			Compat: compat,
+			Old:    old,
+			New:    new,
+		})
+		return
+	}
+
+	switch old.Kind {
+	case KindTable:
+		diffFields(old, new, path, changes)
+
+	case KindList:
+		diffMaxLen(old, new, path, changes)
+		diffTypes(old.ListType, new.ListType, pointerAppend(path, "*"), changes)
+
+	case KindString:
+		diffMaxLen(old, new, path, changes)
+
+	case KindRef:
+		// NB: References are compared by name, not expanded, since they
+		// may be recursive.
+		if old.Ref != new.Ref {
+			*changes = append(*changes, SchemaChange{
+				Path:   path,
+				Kind:   KindChanged,
+				Compat: CompatBreaking,
+				Old:    old,
+				New:    new,
+			})
+		}
+	}
+}
+
+func diffFields(old, new *Type, path string, changes *[]SchemaChange) {
+	for _, k := range sortedKeys(old.Fields) {
+		fpath := pointerAppend(path, k)
+		nty, ok := new.Fields[k]
+		if !ok {
+			*changes = append(*changes, SchemaChange{
+				Path:   fpath,
+				Kind:   FieldRemoved,
+				Compat: CompatForward,
+				Old:    old.Fields[k],
+			})
+			continue
+		}
+
+		diffTypes(old.Fields[k], nty, fpath, changes)
+	}
+
+	for _, k := range sortedKeys(new.Fields) {
+		if _, ok := old.Fields[k]; !ok {
+			*changes = append(*changes, SchemaChange{
+				Path:   pointerAppend(path, k),
+				Kind:   FieldAdded,
+				Compat: CompatBackward,
+				New:    new.Fields[k],
+			})
+		}
+	}
+}
+
+func diffMaxLen(old, new *Type, path string, changes *[]SchemaChange) {
+	// Anything <= 0 is unbounded.
+	o, n := old.MaxLen, new.MaxLen
+	if o < 0 {
+		o = 0
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	switch {
+	case o == n:
+		return
+
+	case o == 0 || (n != 0 && n < o):
+		*changes = append(*changes, SchemaChange{
+			Path:   path,
+			Kind:   MaxLenTightened,
+			Compat: CompatForward,
+			Old:    old,
+			New:    new,
+		})
+
+	default:
+		*changes = append(*changes, SchemaChange{
+			Path:   path,
+			Kind:   MaxLenLoosened,
+			Compat: CompatBackward,
+			Old:    old,
+			New:    new,
+		})
+	}
+}
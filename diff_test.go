@@ -0,0 +1,93 @@
+package jsonb
+
+import (
+	"testing"
+)
+
+func TestDiffTypesSame(t *testing.T) {
+	a := NewTableType(TableDef{
+		"one": TypeString,
+		"two": NewListType(TypeNumber, -1),
+	})
+	b := NewTableType(TableDef{
+		"one": TypeString,
+		"two": NewListType(TypeNumber, 0),
+	})
+
+	if changes := DiffTypes(a, b); len(changes) != 0 {
+		t.Errorf("unexpected changes %v", changes)
+	}
+	if _, ok := SchemaCompat(nil); ok {
+		t.Error("no changes should have no compatibility")
+	}
+}
+
+func TestDiffTypes(t *testing.T) {
+	old := NewTableType(TableDef{
+		"name":    NewStringType(10),
+		"gone":    TypeNumber,
+		"count":   TypeNumber,
+		"extra":   TypeNumber,
+		"choices": TypeAny,
+		"items": NewListType(NewTableType(TableDef{
+			"price": TypeNumber,
+		}), 5),
+	})
+	new := NewTableType(TableDef{
+		"name":    NewStringType(20),
+		"count":   TypeString,
+		"extra":   TypeAny,
+		"choices": TypeStringList,
+		"added":   TypeBool,
+		"items": NewListType(NewTableType(TableDef{
+			"price": TypeString,
+		}), 2),
+	})
+
+	expected := []SchemaChange{
+		{Path: "/choices", Kind: KindChanged, Compat: CompatForward},
+		{Path: "/count", Kind: KindChanged, Compat: CompatBreaking},
+		{Path: "/extra", Kind: KindChanged, Compat: CompatBackward},
+		{Path: "/gone", Kind: FieldRemoved, Compat: CompatForward},
+		{Path: "/items", Kind: MaxLenTightened, Compat: CompatForward},
+		{Path: "/items/*/price", Kind: KindChanged, Compat: CompatBreaking},
+		{Path: "/name", Kind: MaxLenLoosened, Compat: CompatBackward},
+		{Path: "/added", Kind: FieldAdded, Compat: CompatBackward},
+	}
+
+	changes := DiffTypes(old, new)
+	if len(changes) != len(expected) {
+		t.Fatalf("wrong changes %v", changes)
+	}
+
+	for i, c := range changes {
+		e := expected[i]
+		if c.Path != e.Path || c.Kind != e.Kind || c.Compat != e.Compat {
+			t.Errorf("got %s, expected %s", c, e)
+		}
+	}
+
+	if compat, _ := SchemaCompat(changes); compat != CompatBreaking {
+		t.Errorf("wrong compatibility %s", compat)
+	}
+}
+
+func TestDiffTypesMaxLen(t *testing.T) {
+	if changes := DiffTypes(TypeString, NewStringType(5)); len(changes) != 1 || changes[0].Kind != MaxLenTightened {
+		t.Errorf("wrong changes %v", changes)
+	}
+	if changes := DiffTypes(NewStringType(5), TypeString); len(changes) != 1 || changes[0].Kind != MaxLenLoosened {
+		t.Errorf("wrong changes %v", changes)
+	}
+}
+
+func TestSchemaCompat(t *testing.T) {
+	changes := DiffTypes(
+		NewTableType(TableDef{"one": TypeNumber}),
+		NewTableType(TableDef{"one": TypeNumber, "two": TypeNumber, "three": TypeString}),
+	)
+
+	if compat, ok := SchemaCompat(changes); !ok || compat != CompatBackward {
+		t.Errorf("wrong compatibility %s", compat)
+	}
+}
@@ -0,0 +1,186 @@
+package jsonb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+)
+
+// Document holds any jsonb value (a table, a list, a string, a number, a
+// bool or null) of a given Type. Unlike Table and List, it can be used for
+// columns with scalar or mixed-shape values; Scan validates the value
+// against the Type. A zero Document is of TypeAny.
+//
+// Tables and lists held by a Document can be narrowed to a MutableTable or
+// MutableList with AsTable/AsList.
+type Document struct {
+	ty *Type
+
+	// raw is nil if decoded has changed since it was scanned.
+	raw     json.RawMessage
+	decoded interface{}
+
+	dirty bool
+}
+
+var _ sql.Scanner = &Document{}
+var _ driver.Valuer = &Document{}
+
+// NewDocument returns a Document of the given Type, holding null.
+func NewDocument(ty *Type) *Document {
+	return &Document{ty: ty}
+}
+
+// Type returns the Document's Type.
+func (d *Document) Type() *Type {
+	if d.ty == nil {
+		return TypeAny
+	}
+
+	return d.ty
+}
+
+func (d *Document) encode() (_ json.RawMessage, er error) {
+	if d.raw == nil {
+		if d.raw, er = json.Marshal(d.decoded); er != nil {
+			d.raw = nil
+			return nil, er
+		}
+	}
+
+	return d.raw, nil
+}
+
+func (d *Document) set(raw []byte) error {
+	var val interface{}
+	if er := json.Unmarshal(raw, &val); er != nil {
+		return ErrInvalidJsonType
+	}
+
+	if !d.Type().IsValid(val) {
+		return ErrSchema
+	}
+
+	d.raw = json.RawMessage(raw)
+	d.decoded = val
+	d.dirty = false
+	return nil
+}
+
+func (d *Document) Scan(src interface{}) error {
+	bs, er := scanBytes(src)
+	if er != nil {
+		return er
+	}
+
+	return d.set(bs)
+}
+
+func (d *Document) Value() (driver.Value, error) {
+	raw, er := d.encode()
+	return []byte(raw), er
+}
+
+func (d *Document) MarshalJSON() ([]byte, error) {
+	return d.encode()
+}
+
+func (d *Document) UnmarshalJSON(bs []byte) error {
+	// NB: bs belongs to the caller.
+	raw := make([]byte, len(bs))
+	copy(raw, bs)
+
+	return d.set(raw)
+}
+
+// Dirty returns true if the Document has been modified (via Set) since it
+// was read.
+func (d *Document) Dirty() bool {
+	return d.dirty
+}
+
+// MarkClean clears the dirty flag; call it once the Document has been
+// written back to the database.
+func (d *Document) MarkClean() {
+	d.dirty = false
+}
+
+// Interface returns the decoded value. It must not be modified.
+func (d *Document) Interface() interface{} {
+	return d.decoded
+}
+
+// Set replaces the Document's value. ErrSchema is returned if val isn't of
+// the Document's Type.
+//
+// A *MutableTable or *MutableList (e.g. from AsTable or AsList) sets the
+// Document to its current value, which is how changes made through them are
+// written back.
+func (d *Document) Set(val interface{}) error {
+	switch v := val.(type) {
+	case *MutableTable:
+		dec, er := v.decode()
+		if er != nil {
+			return er
+		}
+		val = dec
+
+	case *MutableList:
+		dec, er := v.decode()
+		if er != nil {
+			return er
+		}
+		val = dec
+	}
+
+	if !d.Type().IsValid(val) {
+		return ErrSchema
+	}
+
+	d.decoded = deepCopy(val)
+	d.raw = nil
+	d.dirty = true
+	return nil
+}
+
+// AsTable returns a copy of the Document's value as a MutableTable of type
+// ty (or the Document's Type, if ty is nil). ErrUnexpectedType is returned
+// if the value isn't a table, and ErrSchema if it isn't of type ty or ty
+// isn't a table type (e.g. a nil ty when the Document has no Type).
+//
+// NB: Changes to the copy don't affect the Document until it's passed back
+// to Set.
+func (d *Document) AsTable(ty *Type) (*MutableTable, error) {
+	dec, ok := d.decoded.(map[string]interface{})
+	if !ok {
+		return nil, ErrUnexpectedType
+	}
+
+	if ty == nil {
+		ty = d.Type()
+	}
+	if ty.deref().Kind != KindTable {
+		return nil, ErrSchema
+	}
+
+	t := &Table{decoded: deepCopy(dec).(map[string]interface{})}
+	return t.As(ty)
+}
+
+// AsList is the List equivalent of AsTable.
+func (d *Document) AsList(ty *Type) (*MutableList, error) {
+	dec, ok := d.decoded.([]interface{})
+	if !ok {
+		return nil, ErrUnexpectedType
+	}
+
+	if ty == nil {
+		ty = d.Type()
+	}
+	if ty.deref().Kind != KindList {
+		return nil, ErrSchema
+	}
+
+	l := &List{decoded: deepCopy(dec).([]interface{})}
+	return l.As(ty)
+}
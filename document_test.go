@@ -0,0 +1,156 @@
+package jsonb
+
+import (
+	"testing"
+)
+
+func TestDocumentScan(t *testing.T) {
+	tests := []struct {
+		ty  *Type
+		src string
+		er  error
+	}{
+		{nil, `"hello"`, nil},
+		{nil, `12.5`, nil},
+		{nil, `null`, nil},
+		{nil, `[1, {"a": true}]`, nil},
+		{TypeString, `"hello"`, nil},
+		{TypeString, `12`, ErrSchema},
+		{NewStringType(3), `"hello"`, ErrSchema},
+		{TypeNumber, `12`, nil},
+		{TypeBool, `false`, nil},
+		{TypeNumberList, `[1, 2]`, nil},
+		{TypeNumberList, `{}`, ErrSchema},
+		{TypeAny, `{"a": `, ErrInvalidJsonType},
+	}
+
+	for _, test := range tests {
+		d := NewDocument(test.ty)
+		if er := d.Scan([]byte(test.src)); er != test.er {
+			t.Errorf("%s: got %v, expected %v", test.src, er, test.er)
+		}
+	}
+}
+
+func TestDocumentValue(t *testing.T) {
+	var d Document
+
+	if val, er := d.Value(); er != nil || string(val.([]byte)) != `null` {
+		t.Errorf("got %s, %v", val, er)
+	}
+
+	if er := d.Scan(`"x"`); er != nil {
+		t.Fatal(er)
+	}
+
+	if d.Interface() != "x" || d.Dirty() {
+		t.Errorf("got %#v, dirty %v", d.Interface(), d.Dirty())
+	}
+
+	if er := d.Set(3); er != nil {
+		t.Fatal(er)
+	}
+
+	if val, er := d.Value(); er != nil || string(val.([]byte)) != `3` || !d.Dirty() {
+		t.Errorf("got %s, %v, dirty %v", val, er, d.Dirty())
+	}
+
+	d2 := NewDocument(TypeString)
+	if er := d2.Set(3); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+}
+
+func TestDocumentNarrow(t *testing.T) {
+	ty := NewTableType(TableDef{"a": TypeNumber})
+
+	d := NewDocument(TypeAny)
+	if er := d.Scan(`{"a": 1}`); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := d.AsTable(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := mt.Set("a", 2); er != nil {
+		t.Fatal(er)
+	}
+
+	// The MutableTable is a copy until it's written back.
+	if d.Interface().(map[string]interface{})["a"] != float64(1) {
+		t.Errorf("document changed: %#v", d.Interface())
+	}
+
+	if er := d.Set(mt); er != nil {
+		t.Fatal(er)
+	}
+	if d.Interface().(map[string]interface{})["a"] != 2 || !d.Dirty() {
+		t.Errorf("got %#v, dirty %v", d.Interface(), d.Dirty())
+	}
+
+	// Writes back are still checked against the Document's own Type.
+	strict := NewDocument(NewTableType(TableDef{"b": TypeNumber}))
+	if er := strict.Set(mt); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	if _, er := d.AsList(TypeAnyList); er != ErrUnexpectedType {
+		t.Errorf("got %v, expected ErrUnexpectedType", er)
+	}
+
+	if _, er := d.AsTable(NewTableType(TableDef{"b": TypeNumber})); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	// Without a table Type to check Sets against, there's nothing to narrow
+	// to.
+	var zero Document
+	if er := zero.Scan(`{"a": 1}`); er != nil {
+		t.Fatal(er)
+	}
+	if _, er := zero.AsTable(nil); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	d = NewDocument(TypeNumberList)
+	if er := d.Scan(`[1, 2]`); er != nil {
+		t.Fatal(er)
+	}
+
+	ml, er := d.AsList(nil)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := ml.Append(float64(3)); er != nil {
+		t.Fatal(er)
+	}
+	if er := d.Set(ml); er != nil {
+		t.Fatal(er)
+	}
+	if len(d.Interface().([]interface{})) != 3 {
+		t.Errorf("got %#v", d.Interface())
+	}
+}
+
+func TestDocumentScalars(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+
+	var (
+		s = NewDocument(TypeString)
+		n = NewDocument(TypeNumber)
+		a Document
+	)
+
+	er := db.QueryRow(`SELECT '"hi"'::jsonb, '1.5'::jsonb, 'true'::jsonb`).Scan(s, n, &a)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if s.Interface() != "hi" || n.Interface() != 1.5 || a.Interface() != true {
+		t.Errorf("got %#v, %#v, %#v", s.Interface(), n.Interface(), a.Interface())
+	}
+}
@@ -0,0 +1,1052 @@
+package jsonb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SchemaSyntaxError is returned by ParseSchema, ParseRegistry and
+// LoadSchemaFile for malformed schemas. Line and Col are 1-based; Col
+// counts bytes.
+type SchemaSyntaxError struct {
+	File string
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *SchemaSyntaxError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("jsonb: %d:%d: %s", e.Line, e.Col, e.Msg)
+	}
+
+	return fmt.Sprintf("jsonb: %s:%d:%d: %s", e.File, e.Line, e.Col, e.Msg)
+}
+
+// Is makes errors.Is(er, ErrSchema) true for SchemaSyntaxErrors.
+func (e *SchemaSyntaxError) Is(target error) bool {
+	return target == ErrSchema
+}
+
+// ParseSchema parses a Type written in the schema language, e.g.
+//
+//	table {
+//		id: number required,
+//		name: string(64) index(btree unique),
+//		tags: list<string(32)> max 10 default [],
+//		"e-mail": string,
+//		phone: string,
+//	} exactly_one("e-mail", phone)
+//
+// Types are number, bool, any, string (or string(n), for at most n bytes),
+// list<T> and table { field: T, ... }; field names are identifiers or JSON
+// strings. A type may be followed by:
+//
+//   - max n, for lists of at most n elements;
+//   - default <json>, see WithDefault;
+//   - index(method [unique] [name "..."] [where "..."]), see Index;
+//   - defaults materialize (or virtual), for tables, see WithDefaults;
+//   - required(f...), requires(f, g...), required_if(f, g, <json>),
+//     mutually_exclusive(f...) or exactly_one(f...), for tables, see the
+//     Rule constructors.
+//
+// A field followed by required is short for required(field). // starts a
+// comment.
+func ParseSchema(src string) (*Type, error) {
+	p, er := newDSLParser(src, nil)
+	if er != nil {
+		return nil, er
+	}
+
+	ty, er := p.parseType()
+	if er != nil {
+		return nil, er
+	}
+
+	if p.tok.typ != dslEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s after type", p.tok)
+	}
+
+	if er := p.finish(); er != nil {
+		return nil, er
+	}
+
+	return ty, nil
+}
+
+// ParseRegistry parses a list of named types in the schema language:
+//
+//	type User = table { name: string }
+//	type Comment = table { text: string, author: User, replies: list<Comment> }
+//
+// Declared names can be used as types anywhere in the list (before or after
+// their declaration), so types can be recursive. Referring to a name which
+// isn't declared is an error.
+func ParseRegistry(src string) (*Registry, error) {
+	r := NewRegistry()
+
+	p, er := newDSLParser(src, r)
+	if er != nil {
+		return nil, er
+	}
+
+	for p.tok.typ != dslEOF {
+		if !p.isIdent("type") {
+			return nil, p.errorf(p.tok.pos, "expected type declaration, found %s", p.tok)
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		name := p.tok
+		if name.typ != dslIdent || dslKeywords[name.text] {
+			return nil, p.errorf(name.pos, "expected type name, found %s", name)
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		if er := p.expect("="); er != nil {
+			return nil, er
+		}
+
+		ty, er := p.parseType()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := r.Register(name.text, ty); er != nil {
+			return nil, p.errorf(name.pos, "%q is already declared", name.text)
+		}
+	}
+
+	if er := p.finish(); er != nil {
+		return nil, er
+	}
+
+	return r, nil
+}
+
+// LoadSchemaFile reads a file of named types (see ParseRegistry).
+// SchemaSyntaxErrors it returns include the path.
+func LoadSchemaFile(path string) (*Registry, error) {
+	bs, er := ioutil.ReadFile(path)
+	if er != nil {
+		return nil, er
+	}
+
+	r, er := ParseRegistry(string(bs))
+	if se, ok := er.(*SchemaSyntaxError); ok {
+		se.File = path
+	}
+
+	return r, er
+}
+
+/* Lexer */
+
+type dslTokenType int
+
+const (
+	dslEOF dslTokenType = iota
+	dslIdent
+	dslNumber
+	dslString
+	dslPunct
+)
+
+type dslToken struct {
+	typ  dslTokenType
+	text string
+	pos  int
+
+	// num is set for dslNumber; str is the unescaped value of dslString.
+	num float64
+	str string
+}
+
+func (t dslToken) String() string {
+	switch t.typ {
+	case dslEOF:
+		return "end of input"
+	case dslString:
+		return t.text
+	}
+
+	return strconv.Quote(t.text)
+}
+
+// dslKeywords can't be used as type names.
+var dslKeywords = map[string]bool{
+	"number": true,
+	"string": true,
+	"bool":   true,
+	"any":    true,
+	"list":   true,
+	"table":  true,
+	"type":   true,
+}
+
+type dslLexer struct {
+	src string
+	pos int
+}
+
+func dslIsIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || (!first && unicode.IsDigit(r))
+}
+
+// dslIsIdent returns true if s can be written without quotes.
+func dslIsIdent(s string) bool {
+	for i, r := range s {
+		if !dslIsIdentRune(r, i == 0) {
+			return false
+		}
+	}
+
+	return s != ""
+}
+
+func (l *dslLexer) skipSpace() {
+	for l.pos < len(l.src) {
+		switch {
+		case strings.IndexByte(" \t\r\n\f", l.src[l.pos]) >= 0:
+			l.pos++
+
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			if end := strings.IndexByte(l.src[l.pos:], '\n'); end >= 0 {
+				l.pos += end
+			} else {
+				l.pos = len(l.src)
+			}
+
+		default:
+			return
+		}
+	}
+}
+
+func (l *dslLexer) next() (dslToken, error) {
+	l.skipSpace()
+
+	start := l.pos
+	if start >= len(l.src) {
+		return dslToken{typ: dslEOF, pos: start}, nil
+	}
+
+	c := l.src[start]
+	switch {
+	case c == '"':
+		return l.lexString()
+
+	case c == '-' || (c >= '0' && c <= '9'):
+		return l.lexNumber()
+
+	case strings.IndexByte("{}[]<>(),:=", c) >= 0:
+		l.pos++
+		return dslToken{typ: dslPunct, text: l.src[start:l.pos], pos: start}, nil
+	}
+
+	r, _ := utf8.DecodeRuneInString(l.src[start:])
+	if !dslIsIdentRune(r, true) {
+		return dslToken{}, &dslError{start, fmt.Sprintf("unexpected character %q", r)}
+	}
+
+	for l.pos < len(l.src) {
+		r, n := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !dslIsIdentRune(r, false) {
+			break
+		}
+		l.pos += n
+	}
+
+	return dslToken{typ: dslIdent, text: l.src[start:l.pos], pos: start}, nil
+}
+
+// lexNumber lexes a JSON number.
+func (l *dslLexer) lexNumber() (dslToken, error) {
+	start := l.pos
+	for l.pos < len(l.src) && strings.IndexByte("+-.0123456789eE", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+
+	text := l.src[start:l.pos]
+
+	var f float64
+	if er := json.Unmarshal([]byte(text), &f); er != nil {
+		return dslToken{}, &dslError{start, fmt.Sprintf("invalid number %q", text)}
+	}
+
+	return dslToken{typ: dslNumber, text: text, pos: start, num: f}, nil
+}
+
+// lexString lexes a JSON string.
+func (l *dslLexer) lexString() (dslToken, error) {
+	start := l.pos
+	l.pos++
+
+	for l.pos < len(l.src) && l.src[l.pos] != '"' && l.src[l.pos] != '\n' {
+		if l.src[l.pos] == '\\' {
+			l.pos++
+		}
+		l.pos++
+	}
+
+	if l.pos >= len(l.src) || l.src[l.pos] != '"' {
+		return dslToken{}, &dslError{start, "unterminated string"}
+	}
+	l.pos++
+
+	text := l.src[start:l.pos]
+
+	var s string
+	if er := json.Unmarshal([]byte(text), &s); er != nil {
+		return dslToken{}, &dslError{start, "invalid string " + text}
+	}
+
+	return dslToken{typ: dslString, text: text, pos: start, str: s}, nil
+}
+
+/* Parser */
+
+// dslError is a syntax error at a byte offset, which is turned into a
+// SchemaSyntaxError (with a line and column) by the parser.
+type dslError struct {
+	pos int
+	msg string
+}
+
+func (e *dslError) Error() string {
+	return e.msg
+}
+
+type dslParser struct {
+	lex dslLexer
+	tok dslToken
+
+	// reg is where references are made, or nil if there can't be any.
+	reg *Registry
+
+	// refs and defaults are checked by finish, once every name has been
+	// declared.
+	refs     []dslPending
+	defaults []dslPending
+}
+
+type dslPending struct {
+	pos int
+	ty  *Type
+}
+
+func newDSLParser(src string, reg *Registry) (*dslParser, error) {
+	p := &dslParser{lex: dslLexer{src: src}, reg: reg}
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	return p, nil
+}
+
+func (p *dslParser) errorf(pos int, format string, args ...interface{}) *SchemaSyntaxError {
+	src := p.lex.src[:pos]
+	line := strings.Count(src, "\n") + 1
+	col := pos - strings.LastIndexByte(src, '\n')
+
+	return &SchemaSyntaxError{
+		Line: line,
+		Col:  col,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *dslParser) next() error {
+	tok, er := p.lex.next()
+	if er != nil {
+		e := er.(*dslError)
+		return p.errorf(e.pos, "%s", e.msg)
+	}
+
+	p.tok = tok
+	return nil
+}
+
+// peek returns the token after the current one.
+func (p *dslParser) peek() dslToken {
+	lex := p.lex
+	tok, _ := lex.next()
+	return tok
+}
+
+func (p *dslParser) isPunct(s string) bool {
+	return p.tok.typ == dslPunct && p.tok.text == s
+}
+
+func (p *dslParser) isIdent(s string) bool {
+	return p.tok.typ == dslIdent && p.tok.text == s
+}
+
+func (p *dslParser) expect(punct string) error {
+	if !p.isPunct(punct) {
+		return p.errorf(p.tok.pos, "expected %q, found %s", punct, p.tok)
+	}
+
+	return p.next()
+}
+
+// finish checks the references and defaults found while parsing.
+func (p *dslParser) finish() error {
+	for _, ref := range p.refs {
+		if _, ok := p.reg.Lookup(ref.ty.Ref); !ok {
+			return p.errorf(ref.pos, "undefined type %q", ref.ty.Ref)
+		}
+
+		if ref.ty.deref().Kind == KindRef {
+			return p.errorf(ref.pos, "type %q only refers to itself", ref.ty.Ref)
+		}
+	}
+
+	for _, def := range p.defaults {
+		if !def.ty.IsValid(def.ty.Default) {
+			return p.errorf(def.pos, "invalid default")
+		}
+	}
+
+	return nil
+}
+
+func (p *dslParser) parseType() (*Type, error) {
+	tok := p.tok
+	if tok.typ != dslIdent {
+		return nil, p.errorf(tok.pos, "expected type, found %s", tok)
+	}
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	var ty *Type
+	switch tok.text {
+	case "number":
+		ty = &Type{Kind: KindNumber}
+
+	case "bool":
+		ty = &Type{Kind: KindBool}
+
+	case "any":
+		ty = &Type{Kind: KindAny}
+
+	case "string":
+		ty = &Type{Kind: KindString}
+		if p.isPunct("(") {
+			if er := p.next(); er != nil {
+				return nil, er
+			}
+
+			n, er := p.parseLen()
+			if er != nil {
+				return nil, er
+			}
+			ty.MaxLen = n
+
+			if er := p.expect(")"); er != nil {
+				return nil, er
+			}
+		}
+
+	case "list":
+		if er := p.expect("<"); er != nil {
+			return nil, er
+		}
+
+		elem, er := p.parseType()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expect(">"); er != nil {
+			return nil, er
+		}
+
+		ty = NewListType(elem, 0)
+
+	case "table":
+		var er error
+		if ty, er = p.parseTable(); er != nil {
+			return nil, er
+		}
+
+	default:
+		if p.reg == nil || dslKeywords[tok.text] {
+			return nil, p.errorf(tok.pos, "unknown type %q", tok.text)
+		}
+
+		ty = p.reg.Ref(tok.text)
+		p.refs = append(p.refs, dslPending{tok.pos, ty})
+	}
+
+	if er := p.parseModifiers(ty); er != nil {
+		return nil, er
+	}
+
+	return ty, nil
+}
+
+// parseLen parses a maximum length.
+func (p *dslParser) parseLen() (int, error) {
+	tok := p.tok
+	if tok.typ != dslNumber || tok.num < 1 || tok.num != float64(int(tok.num)) {
+		return 0, p.errorf(tok.pos, "expected a positive integer, found %s", tok)
+	}
+
+	return int(tok.num), p.next()
+}
+
+// parseName parses a field name.
+func (p *dslParser) parseName() (string, error) {
+	tok := p.tok
+	switch tok.typ {
+	case dslIdent:
+		return tok.text, p.next()
+	case dslString:
+		return tok.str, p.next()
+	}
+
+	return "", p.errorf(tok.pos, "expected field name, found %s", tok)
+}
+
+func (p *dslParser) parseTable() (*Type, error) {
+	if er := p.expect("{"); er != nil {
+		return nil, er
+	}
+
+	ty := NewTableType(TableDef{})
+	var required []string
+
+	for !p.isPunct("}") {
+		pos := p.tok.pos
+		name, er := p.parseName()
+		if er != nil {
+			return nil, er
+		}
+
+		if _, ok := ty.Fields[name]; ok {
+			return nil, p.errorf(pos, "duplicate field %q", name)
+		}
+
+		if er := p.expect(":"); er != nil {
+			return nil, er
+		}
+
+		fty, er := p.parseType()
+		if er != nil {
+			return nil, er
+		}
+		ty.Fields[name] = fty
+
+		if p.isIdent("required") {
+			required = append(required, name)
+			if er := p.next(); er != nil {
+				return nil, er
+			}
+		}
+
+		if p.isPunct("}") {
+			break
+		}
+
+		if !p.isPunct(",") {
+			return nil, p.errorf(p.tok.pos, "expected \",\" or \"}\", found %s", p.tok)
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+	}
+
+	if len(required) > 0 {
+		ty.Rules = append(ty.Rules, Required(required...))
+	}
+
+	return ty, p.next()
+}
+
+// dslRules are the Rule constructors which can be used in schemas, by the
+// minimum number of fields they take. required_if is parsed separately.
+var dslRules = map[string]int{
+	"required":           1,
+	"requires":           2,
+	"required_if":        2,
+	"mutually_exclusive": 2,
+	"exactly_one":        1,
+}
+
+func (p *dslParser) parseModifiers(ty *Type) error {
+	// NB: Only indexes and rules can be given more than once.
+	seen := make(map[string]bool)
+
+	for p.tok.typ == dslIdent {
+		tok := p.tok
+		min, isRule := dslRules[tok.text]
+
+		switch {
+		case tok.text == "max", tok.text == "default", tok.text == "defaults":
+			if seen[tok.text] {
+				return p.errorf(tok.pos, "duplicate %s", tok.text)
+			}
+			seen[tok.text] = true
+		case tok.text == "index":
+		case isRule && p.peek().text == "(":
+		default:
+			// Something for the caller (e.g. a field's required).
+			return nil
+		}
+
+		if er := p.next(); er != nil {
+			return er
+		}
+
+		switch tok.text {
+		case "max":
+			if ty.Kind != KindList {
+				return p.errorf(tok.pos, "max only applies to lists")
+			}
+
+			n, er := p.parseLen()
+			if er != nil {
+				return er
+			}
+			ty.MaxLen = n
+
+		case "default":
+			pos := p.tok.pos
+			val, er := p.parseValue()
+			if er != nil {
+				return er
+			}
+			if val == nil {
+				return p.errorf(pos, "null can't be a default")
+			}
+
+			ty.Default = val
+			p.defaults = append(p.defaults, dslPending{pos, ty})
+
+		case "index":
+			idx, er := p.parseIndex()
+			if er != nil {
+				return er
+			}
+			ty.Indexes = append(ty.Indexes, idx)
+
+		case "defaults":
+			if ty.Kind != KindTable {
+				return p.errorf(tok.pos, "defaults only applies to tables")
+			}
+
+			switch {
+			case p.isIdent("materialize"):
+				ty.Defaults = DefaultsMaterialize
+			case p.isIdent("virtual"):
+				ty.Defaults = DefaultsVirtual
+			default:
+				return p.errorf(p.tok.pos, "expected materialize or virtual, found %s", p.tok)
+			}
+
+			if er := p.next(); er != nil {
+				return er
+			}
+
+		default:
+			if ty.Kind != KindTable {
+				return p.errorf(tok.pos, "%s only applies to tables", tok.text)
+			}
+
+			var (
+				rule Rule
+				er   error
+			)
+			if tok.text == "required_if" {
+				rule, er = p.parseRequiredIf(ty)
+			} else {
+				rule, er = p.parseRule(ty, tok.text, min)
+			}
+			if er != nil {
+				return er
+			}
+			ty.Rules = append(ty.Rules, rule)
+		}
+	}
+
+	return nil
+}
+
+func (p *dslParser) parseRule(ty *Type, name string, min int) (Rule, error) {
+	pos := p.tok.pos
+	if er := p.expect("("); er != nil {
+		return Rule{}, er
+	}
+
+	var fields []string
+	for !p.isPunct(")") {
+		fpos := p.tok.pos
+		f, er := p.parseName()
+		if er != nil {
+			return Rule{}, er
+		}
+
+		if _, ok := ty.Fields[f]; !ok {
+			return Rule{}, p.errorf(fpos, "unknown field %q", f)
+		}
+		fields = append(fields, f)
+
+		if p.isPunct(")") {
+			break
+		}
+		if er := p.expect(","); er != nil {
+			return Rule{}, er
+		}
+	}
+
+	if len(fields) < min {
+		return Rule{}, p.errorf(pos, "%s needs at least %d fields", name, min)
+	}
+
+	if er := p.next(); er != nil {
+		return Rule{}, er
+	}
+
+	switch name {
+	case "required":
+		return Required(fields...), nil
+	case "requires":
+		return Requires(fields[0], fields[1:]...), nil
+	case "mutually_exclusive":
+		return MutuallyExclusive(fields...), nil
+	}
+
+	return ExactlyOne(fields...), nil
+}
+
+func (p *dslParser) parseRequiredIf(ty *Type) (Rule, error) {
+	if er := p.expect("("); er != nil {
+		return Rule{}, er
+	}
+
+	var fields [2]string
+	for i := range fields {
+		fpos := p.tok.pos
+		f, er := p.parseName()
+		if er != nil {
+			return Rule{}, er
+		}
+
+		if _, ok := ty.Fields[f]; !ok {
+			return Rule{}, p.errorf(fpos, "unknown field %q", f)
+		}
+		fields[i] = f
+
+		if er := p.expect(","); er != nil {
+			return Rule{}, er
+		}
+	}
+
+	val, er := p.parseValue()
+	if er != nil {
+		return Rule{}, er
+	}
+
+	if er := p.expect(")"); er != nil {
+		return Rule{}, er
+	}
+
+	return RequiredIf(fields[0], fields[1], val), nil
+}
+
+func (p *dslParser) parseIndex() (Index, error) {
+	var idx Index
+	if er := p.expect("("); er != nil {
+		return idx, er
+	}
+
+	method := p.tok
+	found := false
+	for m, s := range indexMethodStrings {
+		if method.typ == dslIdent && `"`+method.text+`"` == s {
+			idx.Method, found = m, true
+		}
+	}
+	if !found {
+		return idx, p.errorf(method.pos, "expected index method, found %s", method)
+	}
+	if er := p.next(); er != nil {
+		return idx, er
+	}
+
+	for !p.isPunct(")") {
+		opt := p.tok
+		if opt.typ != dslIdent {
+			return idx, p.errorf(opt.pos, "expected index option, found %s", opt)
+		}
+		if er := p.next(); er != nil {
+			return idx, er
+		}
+
+		switch opt.text {
+		case "unique":
+			idx.Unique = true
+			continue
+		case "name", "where":
+		default:
+			return idx, p.errorf(opt.pos, "unknown index option %q", opt.text)
+		}
+
+		if p.tok.typ != dslString {
+			return idx, p.errorf(p.tok.pos, "expected string, found %s", p.tok)
+		}
+
+		if opt.text == "name" {
+			idx.Name = p.tok.str
+		} else {
+			idx.Where = p.tok.str
+		}
+
+		if er := p.next(); er != nil {
+			return idx, er
+		}
+	}
+
+	return idx, p.next()
+}
+
+// parseValue parses a JSON value.
+func (p *dslParser) parseValue() (interface{}, error) {
+	tok := p.tok
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	switch tok.typ {
+	case dslNumber:
+		return tok.num, nil
+
+	case dslString:
+		return tok.str, nil
+
+	case dslIdent:
+		switch tok.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+
+	case dslPunct:
+		switch tok.text {
+		case "[":
+			l := []interface{}{}
+			for !p.isPunct("]") {
+				v, er := p.parseValue()
+				if er != nil {
+					return nil, er
+				}
+				l = append(l, v)
+
+				if p.isPunct("]") {
+					break
+				}
+				if er := p.expect(","); er != nil {
+					return nil, er
+				}
+			}
+			return l, p.next()
+
+		case "{":
+			t := map[string]interface{}{}
+			for !p.isPunct("}") {
+				if p.tok.typ != dslString {
+					return nil, p.errorf(p.tok.pos, "expected string, found %s", p.tok)
+				}
+				k := p.tok.str
+				if er := p.next(); er != nil {
+					return nil, er
+				}
+
+				if er := p.expect(":"); er != nil {
+					return nil, er
+				}
+
+				v, er := p.parseValue()
+				if er != nil {
+					return nil, er
+				}
+				t[k] = v
+
+				if p.isPunct("}") {
+					break
+				}
+				if er := p.expect(","); er != nil {
+					return nil, er
+				}
+			}
+			return t, p.next()
+		}
+	}
+
+	return nil, p.errorf(tok.pos, "expected JSON value, found %s", tok)
+}
+
+/* Printer */
+
+// FormatType returns ty in the schema language (see ParseSchema), indented
+// with tabs. References are written by name.
+//
+// NB: DefaultFuncs and Rules made by RuleFunc can't be written down, so
+// they're left out.
+func FormatType(ty *Type) string {
+	var buf bytes.Buffer
+	formatType(&buf, ty, 0)
+	return buf.String()
+}
+
+// FormatRegistry returns the Types in r as a list of declarations (see
+// ParseRegistry), in order of name.
+func FormatRegistry(r *Registry) string {
+	var buf bytes.Buffer
+	for i, name := range r.Names() {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		ty, _ := r.Lookup(name)
+		fmt.Fprintf(&buf, "type %s = ", name)
+		formatType(&buf, ty, 0)
+		buf.WriteString("\n")
+	}
+
+	return buf.String()
+}
+
+// dslJSON returns val as JSON, without the HTML escaping json.Marshal does.
+func dslJSON(val interface{}) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(val)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func dslName(name string) string {
+	if dslIsIdent(name) {
+		return name
+	}
+
+	return dslJSON(name)
+}
+
+func formatType(buf *bytes.Buffer, ty *Type, indent int) {
+	switch ty.Kind {
+	case KindNumber, KindBool, KindAny:
+		buf.WriteString(strings.Trim(kindStrings[ty.Kind], `"`))
+
+	case KindString:
+		buf.WriteString("string")
+		if ty.MaxLen > 0 {
+			fmt.Fprintf(buf, "(%d)", ty.MaxLen)
+		}
+
+	case KindList:
+		buf.WriteString("list<")
+		formatType(buf, ty.ListType, indent)
+		buf.WriteString(">")
+		if ty.MaxLen > 0 {
+			fmt.Fprintf(buf, " max %d", ty.MaxLen)
+		}
+
+	case KindTable:
+		formatTable(buf, ty, indent)
+
+	case KindRef:
+		buf.WriteString(ty.Ref)
+	}
+
+	if ty.Default != nil {
+		buf.WriteString(" default " + dslJSON(ty.Default))
+	}
+
+	for _, idx := range ty.Indexes {
+		buf.WriteString(" index(" + strings.Trim(indexMethodStrings[idx.Method], `"`))
+		if idx.Unique {
+			buf.WriteString(" unique")
+		}
+		if idx.Name != "" {
+			buf.WriteString(" name " + dslJSON(idx.Name))
+		}
+		if idx.Where != "" {
+			buf.WriteString(" where " + dslJSON(idx.Where))
+		}
+		buf.WriteString(")")
+	}
+}
+
+func formatTable(buf *bytes.Buffer, ty *Type, indent int) {
+	// Required fields are marked as such, unless they aren't in Fields.
+	required := make(map[string]bool)
+	var rules []Rule
+	for _, r := range ty.Rules {
+		if r.fields == nil {
+			continue
+		}
+
+		if r.name != "required" {
+			rules = append(rules, r)
+			continue
+		}
+
+		var rest []string
+		for _, f := range r.fields {
+			if _, ok := ty.Fields[f]; ok {
+				required[f] = true
+			} else {
+				rest = append(rest, f)
+			}
+		}
+		if len(rest) > 0 {
+			rules = append(rules, Rule{name: r.name, fields: rest})
+		}
+	}
+
+	if len(ty.Fields) == 0 {
+		buf.WriteString("table {}")
+	} else {
+		buf.WriteString("table {\n")
+		for _, k := range sortedKeys(ty.Fields) {
+			buf.WriteString(strings.Repeat("\t", indent+1) + dslName(k) + ": ")
+			formatType(buf, ty.Fields[k], indent+1)
+			if required[k] {
+				buf.WriteString(" required")
+			}
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(strings.Repeat("\t", indent) + "}")
+	}
+
+	if ty.Defaults == DefaultsMaterialize {
+		buf.WriteString(" defaults materialize")
+	}
+
+	for _, r := range rules {
+		names := make([]string, len(r.fields))
+		for i, f := range r.fields {
+			names[i] = dslName(f)
+		}
+		if r.name == "required_if" {
+			names = append(names, dslJSON(r.value))
+		}
+		fmt.Fprintf(buf, " %s(%s)", r.name, strings.Join(names, ", "))
+	}
+}
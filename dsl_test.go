@@ -0,0 +1,203 @@
+package jsonb
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	ty, er := ParseSchema(`table {
+		id: number required,
+		tags: list<string(32)> max 10, // trailing commas are fine
+		"e-mail": string default "x@y" index(btree unique name "users_email" where "deleted IS NULL"),
+		phone: string,
+		meta: table { seen: bool default false } defaults materialize,
+		extra: any,
+	} exactly_one("e-mail", phone)`)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if ty.Kind != KindTable || len(ty.Fields) != 6 {
+		t.Fatalf("got %#v", ty)
+	}
+
+	tags := ty.Fields["tags"]
+	if tags.Kind != KindList || tags.MaxLen != 10 || tags.ListType.Kind != KindString || tags.ListType.MaxLen != 32 {
+		t.Errorf("got %#v", tags)
+	}
+
+	email := ty.Fields["e-mail"]
+	expectedIdx := []Index{{Method: IndexBTree, Unique: true, Name: "users_email", Where: "deleted IS NULL"}}
+	if email.Default != "x@y" || !reflect.DeepEqual(email.Indexes, expectedIdx) {
+		t.Errorf("got %#v", email)
+	}
+
+	if meta := ty.Fields["meta"]; meta.Defaults != DefaultsMaterialize || meta.Fields["seen"].Default != false {
+		t.Errorf("got %#v", meta)
+	}
+
+	if len(ty.Rules) != 2 || ty.Rules[0].Name() != "required" || ty.Rules[1].Name() != "exactly_one" {
+		t.Errorf("got %v", ty.Rules)
+	}
+
+	valid := map[string]interface{}{"id": float64(1), "phone": "1", "tags": []interface{}{"a"}}
+	if er := ty.Validate(valid); er != nil {
+		t.Error(er)
+	}
+
+	if ty.IsValid(map[string]interface{}{"phone": "1"}) {
+		t.Errorf("id should be required")
+	}
+
+	ty, er = ParseSchema(`table { kind: string, url: string } required_if(url, kind, "link")`)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if ty.IsValid(map[string]interface{}{"kind": "link"}) || !ty.IsValid(map[string]interface{}{"kind": "text"}) {
+		t.Errorf("required_if isn't enforced")
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	tests := []struct {
+		src       string
+		line, col int
+		msg       string
+	}{
+		{``, 1, 1, `expected type, found end of input`},
+		{`nope`, 1, 1, `unknown type "nope"`},
+		{`table {
+	a: number,
+	a: string,
+}`, 3, 2, `duplicate field "a"`},
+		{`table { a: number b: string }`, 1, 19, `expected "," or "}", found "b"`},
+		{`list<number`, 1, 12, `expected ">", found end of input`},
+		{`string(0)`, 1, 8, `expected a positive integer, found "0"`},
+		{`number max 3`, 1, 8, `max only applies to lists`},
+		{"table {\n\ta: number default \"one\",\n}", 2, 20, `invalid default`},
+		{`table { a: number } requires(a, b)`, 1, 33, `unknown field "b"`},
+		{`table { a: number } exactly_one()`, 1, 32, `exactly_one needs at least 1 fields`},
+		{`table { a: number } required_if(a, b, 1)`, 1, 36, `unknown field "b"`},
+		{`table { a: number } required_if(a, a)`, 1, 37, `expected ",", found ")"`},
+		{`any index(hash)`, 1, 11, `expected index method, found "hash"`},
+		{`table { a: "oops }`, 1, 12, `unterminated string`},
+		{`number number`, 1, 8, `unexpected "number" after type`},
+		{`number default 1 default 2`, 1, 18, `duplicate default`},
+		{`list<number> max 1 index(gin) max 2`, 1, 31, `duplicate max`},
+		{`table {} defaults virtual defaults materialize`, 1, 27, `duplicate defaults`},
+		{`table { a: number ~ }`, 1, 19, `unexpected character '~'`},
+	}
+
+	for _, test := range tests {
+		_, er := ParseSchema(test.src)
+
+		var se *SchemaSyntaxError
+		if !errors.As(er, &se) {
+			t.Errorf("%q: got %v", test.src, er)
+			continue
+		}
+
+		if se.Line != test.line || se.Col != test.col || se.Msg != test.msg {
+			t.Errorf("%q: got %d:%d: %s, expected %d:%d: %s", test.src, se.Line, se.Col, se.Msg, test.line, test.col, test.msg)
+		}
+
+		if !errors.Is(er, ErrSchema) {
+			t.Errorf("%q: %v isn't ErrSchema", test.src, er)
+		}
+	}
+}
+
+func TestFormatType(t *testing.T) {
+	ty := NewTableType(TableDef{
+		"id":     TypeNumber,
+		"a b":    NewStringType(8).WithDefault("x<y"),
+		"tags":   NewListType(NewStringType(32), 10),
+		"nested": NewTableType(TableDef{}),
+		"any":    &Type{Kind: KindAny, Indexes: []Index{{Method: IndexGINPathOps}}},
+	}).WithRules(Required("id"), MutuallyExclusive("a b", "tags"), RequiredIf("tags", "id", 1))
+
+	expected := `table {
+	"a b": string(8) default "x<y",
+	any: any index(gin_path_ops),
+	id: number required,
+	nested: table {},
+	tags: list<string(32)> max 10,
+} mutually_exclusive("a b", tags) required_if(tags, id, 1)`
+
+	out := FormatType(ty)
+	if out != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", out, expected)
+	}
+
+	ty2, er := ParseSchema(out)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if out2 := FormatType(ty2); out2 != out {
+		t.Errorf("round trip: got\n%s", out2)
+	}
+}
+
+func TestLoadSchemaFile(t *testing.T) {
+	path := filepath.Join("testdata", "schema", "blog.jsonb")
+	r, er := LoadSchemaFile(path)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(r.Names(), []string{"Comment", "Post", "User"}) {
+		t.Errorf("got %v", r.Names())
+	}
+
+	val := map[string]interface{}{
+		"text": "a",
+		"replies": []interface{}{
+			map[string]interface{}{"text": "b", "author": map[string]interface{}{"name": "ada"}},
+		},
+	}
+	if er := r.Ref("Comment").Validate(val); er != nil {
+		t.Error(er)
+	}
+
+	// The file is formatted, so it should survive a round trip (apart from
+	// its comment).
+	bs, er := ioutil.ReadFile(path)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := string(bs[len("// Types for the blog example.\n\n"):])
+	if out := FormatRegistry(r); out != expected {
+		t.Errorf("got\n%s\nexpected\n%s", out, expected)
+	}
+
+	_, er = LoadSchemaFile(filepath.Join("testdata", "schema", "bad.jsonb"))
+	if er == nil || er.Error() != `jsonb: testdata/schema/bad.jsonb:6:10: undefined type "Usr"` {
+		t.Errorf("got %v", er)
+	}
+}
+
+func TestParseRegistryErrors(t *testing.T) {
+	tests := []struct {
+		src string
+		msg string
+	}{
+		{`type A = number type A = string`, `jsonb: 1:22: "A" is already declared`},
+		{`type list = number`, `jsonb: 1:6: expected type name, found "list"`},
+		{`A = number`, `jsonb: 1:1: expected type declaration, found "A"`},
+		{`type A = B type B = A`, `jsonb: 1:10: type "B" only refers to itself`},
+		{`type A = table { b: B default 1 } type B = string`, `jsonb: 1:31: invalid default`},
+	}
+
+	for _, test := range tests {
+		if _, er := ParseRegistry(test.src); er == nil || er.Error() != test.msg {
+			t.Errorf("%q: got %v, expected %s", test.src, er, test.msg)
+		}
+	}
+}
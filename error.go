@@ -9,6 +9,9 @@ var (
 	// to a kind that isn't in the table.
 	ErrNoSuchKind = errors.New("jsonb: no such kind")
 
+	// ErrNoSuchIndexMethod is the IndexMethod equivalent of ErrNoSuchKind.
+	ErrNoSuchIndexMethod = errors.New("jsonb: no such index method")
+
 	// ErrSchema is returned by operations modifying Table/Lists wherein
 	// the operation is prohibited by the structure's type.
 	ErrSchema = errors.New("jsonb: schema prohibits this operation")
@@ -29,4 +32,53 @@ var (
 	// type constraints don't match the requested type, or the data
 	// is corrupt (e.g. via List.AsUnsafe)).
 	ErrUnexpectedType = errors.New("jsonb: unexpected type")
+
+	// ErrUnknownVersion is returned by Schema when a document's version
+	// field doesn't refer to a registered version.
+	ErrUnknownVersion = errors.New("jsonb: unknown schema version")
+
+	// ErrUnknownJsonbVersion is returned when scanning a value in jsonb's
+	// binary format with a version other than 1.
+	ErrUnknownJsonbVersion = errors.New("jsonb: unknown jsonb binary format version")
+
+	// ErrInvalidPointer is returned when a string isn't a valid RFC 6901
+	// JSON Pointer.
+	ErrInvalidPointer = errors.New("jsonb: invalid json pointer")
+
+	// ErrPatchPath is returned when a JSON Patch operation (or a sub-view)
+	// refers to a path that doesn't exist.
+	ErrPatchPath = errors.New("jsonb: patch path doesn't exist")
+
+	// ErrPatchTest is returned when a JSON Patch test operation fails.
+	ErrPatchTest = errors.New("jsonb: patch test failed")
+
+	// ErrPatchOp is returned for invalid JSON Patch operations.
+	ErrPatchOp = errors.New("jsonb: invalid patch operation")
+
+	// ErrInvalidKey is returned by Repository when a key doesn't match its
+	// key columns (or it has none).
+	ErrInvalidKey = errors.New("jsonb: key doesn't match key columns")
+
+	// ErrConflict is returned when a document can't be written back because
+	// it was changed in the database after it was read.
+	ErrConflict = errors.New("jsonb: concurrent modification")
+
+	// ErrIndexRange is returned when a list index is out of range.
+	ErrIndexRange = errors.New("jsonb: list index out of range")
+
+	// ErrNoHistory is returned by Undo, Redo and RevertTo when there's
+	// nothing to go back (or forward) to.
+	ErrNoHistory = errors.New("jsonb: no history")
+
+	// ErrDuplicateIndex is returned by IndexDDL when two indexes would have
+	// the same name.
+	ErrDuplicateIndex = errors.New("jsonb: duplicate index name")
+
+	// ErrRecursiveType is returned when SQL is needed for a recursive Type
+	// (e.g. by CheckExpr or IndexDDL), which can't be written out.
+	ErrRecursiveType = errors.New("jsonb: recursive type can't be expressed in SQL")
+
+	// ErrUnresolvedRef is returned by Registry.Check when a Type refers to
+	// a name that isn't registered.
+	ErrUnresolvedRef = errors.New("jsonb: unresolved type reference")
 )
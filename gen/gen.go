@@ -0,0 +1,660 @@
+// Package gen generates typed Go wrappers for jsonb Types. For every table
+// Type in a Registry it emits a plain struct (NameData) and a wrapper around
+// jsonb.MutableTable (Name) with a getter, setter, deleter and change check
+// per field; list Types get a wrapper around jsonb.MutableList with typed
+// element access. Setters go through the MutableTable, so they're validated
+// and tracked for partial updates like any other change.
+//
+// `jsonb gen` runs it on schema files. For Types declared in Go, register
+// them in a Registry and call Generate from a program run by go generate,
+// with Config.Registry naming the Registry's variable:
+//
+//	//go:build ignore
+//
+//	package main
+//
+//	func main() {
+//		src, er := gen.Generate(models.Schema, gen.Config{Package: "models", Registry: "Schema"})
+//		if er != nil {
+//			log.Fatal(er)
+//		}
+//
+//		if er := ioutil.WriteFile("models_jsonb.go", src, 0644); er != nil {
+//			log.Fatal(er)
+//		}
+//	}
+//
+// NB: Optional fields are pointers in the structs, except for lists and any
+// fields, so empty lists are left out of SetData like missing ones.
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lye/jsonb"
+)
+
+// Config says how the code is generated.
+type Config struct {
+	// Package is the package name of the generated file.
+	Package string
+
+	// Registry is a Go expression for the *jsonb.Registry holding the
+	// Types at runtime (e.g. "Schema"). If it's empty, the Types are
+	// embedded in the generated file in the schema language instead (see
+	// jsonb.FormatRegistry), which loses any Rules or DefaultFuncs it
+	// can't express.
+	Registry string
+}
+
+// ErrFieldName is returned for fields whose names can't be used in a
+// struct tag.
+var ErrFieldName = errors.New("gen: field name can't be used in a struct tag")
+
+// ErrTypeName is returned when the Go names generated for two Types collide
+// (e.g. "user" and "User", or "Foo" and "FooData").
+var ErrTypeName = errors.New("gen: type names collide")
+
+// ErrEmbed is returned when the Types can't be embedded in the schema
+// language (e.g. a name isn't an identifier); set Config.Registry instead.
+var ErrEmbed = errors.New("gen: types can't be written in the schema language")
+
+// Generate returns the (gofmt'd) source of a Go file with wrappers for the
+// Types in r.
+func Generate(r *jsonb.Registry, cfg Config) ([]byte, error) {
+	if er := r.Check(); er != nil {
+		return nil, er
+	}
+
+	g := &generator{
+		r:     r,
+		seen:  make(map[string]*jsonb.Type),
+		decls: make(map[string]string),
+	}
+
+	for _, name := range r.Names() {
+		ty, _ := r.Lookup(name)
+		gname := goName(name)
+
+		for _, id := range g.declNames(name) {
+			if other, ok := g.decls[id]; ok {
+				return nil, fmt.Errorf("%w: %q and %q", ErrTypeName, other, name)
+			}
+			g.decls[id] = name
+		}
+		g.seen[gname] = ty
+	}
+
+	fmt.Fprintf(&g.buf, "// Code generated by jsonb gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&g.buf, "package %s\n\n", cfg.Package)
+	fmt.Fprintf(&g.buf, "import (\n\t\"encoding/json\"\n\n\t\"github.com/lye/jsonb\"\n)\n\n")
+
+	if cfg.Registry != "" {
+		fmt.Fprintf(&g.buf, "// jsonbTypes holds the Types of the wrappers in this file.\n")
+		fmt.Fprintf(&g.buf, "var jsonbTypes *jsonb.Registry = %s\n\n", cfg.Registry)
+	} else {
+		// NB: Make sure the generated code won't panic when it starts.
+		src := jsonb.FormatRegistry(r)
+		if _, er := jsonb.ParseRegistry(src); er != nil {
+			return nil, fmt.Errorf("%w: %v", ErrEmbed, er)
+		}
+
+		fmt.Fprintf(&g.buf, "// jsonbTypes holds the Types of the wrappers in this file.\n")
+		fmt.Fprintf(&g.buf, "var jsonbTypes = func() *jsonb.Registry {\n")
+		fmt.Fprintf(&g.buf, "\tr, er := jsonb.ParseRegistry(%s)\n", goString(src))
+		fmt.Fprintf(&g.buf, "\tif er != nil {\n\t\tpanic(er)\n\t}\n\treturn r\n}()\n\n")
+	}
+
+	for _, name := range r.Names() {
+		if er := g.named(name); er != nil {
+			return nil, er
+		}
+	}
+
+	for len(g.queue) > 0 {
+		t := g.queue[0]
+		g.queue = g.queue[1:]
+
+		if er := g.table(t.name, "", t.ty, t.wrap); er != nil {
+			return nil, er
+		}
+	}
+
+	g.buf.WriteString(helpers)
+	return format.Source(g.buf.Bytes())
+}
+
+// goString returns s as a Go string literal, preferring raw strings.
+func goString(s string) string {
+	if strings.Contains(s, "`") {
+		return strconv.Quote(s)
+	}
+
+	return "`" + s + "`"
+}
+
+var initialisms = map[string]bool{
+	"API":  true,
+	"HTTP": true,
+	"ID":   true,
+	"JSON": true,
+	"SQL":  true,
+	"URL":  true,
+	"UUID": true,
+}
+
+// goName returns an exported Go identifier for a field or type name, e.g.
+// "created_at" becomes "CreatedAt".
+func goName(s string) string {
+	var buf strings.Builder
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, part := range parts {
+		if up := strings.ToUpper(part); initialisms[up] {
+			buf.WriteString(up)
+			continue
+		}
+
+		r, n := utf8.DecodeRuneInString(part)
+		buf.WriteRune(unicode.ToUpper(r))
+		buf.WriteString(part[n:])
+	}
+
+	name := buf.String()
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// reserved holds the method names wrappers get from jsonb, which fields'
+// methods mustn't shadow.
+var reserved = func() map[string]bool {
+	names := map[string]bool{
+		"MutableTable": true,
+		"MutableList":  true,
+		"Type":         true,
+		"Data":         true,
+		"SetData":      true,
+	}
+
+	for _, v := range []interface{}{&jsonb.MutableTable{}, &jsonb.MutableList{}} {
+		ty := reflect.TypeOf(v)
+		for i := 0; i < ty.NumMethod(); i++ {
+			names[ty.Method(i).Name] = true
+		}
+	}
+
+	return names
+}()
+
+type generator struct {
+	r   *jsonb.Registry
+	buf bytes.Buffer
+
+	// queue holds inline tables which need wrappers, and seen the names
+	// which have been taken (and by which Types). decls holds every
+	// identifier declared for the Types in the Registry, by name.
+	queue []queued
+	seen  map[string]*jsonb.Type
+	decls map[string]string
+}
+
+type queued struct {
+	name string
+	ty   *jsonb.Type
+	wrap bool
+}
+
+// lookup follows references from name to a Type which isn't one, returning
+// the last name on the way.
+func (g *generator) lookup(name string) (string, *jsonb.Type) {
+	for {
+		ty, _ := g.r.Lookup(name)
+		if ty.Kind != jsonb.KindRef {
+			return name, ty
+		}
+		name = ty.Ref
+	}
+}
+
+// resolve returns the Type ty refers to, along with the Go name of the
+// wrapper for it if it's a named table or list.
+func (g *generator) resolve(ty *jsonb.Type) (*jsonb.Type, string) {
+	if ty.Kind != jsonb.KindRef {
+		return ty, ""
+	}
+
+	name, ty := g.lookup(ty.Ref)
+	if ty.Kind == jsonb.KindTable || ty.Kind == jsonb.KindList {
+		return ty, goName(name)
+	}
+
+	return ty, ""
+}
+
+// declNames returns the package-level identifiers declared for the Type
+// called name (see named).
+func (g *generator) declNames(name string) []string {
+	ty, _ := g.r.Lookup(name)
+	gname := goName(name)
+
+	switch ty.Kind {
+	case jsonb.KindTable, jsonb.KindList:
+		return []string{gname, gname + "Data", "New" + gname, "As" + gname, "jsonbType" + gname}
+
+	case jsonb.KindRef:
+		if _, tname := g.resolve(ty); tname != "" && tname != gname {
+			return []string{gname, gname + "Data"}
+		}
+	}
+
+	return nil
+}
+
+// goType returns the Go type for values of ty, queueing a struct named ctx
+// if it's an inline table (and a wrapper, if wrap is set; tables in lists
+// can't have views, so they don't need them).
+func (g *generator) goType(ty *jsonb.Type, ctx string, wrap bool) string {
+	ty, named := g.resolve(ty)
+	if named != "" {
+		return named + "Data"
+	}
+
+	switch ty.Kind {
+	case jsonb.KindTable:
+		for g.seen[ctx] != ty && (g.seen[ctx] != nil || g.decls[ctx] != "" || g.decls[ctx+"Data"] != "") {
+			ctx += "X"
+		}
+		if g.seen[ctx] == nil {
+			g.seen[ctx] = ty
+			g.queue = append(g.queue, queued{ctx, ty, wrap})
+		}
+		return ctx + "Data"
+
+	case jsonb.KindList:
+		return "[]" + g.goType(ty.ListType, ctx+"Item", false)
+
+	case jsonb.KindNumber:
+		return "float64"
+
+	case jsonb.KindString:
+		return "string"
+
+	case jsonb.KindBool:
+		return "bool"
+	}
+
+	return "interface{}"
+}
+
+func (g *generator) named(name string) error {
+	ty, _ := g.r.Lookup(name)
+	gname := goName(name)
+
+	if ty.Kind == jsonb.KindRef {
+		// Other names for tables and lists get aliases.
+		if _, tname := g.resolve(ty); tname != "" && tname != gname {
+			fmt.Fprintf(&g.buf, "// %s is the same as %s.\ntype %s = %s\n\n", gname, tname, gname, tname)
+			fmt.Fprintf(&g.buf, "type %sData = %sData\n\n", gname, tname)
+		}
+		return nil
+	}
+
+	switch ty.Kind {
+	case jsonb.KindTable:
+		return g.table(gname, name, ty, true)
+
+	case jsonb.KindList:
+		g.list(gname, name, ty)
+	}
+
+	// Named primitives are used as they are.
+	return nil
+}
+
+// typeVar declares the variable holding the named Type, and the methods
+// using it.
+func (g *generator) typeVar(gname, name, kind string) {
+	fmt.Fprintf(&g.buf, "var jsonbType%s = jsonbTypes.Ref(%s)\n\n", gname, strconv.Quote(name))
+
+	fmt.Fprintf(&g.buf, "// New%s returns a new, empty %s.\n", gname, gname)
+	fmt.Fprintf(&g.buf, "func New%s() %s {\n\treturn %s{jsonb.New%s(jsonbType%s)}\n}\n\n", gname, gname, gname, kind, gname)
+
+	v := map[string]string{"Table": "t", "List": "l"}[kind]
+	fmt.Fprintf(&g.buf, "// As%s returns %s as a %s, or jsonb.ErrSchema if it isn't one.\n", gname, v, gname)
+	fmt.Fprintf(&g.buf, "func As%s(%s *jsonb.%s) (%s, error) {\n", gname, v, kind, gname)
+	fmt.Fprintf(&g.buf, "\tm, er := %s.As(jsonbType%s)\n\treturn %s{m}, er\n}\n\n", v, gname, gname)
+
+	fmt.Fprintf(&g.buf, "// Type returns the Type of %s.\n", gname)
+	fmt.Fprintf(&g.buf, "func (%s) Type() *jsonb.Type {\n\treturn jsonbType%s\n}\n\n", gname, gname)
+}
+
+type field struct {
+	key  string
+	name string
+
+	// ty is the resolved Type, goType the Go type of its values and
+	// wrapper the wrapper for views of it (tables only).
+	ty      *jsonb.Type
+	goType  string
+	wrapper string
+
+	// elem is the Go type of list elements.
+	elem string
+}
+
+// methods returns the names of the methods the wrapper has for f.
+func (f *field) methods(base string) []string {
+	names := []string{base, "Set" + base, "Delete" + base, base + "Changed"}
+
+	switch f.ty.Kind {
+	case jsonb.KindTable:
+		names = append(names, base+"View")
+	case jsonb.KindList:
+		names = append(names, "Append"+base)
+	}
+
+	return names
+}
+
+// fields works out the Go side of ty's fields, naming them so that none of
+// their methods collide.
+func (g *generator) fields(gname string, ty *jsonb.Type, wrap bool) ([]*field, error) {
+	used := make(map[string]bool)
+	for k := range reserved {
+		used[k] = true
+	}
+
+	keys := make([]string, 0, len(ty.Fields))
+	for k := range ty.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var fields []*field
+	for _, k := range keys {
+		if strings.ContainsAny(k, "\"`,\\") {
+			return nil, fmt.Errorf("%w: %q", ErrFieldName, k)
+		}
+
+		base := goName(k)
+		f := &field{key: k}
+		f.ty, f.wrapper = g.resolve(ty.Fields[k])
+		f.goType = g.goType(ty.Fields[k], gname+base, wrap)
+
+		switch f.ty.Kind {
+		case jsonb.KindTable:
+			if f.wrapper == "" {
+				f.wrapper = strings.TrimSuffix(f.goType, "Data")
+			}
+		case jsonb.KindList:
+			prefix := gname + base
+			if f.wrapper != "" {
+				prefix = f.wrapper
+			}
+			f.elem = g.goType(f.ty.ListType, prefix+"Item", false)
+		}
+
+		for i := 1; ; i++ {
+			f.name = base
+			if i > 1 {
+				f.name += "Field"
+			}
+			if i > 2 {
+				f.name += strconv.Itoa(i - 1)
+			}
+
+			ok := true
+			for _, m := range f.methods(f.name) {
+				ok = ok && !used[m]
+			}
+			if ok {
+				break
+			}
+		}
+
+		for _, m := range f.methods(f.name) {
+			used[m] = true
+		}
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+// pointer returns true if f is a pointer in the Data struct.
+func (f *field) pointer() bool {
+	switch f.ty.Kind {
+	case jsonb.KindList, jsonb.KindAny:
+		return false
+	}
+
+	return true
+}
+
+// table emits the Data struct and (if wrap is set) the wrapper for a table
+// Type. name is the Type's name in the Registry, or "" if it's inline.
+func (g *generator) table(gname, name string, ty *jsonb.Type, wrap bool) error {
+	fields, er := g.fields(gname, ty, wrap)
+	if er != nil {
+		return er
+	}
+
+	b := &g.buf
+
+	fmt.Fprintf(b, "// %sData is the plain Go form of %s.\n", gname, gname)
+	fmt.Fprintf(b, "type %sData struct {\n", gname)
+	for _, f := range fields {
+		typ := f.goType
+		if f.pointer() {
+			typ = "*" + typ
+		}
+		fmt.Fprintf(b, "\t%s %s `json:\"%s,omitempty\"`\n", f.name, typ, f.key)
+	}
+	fmt.Fprintf(b, "}\n\n")
+
+	if !wrap {
+		return nil
+	}
+
+	fmt.Fprintf(b, "// %s is a typed wrapper around a jsonb.MutableTable.\n", gname)
+	fmt.Fprintf(b, "type %s struct {\n\t*jsonb.MutableTable\n}\n\n", gname)
+
+	if name != "" {
+		g.typeVar(gname, name, "Table")
+	}
+
+	fmt.Fprintf(b, "// Data returns the document (with defaults) as a %sData.\n", gname)
+	fmt.Fprintf(b, "func (w %s) Data() %sData {\n\tvar out %sData\n", gname, gname, gname)
+	for _, f := range fields {
+		if f.pointer() {
+			fmt.Fprintf(b, "\tif v, ok := w.%s(); ok {\n\t\tout.%s = &v\n\t}\n", f.name, f.name)
+		} else {
+			fmt.Fprintf(b, "\tif v, ok := w.%s(); ok {\n\t\tout.%s = v\n\t}\n", f.name, f.name)
+		}
+	}
+	fmt.Fprintf(b, "\treturn out\n}\n\n")
+
+	fmt.Fprintf(b, "// SetData sets the fields which are set in d, in one change.\n")
+	fmt.Fprintf(b, "func (w %s) SetData(d %sData) error {\n\tb := w.Batch()\n", gname, gname)
+	for _, f := range fields {
+		val := "d." + f.name
+		if f.pointer() {
+			val = "*" + val
+		}
+
+		fmt.Fprintf(b, "\tif d.%s != nil {\n", f.name)
+		if g.converted(f.ty) {
+			fmt.Fprintf(b, "\t\tval, er := jsonbValue(%s)\n\t\tif er != nil {\n\t\t\treturn er\n\t\t}\n", val)
+			fmt.Fprintf(b, "\t\tb.Set(%s, val)\n", strconv.Quote(f.key))
+		} else {
+			fmt.Fprintf(b, "\t\tb.Set(%s, %s)\n", strconv.Quote(f.key), val)
+		}
+		fmt.Fprintf(b, "\t}\n")
+	}
+	fmt.Fprintf(b, "\treturn b.Commit()\n}\n\n")
+
+	for _, f := range fields {
+		g.tableField(gname, f)
+	}
+
+	return nil
+}
+
+// converted returns true if values of ty have to be converted between
+// their Go and decoded JSON forms.
+func (g *generator) converted(ty *jsonb.Type) bool {
+	switch ty.Kind {
+	case jsonb.KindString, jsonb.KindBool, jsonb.KindAny:
+		return false
+	}
+
+	return true
+}
+
+// getter emits code setting v (of type typ) and ok from val, and returning
+// them.
+func (g *generator) getter(ty *jsonb.Type, typ string) {
+	b := &g.buf
+	switch ty.Kind {
+	case jsonb.KindAny:
+		fmt.Fprintf(b, "\treturn val, ok\n")
+
+	case jsonb.KindString, jsonb.KindBool:
+		fmt.Fprintf(b, "\tv, ok2 := val.(%s)\n\treturn v, ok && ok2\n", typ)
+
+	default:
+		fmt.Fprintf(b, "\tvar v %s\n", typ)
+		fmt.Fprintf(b, "\tif !ok || jsonbConvert(val, &v) != nil {\n\t\treturn v, false\n\t}\n\treturn v, true\n")
+	}
+}
+
+// setter emits code calling call (a format taking the value) with v.
+func (g *generator) setter(ty *jsonb.Type, call string) {
+	b := &g.buf
+	if !g.converted(ty) {
+		fmt.Fprintf(b, "\treturn "+call+"\n", "v")
+		return
+	}
+
+	fmt.Fprintf(b, "\tval, er := jsonbValue(v)\n\tif er != nil {\n\t\treturn er\n\t}\n")
+	fmt.Fprintf(b, "\treturn "+call+"\n", "val")
+}
+
+func (g *generator) tableField(gname string, f *field) {
+	b := &g.buf
+	key := strconv.Quote(f.key)
+
+	fmt.Fprintf(b, "// %s returns %s (or its default), and whether it has a value.\n", f.name, f.key)
+	fmt.Fprintf(b, "func (w %s) %s() (%s, bool) {\n\tval, ok := w.Get(%s)\n", gname, f.name, f.goType, key)
+	g.getter(f.ty, f.goType)
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Set%s sets %s.\n", f.name, f.key)
+	fmt.Fprintf(b, "func (w %s) Set%s(v %s) error {\n", gname, f.name, f.goType)
+	g.setter(f.ty, "w.Set("+key+", %s)")
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Delete%s removes %s.\n", f.name, f.key)
+	fmt.Fprintf(b, "func (w %s) Delete%s() error {\n\treturn w.Delete(%s)\n}\n\n", gname, f.name, key)
+
+	fmt.Fprintf(b, "// %sChanged returns true if %s has changed since the document was read.\n", f.name, f.key)
+	fmt.Fprintf(b, "func (w %s) %sChanged() bool {\n\treturn w.Changed(%s)\n}\n\n", gname, f.name, key)
+
+	switch f.ty.Kind {
+	case jsonb.KindTable:
+		fmt.Fprintf(b, "// %sView returns a view of %s for changing it in place. If it isn't set,\n", f.name, f.key)
+		fmt.Fprintf(b, "// it's created by the view's first change.\n")
+		fmt.Fprintf(b, "func (w %s) %sView() (%s, error) {\n", gname, f.name, f.wrapper)
+		fmt.Fprintf(b, "\tmt, er := w.Sub(%s)\n\treturn %s{mt}, er\n}\n\n", key, f.wrapper)
+
+	case jsonb.KindList:
+		// NB: v is converted before anything else, so that a failed
+		// conversion doesn't leave anything behind and the append is a
+		// single change (which sets the list if it isn't set).
+		fmt.Fprintf(b, "// Append%s appends v to %s, setting it to a list of just v if it isn't\n", f.name, f.key)
+		fmt.Fprintf(b, "// set.\n")
+		fmt.Fprintf(b, "func (w %s) Append%s(v %s) error {\n", gname, f.name, f.elem)
+
+		val := "v"
+		if elem, _ := g.resolve(f.ty.ListType); g.converted(elem) {
+			fmt.Fprintf(b, "\tval, er := jsonbValue(v)\n\tif er != nil {\n\t\treturn er\n\t}\n")
+			fmt.Fprintf(b, "\tl, er := w.SubList(%s)\n", key)
+			val = "val"
+		} else {
+			fmt.Fprintf(b, "\tl, er := w.SubList(%s)\n", key)
+		}
+
+		fmt.Fprintf(b, "\tif er != nil {\n\t\treturn er\n\t}\n\treturn l.Append(%s)\n}\n\n", val)
+	}
+}
+
+// list emits the Data type and wrapper for a named list Type.
+func (g *generator) list(gname, name string, ty *jsonb.Type) {
+	b := &g.buf
+	elem := g.goType(ty.ListType, gname+"Item", false)
+	ety, _ := g.resolve(ty.ListType)
+
+	fmt.Fprintf(b, "// %sData is the plain Go form of %s.\n", gname, gname)
+	fmt.Fprintf(b, "type %sData []%s\n\n", gname, elem)
+
+	fmt.Fprintf(b, "// %s is a typed wrapper around a jsonb.MutableList.\n", gname)
+	fmt.Fprintf(b, "type %s struct {\n\t*jsonb.MutableList\n}\n\n", gname)
+
+	g.typeVar(gname, name, "List")
+
+	fmt.Fprintf(b, "// Data returns the list as a %sData.\n", gname)
+	fmt.Fprintf(b, "func (w %s) Data() %sData {\n\tvar out %sData\n", gname, gname, gname)
+	fmt.Fprintf(b, "\tjsonbConvert(w.Values(), &out)\n\treturn out\n}\n\n")
+
+	fmt.Fprintf(b, "// Len returns the length of the list.\n")
+	fmt.Fprintf(b, "func (w %s) Len() int {\n\treturn len(w.Values())\n}\n\n", gname)
+
+	fmt.Fprintf(b, "// At returns the element at i, and whether there is one.\n")
+	fmt.Fprintf(b, "func (w %s) At(i int) (%s, bool) {\n\tvals := w.Values()\n", gname, elem)
+	fmt.Fprintf(b, "\tok := i >= 0 && i < len(vals)\n\tvar val interface{}\n\tif ok {\n\t\tval = vals[i]\n\t}\n")
+	g.getter(ety, elem)
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Append appends v to the list.\n")
+	fmt.Fprintf(b, "func (w %s) Append(v %s) error {\n", gname, elem)
+	g.setter(ety, "w.MutableList.Append(%s)")
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Set replaces the element at i with v.\n")
+	fmt.Fprintf(b, "func (w %s) Set(i int, v %s) error {\n", gname, elem)
+	g.setter(ety, "w.MutableList.Set(i, %s)")
+	fmt.Fprintf(b, "}\n\n")
+}
+
+const helpers = `// jsonbConvert converts between Go values and decoded JSON via
+// encoding/json.
+func jsonbConvert(from, to interface{}) error {
+	bs, er := json.Marshal(from)
+	if er != nil {
+		return er
+	}
+
+	return json.Unmarshal(bs, to)
+}
+
+// jsonbValue returns v as decoded JSON.
+func jsonbValue(v interface{}) (interface{}, error) {
+	var val interface{}
+	er := jsonbConvert(v, &val)
+	return val, er
+}
+`
@@ -0,0 +1,196 @@
+package gen
+
+import (
+	"errors"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lye/jsonb"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// testGolden compares out against testdata/name, or rewrites the file if
+// -update was given.
+func testGolden(t *testing.T, name, out string) {
+	path := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		if er := ioutil.WriteFile(path, []byte(out), 0644); er != nil {
+			t.Fatal(er)
+		}
+		return
+	}
+
+	bs, er := ioutil.ReadFile(path)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if string(bs) != out {
+		t.Errorf("%s differs, got\n%s", path, out)
+	}
+}
+
+// testTypeCheck parses and type-checks src, along with any other files of
+// its package in extra, against the jsonb package's source. It fails the
+// test if they don't compile.
+func testTypeCheck(t *testing.T, src []byte, extra ...string) {
+	fset := token.NewFileSet()
+	f, er := parser.ParseFile(fset, "gen.go", src, 0)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	files := []*ast.File{f}
+	for _, e := range extra {
+		f, er := parser.ParseFile(fset, "extra.go", e, 0)
+		if er != nil {
+			t.Fatal(er)
+		}
+		files = append(files, f)
+	}
+
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, er := conf.Check(f.Name.Name, fset, files, nil); er != nil {
+		t.Error(er)
+	}
+}
+
+func TestGenerateSchemaFile(t *testing.T) {
+	r, er := jsonb.LoadSchemaFile(filepath.Join("..", "testdata", "schema", "blog.jsonb"))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	src, er := Generate(r, Config{Package: "blog"})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testGolden(t, "blog.go.golden", string(src))
+	testTypeCheck(t, src)
+}
+
+func TestGenerateGoTypes(t *testing.T) {
+	r := jsonb.NewRegistry()
+	r.Register("order", jsonb.NewTableType(jsonb.TableDef{
+		"id":      jsonb.TypeNumber,
+		"set":     jsonb.TypeBool,
+		"data":    jsonb.TypeAny,
+		"lines":   r.Ref("lines"),
+		"address": jsonb.NewTableType(jsonb.TableDef{"city": jsonb.TypeString}),
+	}))
+	r.Register("lines", jsonb.NewListType(jsonb.NewTableType(jsonb.TableDef{
+		"sku": jsonb.TypeString,
+		"qty": jsonb.TypeNumber,
+	}), -1))
+	r.Register("Purchase", r.Ref("order"))
+
+	src, er := Generate(r, Config{Package: "shop", Registry: "Types"})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testGolden(t, "shop.go.golden", string(src))
+
+	// NB: The Registry is the caller's, so it's declared separately.
+	testTypeCheck(t, src, `package shop
+
+import "github.com/lye/jsonb"
+
+var Types *jsonb.Registry`)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	r := jsonb.NewRegistry()
+	r.Register("A", r.Ref("B"))
+	if _, er := Generate(r, Config{Package: "x"}); er != jsonb.ErrUnresolvedRef {
+		t.Errorf("got %v, expected ErrUnresolvedRef", er)
+	}
+
+	r = jsonb.NewRegistry()
+	r.Register("A", jsonb.NewTableType(jsonb.TableDef{`a"b`: jsonb.TypeAny}))
+	if _, er := Generate(r, Config{Package: "x"}); !errors.Is(er, ErrFieldName) {
+		t.Errorf("got %v, expected ErrFieldName", er)
+	}
+
+	collisions := [][]string{
+		{"user", "User"},
+		{"Foo", "FooData"},
+		{"Foo", "NewFoo"},
+	}
+	for _, names := range collisions {
+		r = jsonb.NewRegistry()
+		for _, name := range names {
+			r.Register(name, jsonb.NewTableType(jsonb.TableDef{}))
+		}
+
+		if _, er := Generate(r, Config{Package: "x", Registry: "R"}); !errors.Is(er, ErrTypeName) {
+			t.Errorf("%v: got %v, expected ErrTypeName", names, er)
+		}
+	}
+
+	// Embedding the Types in the generated code needs names the schema
+	// language can read back.
+	r = jsonb.NewRegistry()
+	r.Register("my type", jsonb.NewTableType(jsonb.TableDef{}))
+	if _, er := Generate(r, Config{Package: "x"}); !errors.Is(er, ErrEmbed) {
+		t.Errorf("got %v, expected ErrEmbed", er)
+	}
+	if _, er := Generate(r, Config{Package: "x", Registry: "R"}); er != nil {
+		t.Error(er)
+	}
+
+	// Names that only refer to the same Type, or to primitives, are fine.
+	r = jsonb.NewRegistry()
+	r.Register("User", jsonb.NewTableType(jsonb.TableDef{}))
+	r.Register("user", r.Ref("User"))
+	r.Register("FooData", jsonb.TypeString)
+	r.Register("Foo", jsonb.NewTableType(jsonb.TableDef{}))
+	if _, er := Generate(r, Config{Package: "x", Registry: "R"}); er != nil {
+		t.Error(er)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"name":       "Name",
+		"created_at": "CreatedAt",
+		"userId":     "UserId",
+		"user_id":    "UserID",
+		"e-mail":     "EMail",
+		"2fa":        "X2fa",
+		"":           "X",
+	}
+
+	for in, expected := range tests {
+		if out := goName(in); out != expected {
+			t.Errorf("%q: got %q, expected %q", in, out, expected)
+		}
+	}
+}
+
+func TestGenerateEmbedsSchema(t *testing.T) {
+	r, er := jsonb.ParseRegistry("type T = table { a: string index(btree where \"x = `y`\") }")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	src, er := Generate(r, Config{Package: "x"})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !strings.Contains(string(src), `jsonb.ParseRegistry("type T = table {\n\ta: string index(btree where \"x = `+"`y`"+`\"),\n}\n")`) {
+		t.Errorf("got\n%s", src)
+	}
+}
@@ -0,0 +1,330 @@
+package jsonb
+
+// Checkpoint is a position in a MutableTable's or MutableList's history,
+// which can be returned to with RevertTo.
+type Checkpoint int
+
+// history is an undo/redo log. Each entry knows how to undo and redo a
+// single change.
+type history struct {
+	entries []histEntry
+
+	// entries[:pos] have been applied. base is the number of entries that
+	// have been dropped from the front (to stay within limit), so base+pos
+	// is the absolute position used by Checkpoints.
+	pos   int
+	base  int
+	limit int
+
+	// clean is the absolute position at which the value matched the
+	// database, or -1 if that isn't in the history (any more).
+	clean int
+}
+
+type histEntry struct {
+	undo, redo func() error
+}
+
+func newHistory(limit int, dirty bool) *history {
+	h := &history{limit: limit}
+	if dirty {
+		h.clean = -1
+	}
+	return h
+}
+
+func (h *history) abs() int {
+	return h.base + h.pos
+}
+
+func (h *history) push(e histEntry) {
+	// A new change makes anything that was undone unreachable.
+	if h.clean > h.abs() {
+		h.clean = -1
+	}
+	h.entries = append(h.entries[:h.pos], e)
+	h.pos++
+
+	if h.limit > 0 && len(h.entries) > h.limit {
+		n := len(h.entries) - h.limit
+		h.entries = append([]histEntry(nil), h.entries[n:]...)
+		h.base += n
+		h.pos -= n
+	}
+}
+
+func (h *history) markClean() {
+	if h != nil {
+		h.clean = h.abs()
+	}
+}
+
+// reset forgets the history (when the value is replaced wholesale, e.g. by
+// Scan). Existing Checkpoints are invalidated.
+func (h *history) reset() {
+	if h != nil {
+		h.base += len(h.entries) + 1
+		h.entries = nil
+		h.pos = 0
+		h.clean = h.base
+	}
+}
+
+// step undoes or redoes one entry, and returns true if the value is back to
+// its clean state.
+func (h *history) step(undo bool) (clean bool, er error) {
+	if h == nil {
+		return false, ErrNoHistory
+	}
+
+	if undo {
+		if h.pos == 0 {
+			return false, ErrNoHistory
+		}
+		if er := h.entries[h.pos-1].undo(); er != nil {
+			return false, er
+		}
+		h.pos--
+	} else {
+		if h.pos == len(h.entries) {
+			return false, ErrNoHistory
+		}
+		if er := h.entries[h.pos].redo(); er != nil {
+			return false, er
+		}
+		h.pos++
+	}
+
+	return h.abs() == h.clean, nil
+}
+
+func (h *history) checkpoint() Checkpoint {
+	if h == nil {
+		return 0
+	}
+
+	return Checkpoint(h.abs())
+}
+
+// revertTo steps through the history until cp, calling done after each
+// step.
+func (h *history) revertTo(cp Checkpoint, done func(clean bool)) error {
+	if h == nil || int(cp) < h.base || int(cp) > h.base+len(h.entries) {
+		return ErrNoHistory
+	}
+
+	for h.abs() != int(cp) {
+		clean, er := h.step(int(cp) < h.abs())
+		if er != nil {
+			return er
+		}
+		done(clean)
+	}
+
+	return nil
+}
+
+// EnableHistory starts recording the MutableTable's changes so they can be
+// undone and redone. At most limit changes are kept (or all of them if
+// limit is 0 or less). Calling EnableHistory again clears the history.
+func (mt *MutableTable) EnableHistory(limit int) {
+	mt.hist = newHistory(limit, mt.dirty)
+}
+
+// DisableHistory stops recording changes and forgets the history.
+func (mt *MutableTable) DisableHistory() {
+	mt.hist = nil
+}
+
+// Undo reverts the last change (which may be a whole batch or patch). It
+// returns ErrNoHistory if there's nothing to undo or history isn't enabled,
+// or the error from a BeforeChange hook vetoing the change.
+func (mt *MutableTable) Undo() error {
+	clean, er := mt.hist.step(true)
+	mt.histDone(clean)
+	return er
+}
+
+// Redo reapplies the last change that was undone. It returns ErrNoHistory
+// if there's nothing to redo.
+func (mt *MutableTable) Redo() error {
+	clean, er := mt.hist.step(false)
+	mt.histDone(clean)
+	return er
+}
+
+// Checkpoint returns the current position in the history.
+func (mt *MutableTable) Checkpoint() Checkpoint {
+	return mt.hist.checkpoint()
+}
+
+// RevertTo undoes (or redoes) changes until the MutableTable is back at cp.
+// It returns ErrNoHistory if cp is no longer in the history.
+func (mt *MutableTable) RevertTo(cp Checkpoint) error {
+	return mt.hist.revertTo(cp, mt.histDone)
+}
+
+func (mt *MutableTable) histDone(clean bool) {
+	if clean {
+		mt.MarkClean()
+	}
+}
+
+// record adds a history entry for a change to the given top-level keys,
+// where old is the document before the change and the Table's decoded value
+// is the document after it.
+func (t *Table) record(old map[string]interface{}, keys []string) {
+	if t.hist == nil || len(keys) == 0 {
+		return
+	}
+
+	type change struct {
+		key            string
+		old, new       interface{}
+		hadOld, hasNew bool
+	}
+
+	changes := make([]change, len(keys))
+	for i, k := range keys {
+		c := change{key: k}
+		c.old, c.hadOld = old[k]
+		c.new, c.hasNew = t.decoded[k]
+		c.old, c.new = deepCopy(c.old), deepCopy(c.new)
+		changes[i] = c
+	}
+
+	apply := func(undo bool) error {
+		dec, er := t.decode()
+		if er != nil {
+			return er
+		}
+
+		evs := make([]ChangeEvent, len(changes))
+		for i, c := range changes {
+			if undo {
+				evs[i] = keyEvent(pointerAppend("", c.key), dec[c.key], c.hasNew, c.old, c.hadOld)
+			} else {
+				evs[i] = keyEvent(pointerAppend("", c.key), dec[c.key], c.hadOld, c.new, c.hasNew)
+			}
+		}
+
+		if er := t.obs.before(evs); er != nil {
+			return er
+		}
+
+		for i, ev := range evs {
+			key := changes[i].key
+			if ev.Op == ChangeRemove {
+				delete(dec, key)
+			} else {
+				dec[key] = deepCopy(ev.New)
+			}
+			t.markChanged(ev.Path, ev.Op == ChangeRemove)
+		}
+
+		t.obs.after(evs)
+		return nil
+	}
+
+	t.hist.push(histEntry{
+		undo: func() error { return apply(true) },
+		redo: func() error { return apply(false) },
+	})
+}
+
+// EnableHistory starts recording the MutableList's changes (see
+// MutableTable.EnableHistory).
+func (ml *MutableList) EnableHistory(limit int) {
+	ml.hist = newHistory(limit, ml.dirty)
+}
+
+// DisableHistory stops recording changes and forgets the history.
+func (ml *MutableList) DisableHistory() {
+	ml.hist = nil
+}
+
+// Undo reverts the last change (see MutableTable.Undo).
+func (ml *MutableList) Undo() error {
+	clean, er := ml.hist.step(true)
+	ml.histDone(clean)
+	return er
+}
+
+// Redo reapplies the last change that was undone.
+func (ml *MutableList) Redo() error {
+	clean, er := ml.hist.step(false)
+	ml.histDone(clean)
+	return er
+}
+
+// Checkpoint returns the current position in the history.
+func (ml *MutableList) Checkpoint() Checkpoint {
+	return ml.hist.checkpoint()
+}
+
+// RevertTo undoes (or redoes) changes until the MutableList is back at cp.
+func (ml *MutableList) RevertTo(cp Checkpoint) error {
+	return ml.hist.revertTo(cp, ml.histDone)
+}
+
+func (ml *MutableList) histDone(clean bool) {
+	if clean {
+		ml.MarkClean()
+	}
+}
+
+// recordList adds a history entry for a list change, given the functions
+// which undo and redo it on the decoded list.
+func (l *List) recordList(undo, redo func(dec []interface{}) []interface{}) {
+	if l.hist == nil {
+		return
+	}
+
+	apply := func(fn func([]interface{}) []interface{}) func() error {
+		return func() error {
+			dec, er := l.decode()
+			if er != nil {
+				return er
+			}
+
+			out := fn(deepCopy(dec).([]interface{}))
+			evs := diffEvents(dec, out)
+			if er := l.obs.before(evs); er != nil {
+				return er
+			}
+
+			l.decoded = out
+			l.dirty = true
+			l.obs.after(evs)
+			return nil
+		}
+	}
+
+	l.hist.push(histEntry{undo: apply(undo), redo: apply(redo)})
+}
+
+// recordListAll records a change which replaced the whole list.
+func (l *List) recordListAll(old []interface{}) {
+	if l.hist == nil {
+		return
+	}
+
+	old, cur := deepCopy(old).([]interface{}), deepCopy(l.decoded).([]interface{})
+	l.recordList(
+		func([]interface{}) []interface{} { return deepCopy(old).([]interface{}) },
+		func([]interface{}) []interface{} { return deepCopy(cur).([]interface{}) },
+	)
+}
+
+func listInsert(l []interface{}, i int, val interface{}) []interface{} {
+	out := make([]interface{}, 0, len(l)+1)
+	out = append(out, l[:i]...)
+	out = append(out, val)
+	return append(out, l[i:]...)
+}
+
+func listRemove(l []interface{}, i int) []interface{} {
+	out := make([]interface{}, 0, len(l)-1)
+	out = append(out, l[:i]...)
+	return append(out, l[i+1:]...)
+}
@@ -0,0 +1,169 @@
+package jsonb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTableHistory(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada", "age": 36}`)
+	mt.EnableHistory(0)
+
+	if er := mt.Undo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+
+	mt.Set("name", "eve")
+	cp := mt.Checkpoint()
+	mt.Delete("age")
+	mt.Batch().Set("nick", "e").Set("tags", []interface{}{"x"}).Commit()
+
+	expected := map[string]interface{}{"name": "eve", "nick": "e", "tags": []interface{}{"x"}}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Fatalf("got %#v", dec)
+	}
+
+	// The batch is undone as a whole.
+	if er := mt.Undo(); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, map[string]interface{}{"name": "eve"}) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if er := mt.Redo(); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if er := mt.RevertTo(cp); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, map[string]interface{}{"name": "eve", "age": float64(36)}) {
+		t.Errorf("got %#v", dec)
+	}
+
+	// Back to the original document, which isn't dirty any more.
+	if er := mt.Undo(); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, map[string]interface{}{"name": "ada", "age": float64(36)}) || mt.Dirty() {
+		t.Errorf("got %#v, dirty %v", dec, mt.Dirty())
+	}
+
+	if er := mt.Redo(); er != nil || !mt.Dirty() {
+		t.Errorf("got %v, dirty %v", er, mt.Dirty())
+	}
+	if full, patch, _ := mt.changes(); full || len(patch) != 1 || patch["name"] != "eve" {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+
+	// New changes drop what was undone.
+	mt.Set("age", 40)
+	if er := mt.Redo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+}
+
+func TestTableHistoryLimit(t *testing.T) {
+	mt := testPatchTable(t, `{"age": 0}`)
+	mt.EnableHistory(2)
+
+	cp := mt.Checkpoint()
+	for i := 1; i <= 3; i++ {
+		mt.Set("age", i)
+	}
+
+	if er := mt.RevertTo(cp); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+
+	mt.Undo()
+	mt.Undo()
+	if er := mt.Undo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+
+	// The clean state has been dropped from the history.
+	if dec, _ := mt.decode(); dec["age"] != 1 || !mt.Dirty() {
+		t.Errorf("got %#v, dirty %v", dec, mt.Dirty())
+	}
+}
+
+func TestTableHistoryMarkClean(t *testing.T) {
+	mt := testPatchTable(t, `{"age": 0}`)
+	mt.EnableHistory(0)
+
+	mt.Set("age", 1)
+	mt.MarkClean()
+	mt.Set("age", 2)
+
+	mt.Undo()
+	if mt.Dirty() {
+		t.Errorf("should be clean where it was saved")
+	}
+
+	mt.Undo()
+	if !mt.Dirty() {
+		t.Errorf("should be dirty before it was saved")
+	}
+
+	// Scanning forgets the history.
+	cp := mt.Checkpoint()
+	if er := mt.Scan(`{"age": 5}`); er != nil {
+		t.Fatal(er)
+	}
+	if er := mt.Redo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+	if er := mt.RevertTo(cp); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+}
+
+func TestListHistory(t *testing.T) {
+	var l List
+	if er := l.Scan(`[1, 2, 3]`); er != nil {
+		t.Fatal(er)
+	}
+
+	ml, er := l.As(TypeNumberList)
+	if er != nil {
+		t.Fatal(er)
+	}
+	ml.EnableHistory(0)
+
+	ml.Append(4)
+	ml.Set(0, 0)
+	ml.Remove(1)
+	ml.Batch().Append(5).Remove(0).Commit()
+
+	steps := [][]interface{}{
+		{0, float64(3), 4},
+		{0, float64(2), float64(3), 4},
+		{float64(1), float64(2), float64(3), 4},
+		{float64(1), float64(2), float64(3)},
+	}
+
+	for i, expected := range steps {
+		if er := ml.Undo(); er != nil {
+			t.Fatal(er)
+		}
+		if !reflect.DeepEqual(ml.Values(), expected) {
+			t.Errorf("%d: got %#v", i, ml.Values())
+		}
+	}
+
+	if ml.Dirty() {
+		t.Errorf("should be clean after undoing everything")
+	}
+
+	if er := ml.RevertTo(ml.Checkpoint() + 4); er != nil {
+		t.Fatal(er)
+	}
+	if !reflect.DeepEqual(ml.Values(), []interface{}{float64(3), 4, 5}) || !ml.Dirty() {
+		t.Errorf("got %#v", ml.Values())
+	}
+}
@@ -0,0 +1,443 @@
+package jsonb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ChangeOp is the kind of change described by a ChangeEvent. They match
+// the JSON Patch operations of the same names.
+type ChangeOp int
+
+const (
+	ChangeAdd ChangeOp = iota
+	ChangeReplace
+	ChangeRemove
+)
+
+func (op ChangeOp) String() string {
+	switch op {
+	case ChangeAdd:
+		return "add"
+	case ChangeReplace:
+		return "replace"
+	case ChangeRemove:
+		return "remove"
+	}
+
+	return "ChangeOp(" + strconv.Itoa(int(op)) + ")"
+}
+
+// ChangeEvent describes a single change to a MutableTable or MutableList.
+type ChangeEvent struct {
+	// Path is a JSON Pointer to the changed value, from the root of the
+	// document (including for changes made through sub-views).
+	Path string
+	Op   ChangeOp
+
+	// Old is nil for adds, and New is nil for removes.
+	Old, New interface{}
+}
+
+type observer struct {
+	// prefix is the path of the (sub-)view the hook was added to.
+	prefix string
+
+	before func(ev ChangeEvent) error
+	after  func(ev ChangeEvent)
+}
+
+// observers holds the hooks for a document. Sub-views share their root's.
+type observers struct {
+	list []observer
+}
+
+// observes returns true if an event at path affects the value at prefix:
+// that is, if either is within the other.
+func observes(prefix, path string) bool {
+	return prefix == path ||
+		strings.HasPrefix(path, prefix+"/") ||
+		strings.HasPrefix(prefix, path+"/")
+}
+
+// before runs the before hooks for evs, stopping at the first error.
+func (o *observers) before(evs []ChangeEvent) error {
+	if o == nil {
+		return nil
+	}
+
+	list := o.list
+	for _, ev := range evs {
+		for _, ob := range list {
+			if ob.before != nil && observes(ob.prefix, ev.Path) {
+				if er := ob.before(ev); er != nil {
+					return er
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o *observers) after(evs []ChangeEvent) {
+	if o == nil {
+		return
+	}
+
+	list := o.list
+	for _, ev := range evs {
+		for _, ob := range list {
+			if ob.after != nil && observes(ob.prefix, ev.Path) {
+				ob.after(ev)
+			}
+		}
+	}
+}
+
+// keyEvent returns the event for changing key from old to new, where ok1
+// and ok2 say whether the respective values are present.
+func keyEvent(path string, old interface{}, ok1 bool, new interface{}, ok2 bool) ChangeEvent {
+	ev := ChangeEvent{Path: path, Op: ChangeReplace, Old: old, New: new}
+	switch {
+	case !ok1:
+		ev.Op = ChangeAdd
+	case !ok2:
+		ev.Op = ChangeRemove
+	}
+
+	return ev
+}
+
+// diffEvents returns the events for the changes from old to new (see
+// DiffTables).
+func diffEvents(old, new interface{}) []ChangeEvent {
+	var p Patch
+	diffValues("", old, new, &p)
+
+	evs := make([]ChangeEvent, len(p))
+	for i, op := range p {
+		evs[i].Path = op.Path
+
+		switch op.Op {
+		case "add":
+			evs[i].Op = ChangeAdd
+		case "replace":
+			evs[i].Op = ChangeReplace
+		case "remove":
+			evs[i].Op = ChangeRemove
+		}
+
+		if op.Op != "add" {
+			// NB: diffValues removes list elements from the end, so their
+			// indices in old are still right.
+			toks, _ := pointerTokens(op.Path)
+			evs[i].Old, _ = patchGet(old, toks)
+		}
+		if op.Op != "remove" {
+			evs[i].New = op.Value
+		}
+	}
+
+	return evs
+}
+
+func prefixEvents(prefix string, evs []ChangeEvent) []ChangeEvent {
+	if prefix == "" {
+		return evs
+	}
+
+	out := make([]ChangeEvent, len(evs))
+	for i, ev := range evs {
+		ev.Path = prefix + ev.Path
+		out[i] = ev
+	}
+
+	return out
+}
+
+// eventKeys returns the top-level keys changed by evs.
+func eventKeys(evs []ChangeEvent) []string {
+	seen := make(map[string]bool, len(evs))
+	var keys []string
+	for _, ev := range evs {
+		toks, _ := pointerTokens(ev.Path)
+		if len(toks) > 0 && !seen[toks[0]] {
+			seen[toks[0]] = true
+			keys = append(keys, toks[0])
+		}
+	}
+
+	return keys
+}
+
+// BeforeChange adds a hook which is called before every change to the
+// MutableTable (or, for sub-views, to the part of the document within the
+// view). If it returns an error, the change isn't made and the error is
+// returned from the method making it.
+//
+// Changes made by batches and patches are reported as the differences
+// between the old and new documents (as for DiffTables), and are vetoed as
+// a whole.
+func (mt *MutableTable) BeforeChange(fn func(ev ChangeEvent) error) {
+	o := mt.observers()
+	o.list = append(o.list, observer{prefix: mt.path, before: fn})
+}
+
+// OnChange adds a hook which is called after every change to the
+// MutableTable (see BeforeChange).
+func (mt *MutableTable) OnChange(fn func(ev ChangeEvent)) {
+	o := mt.observers()
+	o.list = append(o.list, observer{prefix: mt.path, after: fn})
+}
+
+func (mt *MutableTable) observers() *observers {
+	if mt.obs == nil {
+		mt.obs = &observers{}
+	}
+
+	return mt.obs
+}
+
+// BeforeChange adds a hook which is called before every change to the
+// MutableList (see MutableTable.BeforeChange).
+func (ml *MutableList) BeforeChange(fn func(ev ChangeEvent) error) {
+	o := ml.observers()
+	o.list = append(o.list, observer{prefix: ml.path, before: fn})
+}
+
+// OnChange adds a hook which is called after every change to the
+// MutableList.
+func (ml *MutableList) OnChange(fn func(ev ChangeEvent)) {
+	o := ml.observers()
+	o.list = append(o.list, observer{prefix: ml.path, after: fn})
+}
+
+func (ml *MutableList) observers() *observers {
+	if ml.obs == nil {
+		ml.obs = &observers{}
+	}
+
+	return ml.obs
+}
+
+// Sub returns a view of the table stored at key, which must be a table
+// field. If key isn't set, the view reads as an empty table, and key is
+// only set by the view's first change (which is reported as just that
+// change).
+//
+// Changes made through the view are made to mt's document: they're
+// tracked, recorded in the history and reported to hooks by mt, with paths
+// from mt's root. The view follows the value at its path, so it stays
+// usable when key is replaced or removed.
+func (mt *MutableTable) Sub(key string) (*MutableTable, error) {
+	fty, ok := mt.ty.Fields[key]
+	if !ok || fty.deref().Kind != KindTable {
+		return nil, ErrSchema
+	}
+	fty = fty.deref()
+
+	root, path := mt.subPath(key)
+
+	sub := &MutableTable{
+		ty:    fty,
+		Table: &Table{root: root, path: path, obs: root.obs},
+	}
+
+	if _, er := sub.decode(); er != nil {
+		return nil, er
+	}
+
+	return sub, nil
+}
+
+// SubList returns a view of the list stored at key, which must be a list
+// field (see Sub).
+func (mt *MutableTable) SubList(key string) (*MutableList, error) {
+	fty, ok := mt.ty.Fields[key]
+	if !ok || fty.deref().Kind != KindList {
+		return nil, ErrSchema
+	}
+	fty = fty.deref()
+
+	root, path := mt.subPath(key)
+
+	sub := &MutableList{
+		ty:   fty,
+		List: List{root: root, path: path, obs: root.obs},
+	}
+
+	if _, er := sub.decode(); er != nil {
+		return nil, er
+	}
+
+	return sub, nil
+}
+
+// subPath returns the root and path for a sub-view of key.
+func (mt *MutableTable) subPath(key string) (*MutableTable, string) {
+	root := mt
+	if mt.root != nil {
+		root = mt.root
+	}
+	root.observers()
+
+	return root, pointerAppend(mt.path, key)
+}
+
+// resolveView returns the value at path in the document for a sub-view, or
+// empty if it (or any table containing it) isn't set yet.
+func (mt *MutableTable) resolveView(path string, empty interface{}) (interface{}, error) {
+	dec, er := mt.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	toks, er := pointerTokens(path)
+	if er != nil {
+		return nil, er
+	}
+
+	var val interface{} = dec
+	for _, tok := range toks {
+		tab, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, ErrPatchPath
+		}
+
+		if val, ok = tab[tok]; !ok {
+			return empty, nil
+		}
+	}
+
+	return val, nil
+}
+
+// update replaces the document with out (a changed copy of old, which is
+// the current document), after checking it against the Type's Rules and
+// running the before hooks for evs. The top-level keys in evs are marked as
+// changed and recorded in the history.
+func (mt *MutableTable) update(old, out map[string]interface{}, evs []ChangeEvent) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	if mt.root != nil {
+		return mt.root.updateAt(mt.path, out, prefixEvents(mt.path, evs))
+	}
+
+	if er := newViolations(mt.ty, old, out); er != nil {
+		return er
+	}
+
+	if er := mt.obs.before(evs); er != nil {
+		return er
+	}
+
+	mt.decoded = out
+
+	// Keep track of what was changed, for partial updates. Removed keys
+	// can't be expressed that way, so they need the whole document to be
+	// rewritten.
+	for _, ev := range evs {
+		toks, _ := pointerTokens(ev.Path)
+		_, ok := out[toks[0]]
+		mt.markChanged(ev.Path, !ok)
+	}
+
+	keys := eventKeys(evs)
+
+	mt.record(old, keys)
+	mt.obs.after(evs)
+	return nil
+}
+
+// updateAt replaces the value at path (which is within a top-level key) on
+// behalf of a sub-view. Tables on the way to path which aren't set yet are
+// created.
+func (mt *MutableTable) updateAt(path string, val interface{}, evs []ChangeEvent) error {
+	dec, er := mt.decode()
+	if er != nil {
+		return er
+	}
+
+	toks, er := pointerTokens(path)
+	if er != nil {
+		return er
+	}
+
+	// NB: Only the top-level value containing path is copied.
+	key := toks[0]
+	old, ok := dec[key]
+	top, er := viewAdd(deepCopy(old), ok, toks[1:], val)
+	if er != nil {
+		return er
+	}
+
+	out := make(map[string]interface{}, len(dec))
+	for k, v := range dec {
+		out[k] = v
+	}
+	out[key] = top
+
+	return mt.update(dec, out, evs)
+}
+
+// viewAdd sets the value at toks within doc (which is missing if ok is
+// false), creating any missing tables on the way.
+func viewAdd(doc interface{}, ok bool, toks []string, val interface{}) (interface{}, error) {
+	if len(toks) == 0 {
+		return val, nil
+	}
+
+	if !ok {
+		doc = map[string]interface{}{}
+	}
+
+	tab, isTab := doc.(map[string]interface{})
+	if !isTab {
+		return nil, ErrPatchPath
+	}
+
+	sub, ok := tab[toks[0]]
+	v, er := viewAdd(sub, ok, toks[1:], val)
+	if er != nil {
+		return nil, er
+	}
+
+	tab[toks[0]] = v
+	return tab, nil
+}
+
+// update replaces the list with out (see MutableTable.update). undo and
+// redo are recorded in the history if they're set; otherwise the whole
+// list is.
+func (ml *MutableList) update(old, out []interface{}, evs []ChangeEvent, undo, redo func(dec []interface{}) []interface{}) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	if ml.root != nil {
+		return ml.root.updateAt(ml.path, out, prefixEvents(ml.path, evs))
+	}
+
+	if er := newViolations(ml.ty, old, out); er != nil {
+		return er
+	}
+
+	if er := ml.obs.before(evs); er != nil {
+		return er
+	}
+
+	ml.decoded = out
+	ml.dirty = true
+
+	if undo != nil {
+		ml.recordList(undo, redo)
+	} else {
+		ml.recordListAll(old)
+	}
+
+	ml.obs.after(evs)
+	return nil
+}
@@ -0,0 +1,298 @@
+package jsonb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testHookType = NewTableType(TableDef{
+	"name": TypeString,
+	"tags": TypeStringList,
+	"addr": NewTableType(TableDef{
+		"city": TypeString,
+		"geo": NewTableType(TableDef{
+			"lat": TypeNumber,
+		}),
+	}),
+})
+
+func testHookTable(t *testing.T, src string) (*MutableTable, *[]ChangeEvent) {
+	var tab Table
+	if er := tab.Scan(src); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(testHookType)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var evs []ChangeEvent
+	mt.OnChange(func(ev ChangeEvent) {
+		evs = append(evs, ev)
+	})
+
+	return mt, &evs
+}
+
+func TestHooks(t *testing.T) {
+	mt, evs := testHookTable(t, `{"name": "ada"}`)
+
+	mt.Set("name", "eve")
+	mt.Set("tags", []interface{}{"a"})
+	mt.Delete("name")
+	mt.Batch().Set("name", "bob").Set("tags", []interface{}{"a", "b"}).Commit()
+
+	expected := []ChangeEvent{
+		{"/name", ChangeReplace, "ada", "eve"},
+		{"/tags", ChangeAdd, nil, []interface{}{"a"}},
+		{"/name", ChangeRemove, "eve", nil},
+		{"/name", ChangeAdd, nil, "bob"},
+		{"/tags/1", ChangeAdd, nil, "b"},
+	}
+	if !reflect.DeepEqual(*evs, expected) {
+		t.Errorf("got %#v", *evs)
+	}
+}
+
+func TestHooksVeto(t *testing.T) {
+	mt, evs := testHookTable(t, `{"name": "ada", "tags": ["a"]}`)
+
+	readOnly := errors.New("name is read-only")
+	mt.BeforeChange(func(ev ChangeEvent) error {
+		if ev.Path == "/name" {
+			return readOnly
+		}
+		return nil
+	})
+
+	tests := []func() error{
+		func() error { return mt.Set("name", "eve") },
+		func() error { return mt.Delete("name") },
+		func() error { return mt.Batch().Set("tags", []interface{}{}).Set("name", "eve").Commit() },
+		func() error { return mt.ApplyPatch(Patch{{Op: "replace", Path: "/name", Value: "eve"}}) },
+		func() error { return mt.ApplyMergePatch([]byte(`{"name": null}`)) },
+	}
+
+	for i, test := range tests {
+		if er := test(); er != readOnly {
+			t.Errorf("%d: got %v", i, er)
+		}
+
+		if dec, _ := mt.decode(); !reflect.DeepEqual(dec, map[string]interface{}{"name": "ada", "tags": []interface{}{"a"}}) || mt.Dirty() {
+			t.Errorf("%d: table changed: %#v", i, dec)
+		}
+	}
+
+	if len(*evs) != 0 {
+		t.Errorf("got events for vetoed changes: %#v", *evs)
+	}
+
+	if er := mt.Set("tags", []interface{}{"b"}); er != nil {
+		t.Error(er)
+	}
+}
+
+func TestHooksSub(t *testing.T) {
+	mt, evs := testHookTable(t, `{"name": "ada"}`)
+	mt.EnableHistory(0)
+
+	addr, er := mt.Sub("addr")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	geo, er := addr.Sub("geo")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var geoEvs []ChangeEvent
+	geo.OnChange(func(ev ChangeEvent) {
+		geoEvs = append(geoEvs, ev)
+	})
+
+	addr.Set("city", "london")
+	geo.Set("lat", 51.5)
+
+	if er := geo.Set("lat", "north"); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	expected := map[string]interface{}{
+		"name": "ada",
+		"addr": map[string]interface{}{
+			"city": "london",
+			"geo":  map[string]interface{}{"lat": 51.5},
+		},
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if full, patch, _ := mt.changes(); full || len(patch) != 1 || patch["addr"] == nil {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+
+	paths := make([]string, len(*evs))
+	for i, ev := range *evs {
+		paths[i] = ev.Path
+	}
+	if !reflect.DeepEqual(paths, []string{"/addr/city", "/addr/geo/lat"}) {
+		t.Errorf("got %v", paths)
+	}
+
+	if len(geoEvs) != 1 || geoEvs[0] != (ChangeEvent{"/addr/geo/lat", ChangeAdd, nil, 51.5}) {
+		t.Errorf("got %#v", geoEvs)
+	}
+
+	// Sub-view changes are undone through the root.
+	if er := mt.Undo(); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := geo.decode(); len(dec) != 0 {
+		t.Errorf("got %#v", dec)
+	}
+	if last := (*evs)[len(*evs)-1]; last.Path != "/addr" || last.Op != ChangeReplace {
+		t.Errorf("got %#v", last)
+	}
+
+	// Views follow their path, and recreate it if it's removed.
+	mt.Delete("addr")
+	if er := addr.Set("city", "paris"); er != nil {
+		t.Error(er)
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec["addr"], map[string]interface{}{"city": "paris"}) {
+		t.Errorf("got %#v", dec)
+	}
+}
+
+func TestHooksSubChanged(t *testing.T) {
+	mt, _ := testHookTable(t, `{"name": "ada", "addr": {"city": "london", "geo": {"lat": 1}}}`)
+
+	addr, er := mt.Sub("addr")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	geo, er := addr.Sub("geo")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := addr.Set("city", "paris"); er != nil {
+		t.Fatal(er)
+	}
+
+	if !addr.Changed("city") || addr.Changed("geo") || geo.Changed("lat") {
+		t.Errorf("got city %v, geo %v, lat %v", addr.Changed("city"), addr.Changed("geo"), geo.Changed("lat"))
+	}
+	if !mt.Changed("addr") || mt.Changed("name") {
+		t.Errorf("got addr %v, name %v", mt.Changed("addr"), mt.Changed("name"))
+	}
+
+	// Replacing a containing table changes everything in it.
+	mt.MarkClean()
+	if er := mt.Set("addr", map[string]interface{}{"city": "rome"}); er != nil {
+		t.Fatal(er)
+	}
+	if !geo.Changed("lat") || !addr.Changed("city") {
+		t.Errorf("got lat %v, city %v", geo.Changed("lat"), addr.Changed("city"))
+	}
+}
+
+func TestHooksSubLazy(t *testing.T) {
+	mt, evs := testHookTable(t, `{"name": "ada"}`)
+	mt.EnableHistory(-1)
+
+	addr, er := mt.Sub("addr")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	geo, er := addr.Sub("geo")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	// Reading through views doesn't change anything.
+	if dec, _ := geo.decode(); len(dec) != 0 {
+		t.Errorf("got %#v", dec)
+	}
+	if mt.Dirty() || len(*evs) != 0 {
+		t.Errorf("read made changes: dirty %v, events %#v", mt.Dirty(), *evs)
+	}
+	if er := mt.Undo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+	if dec, _ := mt.decode(); len(dec) != 1 {
+		t.Errorf("got %#v", dec)
+	}
+
+	// The first write creates the tables on the way, as a single change.
+	if er := geo.Set("lat", 51.5); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []ChangeEvent{{"/addr/geo/lat", ChangeAdd, nil, 51.5}}
+	if !reflect.DeepEqual(*evs, expected) {
+		t.Errorf("got %#v", *evs)
+	}
+
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec["addr"], map[string]interface{}{"geo": map[string]interface{}{"lat": 51.5}}) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if er := mt.Undo(); er != nil {
+		t.Fatal(er)
+	}
+	if dec, _ := mt.decode(); len(dec) != 1 {
+		t.Errorf("got %#v", dec)
+	}
+	if er := mt.Undo(); er != ErrNoHistory {
+		t.Errorf("got %v, expected ErrNoHistory", er)
+	}
+
+	tags, er := mt.SubList("tags")
+	if er != nil {
+		t.Fatal(er)
+	}
+	if len(tags.Values()) != 0 || len(*evs) != 2 {
+		t.Errorf("got %#v, events %#v", tags.Values(), *evs)
+	}
+}
+
+func TestHooksSubList(t *testing.T) {
+	mt, evs := testHookTable(t, `{"tags": ["a", "b", "c"]}`)
+
+	tags, er := mt.SubList("tags")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	tags.Append("d")
+	tags.Remove(0)
+	tags.Set(0, "x")
+
+	if !reflect.DeepEqual(tags.Values(), []interface{}{"x", "c", "d"}) {
+		t.Errorf("got %#v", tags.Values())
+	}
+
+	expected := []ChangeEvent{
+		{"/tags/3", ChangeAdd, nil, "d"},
+		{"/tags/0", ChangeRemove, "a", nil},
+		{"/tags/0", ChangeReplace, "b", "x"},
+	}
+	if !reflect.DeepEqual(*evs, expected) {
+		t.Errorf("got %#v", *evs)
+	}
+
+	if !mt.Dirty() {
+		t.Errorf("root isn't dirty")
+	}
+
+	if _, er := mt.SubList("name"); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+}
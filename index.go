@@ -0,0 +1,277 @@
+package jsonb
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+type IndexMethod int
+
+const (
+	// IndexBTree is a btree expression index on the value, extracted as
+	// text/numeric/boolean for primitive Types (so it can be used by
+	// comparisons on ->>) or as jsonb otherwise.
+	IndexBTree IndexMethod = iota
+
+	// IndexGIN is a GIN index using the default jsonb_ops operator class,
+	// which supports ?, ?|, ?& and @>.
+	IndexGIN
+
+	// IndexGINPathOps is a GIN index using jsonb_path_ops, which is smaller
+	// and faster than jsonb_ops but only supports @> (and jsonpath
+	// matching).
+	IndexGINPathOps
+)
+
+var indexMethodStrings = map[IndexMethod]string{
+	IndexBTree:      `"btree"`,
+	IndexGIN:        `"gin"`,
+	IndexGINPathOps: `"gin_path_ops"`,
+}
+
+func (m IndexMethod) MarshalJSON() ([]byte, error) {
+	s, ok := indexMethodStrings[m]
+	if !ok {
+		return nil, ErrNoSuchIndexMethod
+	}
+
+	return []byte(s), nil
+}
+
+func (m *IndexMethod) UnmarshalJSON(bs []byte) error {
+	s := string(bs)
+
+	for m1, v := range indexMethodStrings {
+		if v == s {
+			*m = m1
+			return nil
+		}
+	}
+
+	return ErrNoSuchIndexMethod
+}
+
+// Index is an annotation on a Type requesting that values at its position
+// in a document be indexed. Only Types reachable from the root through table
+// fields can be indexed; there's no way to index individual list elements
+// (index the list with IndexGIN instead).
+type Index struct {
+	Method IndexMethod
+
+	// Name is the index name. If empty, one is derived from the table,
+	// column and field path.
+	Name string `json:",omitempty"`
+
+	// Unique makes a unique index. Only valid for IndexBTree.
+	Unique bool `json:",omitempty"`
+
+	// Where, if set, makes a partial index with Where (raw SQL) as its
+	// predicate.
+	Where string `json:",omitempty"`
+}
+
+// IndexDDL returns a CREATE INDEX statement for every Index annotation in ty,
+// in a stable order. ErrSchema is returned for annotations that can't be
+// expressed (e.g. inside a list, or unique GIN indexes), and
+// ErrDuplicateIndex if two annotations end up with the same name (since IF
+// NOT EXISTS would quietly skip the second one).
+//
+// References are followed. Annotations within a recursive part of ty would
+// need an index per level, so they give ErrRecursiveType.
+func (ty *Type) IndexDDL(table, column string) ([]string, error) {
+	var stmts []string
+	if er := ty.indexDDL(table, column, nil, &stmts, make(map[string]bool), make(map[*Type]bool)); er != nil {
+		return nil, er
+	}
+
+	return stmts, nil
+}
+
+// indexDDL adds the statements for ty (at path) to stmts. stack holds the
+// Types being expanded, to catch recursion.
+func (ty *Type) indexDDL(table, column string, path []string, stmts *[]string, names map[string]bool, stack map[*Type]bool) error {
+	rty := ty.deref()
+	if rty.Kind == KindRef {
+		return ErrUnresolvedRef
+	}
+
+	if stack[rty] {
+		if rty.hasIndexes(make(map[*Type]bool)) {
+			return ErrRecursiveType
+		}
+		return nil
+	}
+
+	stack[rty] = true
+	defer delete(stack, rty)
+
+	// NB: A reference can have indexes of its own, on top of its Type's.
+	idxs := ty.Indexes
+	if rty != ty {
+		idxs = append(idxs[:len(idxs):len(idxs)], rty.Indexes...)
+	}
+
+	for _, idx := range idxs {
+		name := idx.Name
+		if name == "" {
+			name = indexName(table, column, path)
+		}
+
+		if names[name] {
+			return ErrDuplicateIndex
+		}
+		names[name] = true
+
+		stmt, er := idx.ddl(rty, name, table, column, path)
+		if er != nil {
+			return er
+		}
+
+		*stmts = append(*stmts, stmt)
+	}
+
+	switch rty.Kind {
+	case KindTable:
+		for _, k := range sortedKeys(rty.Fields) {
+			if er := rty.Fields[k].indexDDL(table, column, append(path[:len(path):len(path)], k), stmts, names, stack); er != nil {
+				return er
+			}
+		}
+
+	case KindList:
+		if rty.ListType.hasIndexes(make(map[*Type]bool)) {
+			return ErrSchema
+		}
+	}
+
+	return nil
+}
+
+// hasIndexes returns true if ty or anything in it has Index annotations.
+// seen holds the Types that have already been looked at.
+func (ty *Type) hasIndexes(seen map[*Type]bool) bool {
+	if len(ty.Indexes) > 0 {
+		return true
+	}
+
+	ty = ty.deref()
+	if seen[ty] {
+		return false
+	}
+	seen[ty] = true
+
+	if len(ty.Indexes) > 0 {
+		return true
+	}
+
+	switch ty.Kind {
+	case KindTable:
+		for _, fty := range ty.Fields {
+			if fty.hasIndexes(seen) {
+				return true
+			}
+		}
+
+	case KindList:
+		return ty.ListType.hasIndexes(seen)
+	}
+
+	return false
+}
+
+func (idx *Index) ddl(ty *Type, name, table, column string, path []string) (string, error) {
+	var buf strings.Builder
+
+	operands := make([]string, len(path))
+	for i, k := range path {
+		operands[i] = quoteLiteral(k)
+	}
+
+	buf.WriteString("CREATE ")
+	if idx.Unique {
+		if idx.Method != IndexBTree {
+			return "", ErrSchema
+		}
+		buf.WriteString("UNIQUE ")
+	}
+
+	fmt.Fprintf(&buf, "INDEX IF NOT EXISTS %s ON %s ", quoteIdent(name), quoteName(table))
+
+	switch idx.Method {
+	case IndexBTree:
+		var expr string
+		switch {
+		case len(path) == 0:
+			expr = quoteIdent(column)
+		case ty.Kind == KindString:
+			expr = jsonbPath(quoteIdent(column), operands, true)
+		case ty.Kind == KindNumber:
+			expr = "(" + jsonbPath(quoteIdent(column), operands, true) + ")::numeric"
+		case ty.Kind == KindBool:
+			expr = "(" + jsonbPath(quoteIdent(column), operands, true) + ")::boolean"
+		default:
+			expr = jsonbPath(quoteIdent(column), operands, false)
+		}
+
+		fmt.Fprintf(&buf, "((%s))", expr)
+
+	case IndexGIN, IndexGINPathOps:
+		expr := quoteIdent(column)
+		if len(path) > 0 {
+			expr = "(" + jsonbPath(expr, operands, false) + ")"
+		}
+
+		ops := "jsonb_ops"
+		if idx.Method == IndexGINPathOps {
+			ops = "jsonb_path_ops"
+		}
+		fmt.Fprintf(&buf, "USING gin (%s %s)", expr, ops)
+
+	default:
+		return "", ErrNoSuchIndexMethod
+	}
+
+	if idx.Where != "" {
+		fmt.Fprintf(&buf, " WHERE %s", idx.Where)
+	}
+
+	return buf.String(), nil
+}
+
+// indexName derives an index name from its location. PostgreSQL truncates
+// identifiers to 63 bytes, so long names are truncated here to keep the
+// generated DDL honest.
+//
+// NB: Names which had to be mangled (or truncated) get a hash of the
+// original location appended, so e.g. fields "a.b" and "a-b" don't end up
+// sharing an index.
+func indexName(table, column string, path []string) string {
+	parts := append([]string{table, column}, path...)
+	parts = append(parts, "idx")
+	orig := strings.Join(parts, "_")
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, orig)
+
+	if name == orig && len(name) <= 63 {
+		return name
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(parts, "\x00")))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+
+	if len(name) > 63-len(suffix) {
+		name = name[:63-len(suffix)]
+	}
+
+	return name + suffix
+}
@@ -0,0 +1,198 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// testGolden compares out against testdata/name, or rewrites the file if
+// -update was given.
+func testGolden(t *testing.T, name, out string) {
+	path := filepath.Join("testdata", name)
+
+	if *updateGolden {
+		if er := ioutil.WriteFile(path, []byte(out), 0644); er != nil {
+			t.Fatal(er)
+		}
+		return
+	}
+
+	bs, er := ioutil.ReadFile(path)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if string(bs) != out {
+		t.Errorf("%s differs, got\n%s", path, out)
+	}
+}
+
+func TestIndexDDL(t *testing.T) {
+	ty := &Type{
+		Kind:    KindTable,
+		Indexes: []Index{{Method: IndexGINPathOps}},
+		Fields: TableDef{
+			"email": &Type{
+				Kind:    KindString,
+				Indexes: []Index{{Method: IndexBTree, Unique: true}},
+			},
+			"age": &Type{
+				Kind: KindNumber,
+				Indexes: []Index{{
+					Method: IndexBTree,
+					Name:   "adults",
+					Where:  `("doc" ->> 'age')::numeric >= 18`,
+				}},
+			},
+			"address": NewTableType(TableDef{
+				"zip": &Type{
+					Kind:    KindString,
+					Indexes: []Index{{Method: IndexBTree}},
+				},
+				"geo": &Type{
+					Kind:    KindTable,
+					Indexes: []Index{{Method: IndexBTree}},
+				},
+			}),
+			"tags": &Type{
+				Kind:     KindList,
+				ListType: TypeString,
+				Indexes:  []Index{{Method: IndexGIN}},
+			},
+			"active": &Type{
+				Kind:    KindBool,
+				Indexes: []Index{{Method: IndexBTree}},
+			},
+		},
+	}
+
+	stmts, er := ty.IndexDDL("public.Users", "doc")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testGolden(t, "index/users.sql", strings.Join(stmts, ";\n")+";\n")
+}
+
+func TestIndexDDLInvalid(t *testing.T) {
+	inList := NewListType(&Type{
+		Kind:    KindString,
+		Indexes: []Index{{Method: IndexBTree}},
+	}, -1)
+	if _, er := inList.IndexDDL("t", "c"); er != ErrSchema {
+		t.Errorf("expected ErrSchema, got %v", er)
+	}
+
+	uniqueGin := &Type{
+		Kind:    KindTable,
+		Indexes: []Index{{Method: IndexGIN, Unique: true}},
+	}
+	if _, er := uniqueGin.IndexDDL("t", "c"); er != ErrSchema {
+		t.Errorf("expected ErrSchema, got %v", er)
+	}
+}
+
+func TestIndexDDLRefs(t *testing.T) {
+	r := NewRegistry()
+	r.Register("User", NewTableType(TableDef{
+		"email": &Type{Kind: KindString, Indexes: []Index{{Method: IndexBTree, Unique: true}}},
+	}))
+	editor := r.Ref("User")
+	editor.Indexes = []Index{{Method: IndexGIN, Name: "editors"}}
+	r.Register("Post", NewTableType(TableDef{
+		"author": r.Ref("User"),
+		"editor": editor,
+	}))
+
+	stmts, er := r.Ref("Post").IndexDDL("posts", "doc")
+	expected := []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS "posts_doc_author_email_idx" ON "posts" (("doc" -> 'author' ->> 'email'))`,
+		`CREATE INDEX IF NOT EXISTS "editors" ON "posts" USING gin (("doc" -> 'editor') jsonb_ops)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "posts_doc_editor_email_idx" ON "posts" (("doc" -> 'editor' ->> 'email'))`,
+	}
+	if er != nil || !reflect.DeepEqual(stmts, expected) {
+		t.Errorf("got %v, %v", stmts, er)
+	}
+
+	// Recursion is fine, unless it has indexes.
+	if _, er := testRegistry(t).Ref("Comment").IndexDDL("comments", "doc"); er != nil {
+		t.Error(er)
+	}
+
+	r.Register("Node", NewTableType(TableDef{
+		"name": &Type{Kind: KindString, Indexes: []Index{{Method: IndexBTree}}},
+		"next": r.Ref("Node"),
+	}))
+	if _, er := r.Ref("Node").IndexDDL("nodes", "doc"); er != ErrRecursiveType {
+		t.Errorf("got %v, expected ErrRecursiveType", er)
+	}
+}
+
+func TestIndexName(t *testing.T) {
+	if name := indexName("users", "doc", []string{"email"}); name != "users_doc_email_idx" {
+		t.Errorf("got %s", name)
+	}
+
+	dot := indexName("t", "doc", []string{"a.b"})
+	dash := indexName("t", "doc", []string{"a-b"})
+	if dot == dash || !strings.HasPrefix(dot, "t_doc_a_b_idx_") {
+		t.Errorf("got %s and %s", dot, dash)
+	}
+
+	long := strings.Repeat("x", 70)
+	a, b := indexName("t", "doc", []string{long + "a"}), indexName("t", "doc", []string{long + "b"})
+	if a == b || len(a) != 63 || len(b) != 63 {
+		t.Errorf("got %s and %s", a, b)
+	}
+}
+
+func TestIndexDDLDuplicate(t *testing.T) {
+	ty := NewTableType(TableDef{
+		"a_b": &Type{Kind: KindString, Indexes: []Index{{Method: IndexBTree}}},
+		"a": NewTableType(TableDef{
+			"b": &Type{Kind: KindString, Indexes: []Index{{Method: IndexBTree}}},
+		}),
+	})
+	if _, er := ty.IndexDDL("t", "doc"); er != ErrDuplicateIndex {
+		t.Errorf("expected ErrDuplicateIndex, got %v", er)
+	}
+
+	named := &Type{
+		Kind:    KindString,
+		Indexes: []Index{{Method: IndexBTree, Name: "x"}, {Method: IndexGIN, Name: "x"}},
+	}
+	if _, er := named.IndexDDL("t", "doc"); er != ErrDuplicateIndex {
+		t.Errorf("expected ErrDuplicateIndex, got %v", er)
+	}
+}
+
+func TestIndexMethodJSON(t *testing.T) {
+	var idx Index
+	if er := json.Unmarshal([]byte(`{"Method":"gin_path_ops","Where":"true"}`), &idx); er != nil {
+		t.Fatal(er)
+	}
+
+	if idx.Method != IndexGINPathOps || idx.Where != "true" {
+		t.Errorf("bad index %#v", idx)
+	}
+
+	// Indexes are encoded like the rest of a Type.
+	bs, er := json.Marshal(Index{Method: IndexBTree, Unique: true})
+	if er != nil {
+		t.Fatal(er)
+	}
+	if string(bs) != `{"Method":"btree","Unique":true}` {
+		t.Errorf("got %s", bs)
+	}
+
+	if er := json.Unmarshal([]byte(`{"Method":"hash"}`), &idx); er != ErrNoSuchIndexMethod {
+		t.Errorf("expected ErrNoSuchIndexMethod, got %v", er)
+	}
+}
@@ -0,0 +1,1074 @@
+package jsonb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// JSONPath is a parsed SQL/JSON path expression, as understood by
+// PostgreSQL's jsonpath type (e.g. `$.items[*] ? (@.price > 10)`). The same
+// expression can be passed to PostgreSQL (via String) and evaluated against
+// decoded documents in Go (via Query), and can be checked against a Type.
+//
+// Supported: lax/strict modes, $, @, $variables, last, member accessors
+// (including quoted and wildcard), array subscripts and ranges, [*], .**
+// with optional levels, filters, arithmetic, comparisons, &&, ||, !,
+// exists, is unknown, like_regex, starts with and the type(), size(),
+// double(), abs(), floor(), ceiling() and keyvalue() methods. Date/time
+// methods aren't supported.
+//
+// NOTE: like_regex patterns are compiled with Go's regexp package rather
+// than PostgreSQL's, so exotic regular expressions may behave differently.
+type JSONPath struct {
+	src    string
+	strict bool
+	expr   jpNode
+}
+
+// JSONPathError is returned for syntax errors and strict-mode evaluation
+// errors. Pos is the byte offset in the expression the error refers to.
+type JSONPathError struct {
+	Pos int
+	Msg string
+}
+
+func (e *JSONPathError) Error() string {
+	return fmt.Sprintf("jsonb: jsonpath: %s at offset %d", e.Msg, e.Pos)
+}
+
+func jpErrorf(pos int, format string, args ...interface{}) *JSONPathError {
+	return &JSONPathError{
+		Pos: pos,
+		Msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// ParseJSONPath parses a jsonpath expression.
+func ParseJSONPath(src string) (*JSONPath, error) {
+	p := &jpParser{lex: jpLexer{src: src}}
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	path := &JSONPath{src: src}
+
+	if p.tok.typ == jpIdent && (p.tok.text == "strict" || p.tok.text == "lax") {
+		path.strict = p.tok.text == "strict"
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+	}
+
+	expr, er := p.parseOr()
+	if er != nil {
+		return nil, er
+	}
+
+	if p.tok.typ != jpEOF {
+		return nil, jpErrorf(p.tok.pos, "unexpected %s", p.tok)
+	}
+
+	path.expr = expr
+	return path, nil
+}
+
+// MustParseJSONPath is like ParseJSONPath but panics on error. It's intended
+// for statically-declared paths.
+func MustParseJSONPath(src string) *JSONPath {
+	p, er := ParseJSONPath(src)
+	if er != nil {
+		panic(er)
+	}
+
+	return p
+}
+
+// String returns the expression as it was parsed.
+func (p *JSONPath) String() string {
+	return p.src
+}
+
+/* Lexer */
+
+type jpTokenType int
+
+const (
+	jpEOF jpTokenType = iota
+	jpIdent
+	jpNumber
+	jpString
+	jpVariable
+	jpPunct
+)
+
+type jpToken struct {
+	typ  jpTokenType
+	text string
+	pos  int
+
+	// num is set for jpNumber; str is the unescaped value of jpString.
+	num float64
+	str string
+}
+
+func (t jpToken) String() string {
+	switch t.typ {
+	case jpEOF:
+		return "end of input"
+	case jpString:
+		return strconv.Quote(t.str)
+	}
+
+	return strconv.Quote(t.text)
+}
+
+type jpLexer struct {
+	src string
+	pos int
+}
+
+// jpPuncts is ordered so that longer tokens are matched first.
+var jpPuncts = []string{
+	"**", "==", "!=", "<>", "<=", ">=", "&&", "||",
+	".", "[", "]", "(", ")", "{", "}", ",", "?", "*", "+", "-", "/", "%", "<", ">", "!", "@", "$",
+}
+
+func jpIsIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || (!first && unicode.IsDigit(r))
+}
+
+func (l *jpLexer) next() (jpToken, error) {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n\f", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+
+	start := l.pos
+	if start >= len(l.src) {
+		return jpToken{typ: jpEOF, pos: start}, nil
+	}
+
+	c := l.src[start]
+	switch {
+	case c == '"':
+		return l.lexString()
+
+	case c >= '0' && c <= '9':
+		return l.lexNumber()
+
+	case c == '$' && start+1 < len(l.src):
+		r, _ := utf8.DecodeRuneInString(l.src[start+1:])
+		if r == '"' {
+			l.pos++
+			tok, er := l.lexString()
+			tok.typ, tok.pos, tok.text = jpVariable, start, l.src[start:l.pos]
+			return tok, er
+		}
+		if jpIsIdentRune(r, true) {
+			l.pos++
+			tok := l.lexIdent()
+			tok.typ, tok.pos, tok.str = jpVariable, start, tok.text
+			tok.text = l.src[start:l.pos]
+			return tok, nil
+		}
+	}
+
+	if r, _ := utf8.DecodeRuneInString(l.src[start:]); jpIsIdentRune(r, true) {
+		return l.lexIdent(), nil
+	}
+
+	for _, p := range jpPuncts {
+		if strings.HasPrefix(l.src[start:], p) {
+			l.pos += len(p)
+			return jpToken{typ: jpPunct, text: p, pos: start}, nil
+		}
+	}
+
+	return jpToken{}, jpErrorf(start, "unexpected character %q", c)
+}
+
+func (l *jpLexer) lexIdent() jpToken {
+	start := l.pos
+	for l.pos < len(l.src) {
+		r, n := utf8.DecodeRuneInString(l.src[l.pos:])
+		if !jpIsIdentRune(r, false) {
+			break
+		}
+		l.pos += n
+	}
+
+	return jpToken{typ: jpIdent, text: l.src[start:l.pos], pos: start}
+}
+
+func (l *jpLexer) lexNumber() (jpToken, error) {
+	start := l.pos
+	digits := func() {
+		for l.pos < len(l.src) && l.src[l.pos] >= '0' && l.src[l.pos] <= '9' {
+			l.pos++
+		}
+	}
+
+	digits()
+	if l.pos+1 < len(l.src) && l.src[l.pos] == '.' && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9' {
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+
+	text := l.src[start:l.pos]
+	f, er := strconv.ParseFloat(text, 64)
+	if er != nil {
+		return jpToken{}, jpErrorf(start, "invalid number %q", text)
+	}
+
+	return jpToken{typ: jpNumber, text: text, pos: start, num: f}, nil
+}
+
+func (l *jpLexer) lexString() (jpToken, error) {
+	start := l.pos
+	l.pos++
+
+	var buf strings.Builder
+	for {
+		if l.pos >= len(l.src) {
+			return jpToken{}, jpErrorf(start, "unterminated string")
+		}
+
+		c := l.src[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return jpToken{typ: jpString, text: l.src[start:l.pos], pos: start, str: buf.String()}, nil
+
+		case '\\':
+			if l.pos+1 >= len(l.src) {
+				return jpToken{}, jpErrorf(start, "unterminated string")
+			}
+
+			esc := l.src[l.pos+1]
+			l.pos += 2
+			switch esc {
+			case 'b':
+				buf.WriteByte('\b')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'v':
+				buf.WriteByte('\v')
+			case 'x':
+				if l.pos+2 > len(l.src) {
+					return jpToken{}, jpErrorf(l.pos-2, "invalid escape")
+				}
+				v, er := strconv.ParseUint(l.src[l.pos:l.pos+2], 16, 8)
+				if er != nil {
+					return jpToken{}, jpErrorf(l.pos-2, "invalid escape")
+				}
+				buf.WriteRune(rune(v))
+				l.pos += 2
+			case 'u':
+				r, er := l.lexUnicodeEscape()
+				if er != nil {
+					return jpToken{}, er
+				}
+				buf.WriteRune(r)
+			default:
+				buf.WriteByte(esc)
+			}
+
+		default:
+			buf.WriteByte(c)
+			l.pos++
+		}
+	}
+}
+
+// lexUnicodeEscape handles the part of \uXXXX or \u{X...} after the u.
+func (l *jpLexer) lexUnicodeEscape() (rune, error) {
+	start := l.pos - 2
+
+	var hex string
+	if l.pos < len(l.src) && l.src[l.pos] == '{' {
+		end := strings.IndexByte(l.src[l.pos:], '}')
+		if end < 0 {
+			return 0, jpErrorf(start, "invalid unicode escape")
+		}
+		hex = l.src[l.pos+1 : l.pos+end]
+		l.pos += end + 1
+	} else {
+		if l.pos+4 > len(l.src) {
+			return 0, jpErrorf(start, "invalid unicode escape")
+		}
+		hex = l.src[l.pos : l.pos+4]
+		l.pos += 4
+	}
+
+	v, er := strconv.ParseUint(hex, 16, 32)
+	if er != nil || hex == "" || v > unicode.MaxRune {
+		return 0, jpErrorf(start, "invalid unicode escape")
+	}
+
+	return rune(v), nil
+}
+
+/* AST */
+
+type jpNode interface {
+	pos() int
+}
+
+// jpPos is embedded in every node.
+type jpPos int
+
+func (p jpPos) pos() int {
+	return int(p)
+}
+
+type (
+	// jpVar is $, @, last or a $variable.
+	jpVar struct {
+		jpPos
+		name string
+	}
+
+	jpLiteral struct {
+		jpPos
+		val interface{}
+	}
+
+	jpUnary struct {
+		jpPos
+		op string
+		x  jpNode
+	}
+
+	jpArith struct {
+		jpPos
+		op   string
+		l, r jpNode
+	}
+
+	// jpChain is a primary expression followed by accessors.
+	jpChain struct {
+		jpPos
+		base      jpNode
+		accessors []jpAccessor
+	}
+
+	jpCompare struct {
+		jpPos
+		op   string
+		l, r jpNode
+	}
+
+	jpLogic struct {
+		jpPos
+		op   string
+		l, r jpNode
+	}
+
+	jpNot struct {
+		jpPos
+		x jpNode
+	}
+
+	jpExists struct {
+		jpPos
+		x jpNode
+	}
+
+	jpIsUnknown struct {
+		jpPos
+		x jpNode
+	}
+
+	jpLikeRegex struct {
+		jpPos
+		x  jpNode
+		re *regexp.Regexp
+	}
+
+	jpStartsWith struct {
+		jpPos
+		x, prefix jpNode
+	}
+)
+
+// jpIsPred returns true for nodes that produce a boolean (possibly unknown)
+// rather than a sequence of values.
+func jpIsPred(n jpNode) bool {
+	switch n.(type) {
+	case *jpCompare, *jpLogic, *jpNot, *jpExists, *jpIsUnknown, *jpLikeRegex, *jpStartsWith:
+		return true
+	}
+
+	return false
+}
+
+type jpAccessorType int
+
+const (
+	jpMember jpAccessorType = iota
+	jpMemberWildcard
+	jpArrayWildcard
+	jpSubscripts
+	jpFilter
+	jpMethod
+	jpRecursive
+)
+
+type jpSubscript struct {
+	from, to jpNode // to is nil for single subscripts
+}
+
+type jpAccessor struct {
+	typ jpAccessorType
+	pos int
+
+	// key is the member name or method name.
+	key string
+
+	subscripts []jpSubscript
+	filter     jpNode
+
+	// levels for .**; a maxLevel of -1 means there's no limit.
+	minLevel, maxLevel int
+}
+
+/* Parser */
+
+type jpParser struct {
+	lex jpLexer
+	tok jpToken
+}
+
+func (p *jpParser) next() (er error) {
+	p.tok, er = p.lex.next()
+	return er
+}
+
+func (p *jpParser) is(text string) bool {
+	return p.tok.typ == jpPunct && p.tok.text == text
+}
+
+func (p *jpParser) isKeyword(text string) bool {
+	return p.tok.typ == jpIdent && p.tok.text == text
+}
+
+func (p *jpParser) expect(text string) error {
+	if !p.is(text) {
+		return jpErrorf(p.tok.pos, "expected %q, found %s", text, p.tok)
+	}
+
+	return p.next()
+}
+
+func (p *jpParser) expectPred(n jpNode) error {
+	if !jpIsPred(n) {
+		return jpErrorf(n.pos(), "expected a predicate")
+	}
+	return nil
+}
+
+func (p *jpParser) expectValue(n jpNode) error {
+	if jpIsPred(n) {
+		return jpErrorf(n.pos(), "expected a value, found a predicate")
+	}
+	return nil
+}
+
+func (p *jpParser) parseOr() (jpNode, error) {
+	l, er := p.parseAnd()
+	if er != nil {
+		return nil, er
+	}
+
+	for p.is("||") {
+		pos := p.tok.pos
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		r, er := p.parseAnd()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expectPred(l); er != nil {
+			return nil, er
+		}
+		if er := p.expectPred(r); er != nil {
+			return nil, er
+		}
+
+		l = &jpLogic{jpPos(pos), "||", l, r}
+	}
+
+	return l, nil
+}
+
+func (p *jpParser) parseAnd() (jpNode, error) {
+	l, er := p.parseNot()
+	if er != nil {
+		return nil, er
+	}
+
+	for p.is("&&") {
+		pos := p.tok.pos
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		r, er := p.parseNot()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expectPred(l); er != nil {
+			return nil, er
+		}
+		if er := p.expectPred(r); er != nil {
+			return nil, er
+		}
+
+		l = &jpLogic{jpPos(pos), "&&", l, r}
+	}
+
+	return l, nil
+}
+
+func (p *jpParser) parseNot() (jpNode, error) {
+	if !p.is("!") {
+		return p.parsePredicate()
+	}
+
+	pos := p.tok.pos
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	if !p.is("(") {
+		return nil, jpErrorf(p.tok.pos, "expected \"(\" after \"!\"")
+	}
+
+	x, er := p.parsePrimary()
+	if er != nil {
+		return nil, er
+	}
+
+	if er := p.expectPred(x); er != nil {
+		return nil, er
+	}
+
+	return &jpNot{jpPos(pos), x}, nil
+}
+
+var jpCompareOps = map[string]string{
+	"==": "==",
+	"!=": "!=",
+	"<>": "!=",
+	"<":  "<",
+	"<=": "<=",
+	">":  ">",
+	">=": ">=",
+}
+
+func (p *jpParser) parsePredicate() (jpNode, error) {
+	if p.isKeyword("exists") {
+		pos := p.tok.pos
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+		if er := p.expect("("); er != nil {
+			return nil, er
+		}
+
+		x, er := p.parseOr()
+		if er != nil {
+			return nil, er
+		}
+		if er := p.expectValue(x); er != nil {
+			return nil, er
+		}
+
+		if er := p.expect(")"); er != nil {
+			return nil, er
+		}
+
+		return &jpExists{jpPos(pos), x}, nil
+	}
+
+	l, er := p.parseAdditive()
+	if er != nil {
+		return nil, er
+	}
+
+	pos := p.tok.pos
+	switch {
+	case p.tok.typ == jpPunct && jpCompareOps[p.tok.text] != "":
+		op := jpCompareOps[p.tok.text]
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		r, er := p.parseAdditive()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expectValue(l); er != nil {
+			return nil, er
+		}
+		if er := p.expectValue(r); er != nil {
+			return nil, er
+		}
+
+		return &jpCompare{jpPos(pos), op, l, r}, nil
+
+	case p.isKeyword("like_regex"):
+		return p.parseLikeRegex(l)
+
+	case p.isKeyword("starts"):
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+		if !p.isKeyword("with") {
+			return nil, jpErrorf(p.tok.pos, "expected \"with\" after \"starts\"")
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		var prefix jpNode
+		switch p.tok.typ {
+		case jpString:
+			prefix = &jpLiteral{jpPos(p.tok.pos), p.tok.str}
+		case jpVariable:
+			prefix = &jpVar{jpPos(p.tok.pos), p.tok.str}
+		default:
+			return nil, jpErrorf(p.tok.pos, "expected a string or variable after \"starts with\"")
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		if er := p.expectValue(l); er != nil {
+			return nil, er
+		}
+
+		return &jpStartsWith{jpPos(pos), l, prefix}, nil
+
+	case p.isKeyword("is"):
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+		if !p.isKeyword("unknown") {
+			return nil, jpErrorf(p.tok.pos, "expected \"unknown\" after \"is\"")
+		}
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		if er := p.expectPred(l); er != nil {
+			return nil, er
+		}
+
+		return &jpIsUnknown{jpPos(pos), l}, nil
+	}
+
+	return l, nil
+}
+
+func (p *jpParser) parseLikeRegex(x jpNode) (jpNode, error) {
+	pos := p.tok.pos
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	if p.tok.typ != jpString {
+		return nil, jpErrorf(p.tok.pos, "expected a pattern after \"like_regex\"")
+	}
+	pattern := p.tok.str
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	var flags string
+	if p.isKeyword("flag") {
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+		if p.tok.typ != jpString {
+			return nil, jpErrorf(p.tok.pos, "expected flags after \"flag\"")
+		}
+		flags = p.tok.str
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+	}
+
+	var prefix string
+	for _, f := range flags {
+		switch f {
+		case 'i', 's', 'm':
+			prefix += string(f)
+		case 'q':
+			pattern = regexp.QuoteMeta(pattern)
+		default:
+			return nil, jpErrorf(pos, "unsupported like_regex flag %q", f)
+		}
+	}
+	if prefix != "" {
+		pattern = "(?" + prefix + ")" + pattern
+	}
+
+	re, er := regexp.Compile(pattern)
+	if er != nil {
+		return nil, jpErrorf(pos, "invalid regular expression: %s", er)
+	}
+
+	if er := p.expectValue(x); er != nil {
+		return nil, er
+	}
+
+	return &jpLikeRegex{jpPos(pos), x, re}, nil
+}
+
+func (p *jpParser) parseAdditive() (jpNode, error) {
+	l, er := p.parseMultiplicative()
+	if er != nil {
+		return nil, er
+	}
+
+	for p.is("+") || p.is("-") {
+		op, pos := p.tok.text, p.tok.pos
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		r, er := p.parseMultiplicative()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expectValue(l); er != nil {
+			return nil, er
+		}
+		if er := p.expectValue(r); er != nil {
+			return nil, er
+		}
+
+		l = &jpArith{jpPos(pos), op, l, r}
+	}
+
+	return l, nil
+}
+
+func (p *jpParser) parseMultiplicative() (jpNode, error) {
+	l, er := p.parseUnary()
+	if er != nil {
+		return nil, er
+	}
+
+	for p.is("*") || p.is("/") || p.is("%") {
+		op, pos := p.tok.text, p.tok.pos
+		if er := p.next(); er != nil {
+			return nil, er
+		}
+
+		r, er := p.parseUnary()
+		if er != nil {
+			return nil, er
+		}
+
+		if er := p.expectValue(l); er != nil {
+			return nil, er
+		}
+		if er := p.expectValue(r); er != nil {
+			return nil, er
+		}
+
+		l = &jpArith{jpPos(pos), op, l, r}
+	}
+
+	return l, nil
+}
+
+func (p *jpParser) parseUnary() (jpNode, error) {
+	if !p.is("+") && !p.is("-") {
+		return p.parseChain()
+	}
+
+	op, pos := p.tok.text, p.tok.pos
+	if er := p.next(); er != nil {
+		return nil, er
+	}
+
+	x, er := p.parseUnary()
+	if er != nil {
+		return nil, er
+	}
+
+	if er := p.expectValue(x); er != nil {
+		return nil, er
+	}
+
+	return &jpUnary{jpPos(pos), op, x}, nil
+}
+
+func (p *jpParser) parseChain() (jpNode, error) {
+	base, er := p.parsePrimary()
+	if er != nil {
+		return nil, er
+	}
+
+	chain := &jpChain{jpPos: jpPos(base.pos()), base: base}
+	for {
+		acc, ok, er := p.parseAccessor()
+		if er != nil {
+			return nil, er
+		}
+		if !ok {
+			break
+		}
+
+		chain.accessors = append(chain.accessors, acc)
+	}
+
+	if len(chain.accessors) == 0 {
+		return base, nil
+	}
+
+	if er := p.expectValue(base); er != nil {
+		return nil, er
+	}
+
+	return chain, nil
+}
+
+func (p *jpParser) parsePrimary() (jpNode, error) {
+	tok := p.tok
+	pos := jpPos(tok.pos)
+
+	switch tok.typ {
+	case jpNumber:
+		return &jpLiteral{pos, tok.num}, p.next()
+
+	case jpString:
+		return &jpLiteral{pos, tok.str}, p.next()
+
+	case jpVariable:
+		return &jpVar{pos, tok.str}, p.next()
+
+	case jpIdent:
+		switch tok.text {
+		case "true":
+			return &jpLiteral{pos, true}, p.next()
+		case "false":
+			return &jpLiteral{pos, false}, p.next()
+		case "null":
+			return &jpLiteral{pos, nil}, p.next()
+		case "last":
+			return &jpVar{pos, "last"}, p.next()
+		}
+
+	case jpPunct:
+		switch tok.text {
+		case "$", "@":
+			return &jpVar{pos, tok.text}, p.next()
+
+		case "(":
+			if er := p.next(); er != nil {
+				return nil, er
+			}
+
+			x, er := p.parseOr()
+			if er != nil {
+				return nil, er
+			}
+
+			return x, p.expect(")")
+		}
+	}
+
+	return nil, jpErrorf(tok.pos, "unexpected %s", tok)
+}
+
+var jpMethods = map[string]bool{
+	"type":     true,
+	"size":     true,
+	"double":   true,
+	"abs":      true,
+	"floor":    true,
+	"ceiling":  true,
+	"keyvalue": true,
+}
+
+func (p *jpParser) parseAccessor() (jpAccessor, bool, error) {
+	acc := jpAccessor{pos: p.tok.pos}
+
+	switch {
+	case p.is("."):
+		if er := p.next(); er != nil {
+			return acc, false, er
+		}
+
+		switch {
+		case p.is("*"):
+			acc.typ = jpMemberWildcard
+			return acc, true, p.next()
+
+		case p.is("**"):
+			return p.parseRecursive(acc)
+
+		case p.tok.typ == jpString:
+			acc.typ, acc.key = jpMember, p.tok.str
+			return acc, true, p.next()
+
+		case p.tok.typ == jpIdent:
+			acc.typ, acc.key = jpMember, p.tok.text
+			if er := p.next(); er != nil {
+				return acc, false, er
+			}
+
+			if p.is("(") {
+				if !jpMethods[acc.key] {
+					return acc, false, jpErrorf(acc.pos, "unsupported method %q", acc.key)
+				}
+				if er := p.next(); er != nil {
+					return acc, false, er
+				}
+
+				acc.typ = jpMethod
+				return acc, true, p.expect(")")
+			}
+			return acc, true, nil
+		}
+
+		return acc, false, jpErrorf(p.tok.pos, "expected a key after \".\", found %s", p.tok)
+
+	case p.is("["):
+		if er := p.next(); er != nil {
+			return acc, false, er
+		}
+
+		if p.is("*") {
+			if er := p.next(); er != nil {
+				return acc, false, er
+			}
+			acc.typ = jpArrayWildcard
+			return acc, true, p.expect("]")
+		}
+
+		acc.typ = jpSubscripts
+		for {
+			from, er := p.parseAdditive()
+			if er != nil {
+				return acc, false, er
+			}
+			if er := p.expectValue(from); er != nil {
+				return acc, false, er
+			}
+
+			sub := jpSubscript{from: from}
+			if p.isKeyword("to") {
+				if er := p.next(); er != nil {
+					return acc, false, er
+				}
+				if sub.to, er = p.parseAdditive(); er != nil {
+					return acc, false, er
+				}
+				if er := p.expectValue(sub.to); er != nil {
+					return acc, false, er
+				}
+			}
+
+			acc.subscripts = append(acc.subscripts, sub)
+			if !p.is(",") {
+				break
+			}
+			if er := p.next(); er != nil {
+				return acc, false, er
+			}
+		}
+		return acc, true, p.expect("]")
+
+	case p.is("?"):
+		if er := p.next(); er != nil {
+			return acc, false, er
+		}
+		if !p.is("(") {
+			return acc, false, jpErrorf(p.tok.pos, "expected \"(\" after \"?\"")
+		}
+
+		filter, er := p.parsePrimary()
+		if er != nil {
+			return acc, false, er
+		}
+		if er := p.expectPred(filter); er != nil {
+			return acc, false, er
+		}
+
+		acc.typ, acc.filter = jpFilter, filter
+		return acc, true, nil
+	}
+
+	return acc, false, nil
+}
+
+func (p *jpParser) parseRecursive(acc jpAccessor) (jpAccessor, bool, error) {
+	acc.typ = jpRecursive
+	acc.minLevel, acc.maxLevel = 0, -1
+	if er := p.next(); er != nil {
+		return acc, false, er
+	}
+
+	if !p.is("{") {
+		return acc, true, nil
+	}
+	if er := p.next(); er != nil {
+		return acc, false, er
+	}
+
+	level := func(allowLast bool) (int, error) {
+		if allowLast && p.isKeyword("last") {
+			return -1, p.next()
+		}
+		if p.tok.typ != jpNumber || p.tok.num != float64(int(p.tok.num)) || p.tok.num < 0 {
+			return 0, jpErrorf(p.tok.pos, "expected a level, found %s", p.tok)
+		}
+
+		n := int(p.tok.num)
+		return n, p.next()
+	}
+
+	var er error
+	if acc.minLevel, er = level(false); er != nil {
+		return acc, false, er
+	}
+	acc.maxLevel = acc.minLevel
+
+	if p.isKeyword("to") {
+		if er := p.next(); er != nil {
+			return acc, false, er
+		}
+		if acc.maxLevel, er = level(true); er != nil {
+			return acc, false, er
+		}
+	}
+
+	return acc, true, p.expect("}")
+}
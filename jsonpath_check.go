@@ -0,0 +1,425 @@
+package jsonb
+
+import (
+	"strings"
+)
+
+// jpNullType stands in for null literals while checking; no Type other than
+// TypeAny admits null.
+var jpNullType = &Type{Kind: KindAny}
+
+// jpKeyValueType is the result of keyvalue() on a table.
+var jpKeyValueType = &Type{
+	Kind: KindTable,
+	Fields: TableDef{
+		"key":   TypeString,
+		"value": TypeAny,
+		"id":    TypeNumber,
+	},
+}
+
+type jpChecker struct {
+	strict bool
+	root   *Type
+	errs   []*JSONPathError
+}
+
+// Check statically checks the path against documents of type ty, and
+// returns an error for every part of the path that can never match
+// anything: unknown fields, accessors applied to primitives, comparisons
+// between values of different kinds, and so on. A path with no errors may
+// still match nothing for a given document.
+//
+// $variables are assumed to be of any type.
+func (p *JSONPath) Check(ty *Type) []*JSONPathError {
+	c := &jpChecker{
+		strict: p.strict,
+		root:   ty.deref(),
+	}
+
+	c.value(p.expr, nil)
+	return c.errs
+}
+
+func (c *jpChecker) errorf(pos int, format string, args ...interface{}) {
+	c.errs = append(c.errs, jpErrorf(pos, format, args...))
+}
+
+func jpKindName(ty *Type) string {
+	if ty == jpNullType {
+		return "null"
+	}
+
+	return strings.Trim(kindStrings[ty.Kind], `"`)
+}
+
+// jpTypeSet is the set of Types an expression may evaluate to. References
+// are always resolved before they're added.
+type jpTypeSet []*Type
+
+func (s jpTypeSet) add(ty *Type) jpTypeSet {
+	ty = ty.deref()
+	for _, ty1 := range s {
+		if ty1 == ty {
+			return s
+		}
+	}
+
+	return append(s, ty)
+}
+
+func (s jpTypeSet) has(kinds ...Kind) bool {
+	for _, ty := range s {
+		if ty == jpNullType {
+			continue
+		}
+
+		for _, k := range kinds {
+			if ty.Kind == k || ty.Kind == KindAny {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// unwrap replaces lists with their element types in lax mode.
+func (c *jpChecker) unwrap(s jpTypeSet) jpTypeSet {
+	if c.strict {
+		return s
+	}
+
+	var out jpTypeSet
+	for _, ty := range s {
+		if ty.Kind == KindList {
+			out = out.add(ty.ListType)
+		} else {
+			out = out.add(ty)
+		}
+	}
+
+	return out
+}
+
+func (c *jpChecker) value(n jpNode, current jpTypeSet) jpTypeSet {
+	switch n := n.(type) {
+	case *jpLiteral:
+		switch n.val.(type) {
+		case string:
+			return jpTypeSet{TypeString}
+		case bool:
+			return jpTypeSet{TypeBool}
+		case nil:
+			return jpTypeSet{jpNullType}
+		}
+		return jpTypeSet{TypeNumber}
+
+	case *jpVar:
+		switch n.name {
+		case "$":
+			return jpTypeSet{c.root}
+		case "@":
+			return current
+		case "last":
+			return jpTypeSet{TypeNumber}
+		}
+		return jpTypeSet{TypeAny}
+
+	case *jpUnary:
+		c.number(n.x, current, "operand of unary "+n.op)
+		return jpTypeSet{TypeNumber}
+
+	case *jpArith:
+		c.number(n.l, current, "left operand of "+n.op)
+		c.number(n.r, current, "right operand of "+n.op)
+		return jpTypeSet{TypeNumber}
+
+	case *jpChain:
+		s := c.value(n.base, current)
+		for _, acc := range n.accessors {
+			if len(s) == 0 {
+				break
+			}
+			s = c.access(acc, s, current)
+		}
+		return s
+	}
+
+	c.pred(n, current)
+	return jpTypeSet{TypeBool, jpNullType}
+}
+
+func (c *jpChecker) number(n jpNode, current jpTypeSet, what string) {
+	s := c.unwrap(c.value(n, current))
+	if len(s) > 0 && !s.has(KindNumber) {
+		c.errorf(n.pos(), "%s is never a number", what)
+	}
+}
+
+func (c *jpChecker) access(acc jpAccessor, s, current jpTypeSet) jpTypeSet {
+	var out jpTypeSet
+
+	// NB: the same rules as jpEval.accessOne, applied to Types.
+	for _, ty := range s {
+		for _, ty1 := range c.accessOne(acc, ty, current) {
+			out = out.add(ty1)
+		}
+	}
+
+	if len(out) == 0 {
+		switch acc.typ {
+		case jpMember:
+			c.errorf(acc.pos, "no field %q", acc.key)
+		case jpMemberWildcard:
+			c.errorf(acc.pos, "wildcard member accessor never applies to a table")
+		case jpArrayWildcard, jpSubscripts:
+			c.errorf(acc.pos, "array accessor never applies to a list")
+		case jpMethod:
+			c.errorf(acc.pos, "%s() never applies to %s", acc.key, jpKindNames(s))
+		}
+	}
+
+	return out
+}
+
+func jpKindNames(s jpTypeSet) string {
+	var names []string
+	for _, ty := range s {
+		name := jpKindName(ty)
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, " or ")
+}
+
+func (c *jpChecker) accessOne(acc jpAccessor, ty *Type, current jpTypeSet) jpTypeSet {
+	if ty.Kind == KindList && !c.strict {
+		switch {
+		case acc.typ == jpMember, acc.typ == jpMemberWildcard, acc.typ == jpFilter,
+			acc.typ == jpMethod && acc.key != "type" && acc.key != "size":
+			return c.accessOne(acc, ty.ListType, current)
+		}
+	}
+
+	switch acc.typ {
+	case jpMember:
+		switch {
+		case ty.Kind == KindAny && ty != jpNullType:
+			return jpTypeSet{TypeAny}
+		case ty.Kind == KindTable:
+			if fty, ok := ty.Fields[acc.key]; ok {
+				return jpTypeSet{fty.deref()}
+			}
+		}
+		return nil
+
+	case jpMemberWildcard:
+		switch {
+		case ty.Kind == KindAny && ty != jpNullType:
+			return jpTypeSet{TypeAny}
+		case ty.Kind == KindTable:
+			var out jpTypeSet
+			for _, k := range sortedKeys(ty.Fields) {
+				out = out.add(ty.Fields[k])
+			}
+			return out
+		}
+		return nil
+
+	case jpArrayWildcard, jpSubscripts:
+		for _, sub := range acc.subscripts {
+			c.number(sub.from, current, "array subscript")
+			if sub.to != nil {
+				c.number(sub.to, current, "array subscript")
+			}
+		}
+
+		switch {
+		case ty.Kind == KindAny && ty != jpNullType:
+			return jpTypeSet{TypeAny}
+		case ty.Kind == KindList:
+			return jpTypeSet{ty.ListType.deref()}
+		case !c.strict:
+			return jpTypeSet{ty}
+		}
+		return nil
+
+	case jpFilter:
+		c.pred(acc.filter, jpTypeSet{ty})
+		return jpTypeSet{ty}
+
+	case jpMethod:
+		return c.method(acc, ty)
+
+	case jpRecursive:
+		var out jpTypeSet
+		d := jpDescent{min: acc.minLevel, max: acc.maxLevel, below: make(map[jpLevel]bool), from: make(map[*Type]int)}
+		d.descend(ty, 0, &out)
+		return out
+	}
+
+	panic("unreachable")
+}
+
+// jpDescent finds the Types matched by a .** accessor. Types can be reached
+// many times (especially recursive ones), so the visits are memoized: below
+// min, each Type needs visiting once per level, and from min on, only once
+// at its shallowest level, as everything below it is added either way.
+type jpDescent struct {
+	min, max int
+
+	below map[jpLevel]bool
+	from  map[*Type]int
+}
+
+type jpLevel struct {
+	ty    *Type
+	level int
+}
+
+func (d *jpDescent) descend(ty *Type, level int, out *jpTypeSet) {
+	if d.max >= 0 && level > d.max {
+		return
+	}
+
+	ty = ty.deref()
+	if level < d.min {
+		if d.below[jpLevel{ty, level}] {
+			return
+		}
+		d.below[jpLevel{ty, level}] = true
+	} else {
+		if prev, ok := d.from[ty]; ok && prev <= level {
+			return
+		}
+		d.from[ty] = level
+		*out = out.add(ty)
+	}
+
+	switch ty.Kind {
+	case KindTable:
+		for _, k := range sortedKeys(ty.Fields) {
+			d.descend(ty.Fields[k], level+1, out)
+		}
+
+	case KindList:
+		d.descend(ty.ListType, level+1, out)
+
+	case KindAny:
+		// Anything could be below an any, at any depth.
+		if ty != jpNullType && (d.max < 0 || level < d.max) {
+			*out = out.add(TypeAny)
+		}
+	}
+}
+
+func (c *jpChecker) method(acc jpAccessor, ty *Type) jpTypeSet {
+	isAny := ty.Kind == KindAny && ty != jpNullType
+
+	switch acc.key {
+	case "type":
+		return jpTypeSet{TypeString}
+
+	case "size":
+		if isAny || ty.Kind == KindList || !c.strict {
+			return jpTypeSet{TypeNumber}
+		}
+
+	case "keyvalue":
+		if isAny || ty.Kind == KindTable {
+			return jpTypeSet{jpKeyValueType}
+		}
+
+	case "double":
+		if isAny || ty.Kind == KindNumber || ty.Kind == KindString {
+			return jpTypeSet{TypeNumber}
+		}
+
+	default:
+		if isAny || ty.Kind == KindNumber {
+			return jpTypeSet{TypeNumber}
+		}
+	}
+
+	return nil
+}
+
+// jpComparable returns true if comparing l and r with op can ever be true.
+func jpComparable(op string, l, r *Type) bool {
+	switch {
+	case l == jpNullType && r == jpNullType:
+		return true
+	case l == jpNullType || r == jpNullType:
+		// Only any admits null; otherwise, null is never equal to
+		// anything, but always unequal to it.
+		return op == "!=" || (l.Kind == KindAny && r.Kind == KindAny)
+	case l.Kind == KindAny || r.Kind == KindAny:
+		return true
+	}
+
+	switch l.Kind {
+	case KindNumber, KindString, KindBool:
+		return l.Kind == r.Kind
+	}
+
+	// Tables and lists aren't comparable.
+	return false
+}
+
+func (c *jpChecker) pred(n jpNode, current jpTypeSet) {
+	switch n := n.(type) {
+	case *jpLogic:
+		c.pred(n.l, current)
+		c.pred(n.r, current)
+
+	case *jpNot:
+		c.pred(n.x, current)
+
+	case *jpIsUnknown:
+		c.pred(n.x, current)
+
+	case *jpExists:
+		c.value(n.x, current)
+
+	case *jpCompare:
+		l := c.unwrap(c.value(n.l, current))
+		r := c.unwrap(c.value(n.r, current))
+		if len(l) == 0 || len(r) == 0 {
+			return
+		}
+
+		for _, lty := range l {
+			for _, rty := range r {
+				if jpComparable(n.op, lty, rty) {
+					return
+				}
+			}
+		}
+
+		c.errorf(n.pos(), "comparing %s with %s is never true", jpKindNames(l), jpKindNames(r))
+
+	case *jpLikeRegex:
+		s := c.unwrap(c.value(n.x, current))
+		if len(s) > 0 && !s.has(KindString) {
+			c.errorf(n.pos(), "like_regex operand is never a string")
+		}
+
+	case *jpStartsWith:
+		s := c.unwrap(c.value(n.x, current))
+		if len(s) > 0 && !s.has(KindString) {
+			c.errorf(n.pos(), "starts with operand is never a string")
+		}
+
+		p := c.value(n.prefix, current)
+		if len(p) > 0 && !p.has(KindString) {
+			c.errorf(n.prefix.pos(), "starts with prefix is never a string")
+		}
+	}
+}
@@ -0,0 +1,739 @@
+package jsonb
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// jpBool is the three-valued result of a jsonpath predicate.
+type jpBool int
+
+const (
+	jpFalse jpBool = iota
+	jpTrue
+	jpUnknown
+)
+
+type jpEval struct {
+	strict bool
+	root   interface{}
+	vars   map[string]interface{}
+
+	// current is the value of @, and last the value of last; hasCurrent and
+	// hasLast are set when they're in scope.
+	current    interface{}
+	hasCurrent bool
+	last       int
+	hasLast    bool
+}
+
+// Query evaluates the path against doc (a decoded JSON value) and returns
+// every item it matches, like PostgreSQL's jsonb_path_query. vars holds the
+// values of $variables. If the path is a predicate (e.g. `$.a > 1`), the
+// result is a single true, false or nil (unknown).
+//
+// Structural errors (e.g. a missing key) are errors in strict mode and are
+// silently skipped in lax mode.
+func (p *JSONPath) Query(doc interface{}, vars map[string]interface{}) ([]interface{}, error) {
+	ev := &jpEval{
+		strict: p.strict,
+		root:   doc,
+		vars:   vars,
+	}
+
+	return ev.value(p.expr)
+}
+
+// Exists returns true if the path matches anything in doc, like PostgreSQL's
+// jsonb_path_exists.
+func (p *JSONPath) Exists(doc interface{}, vars map[string]interface{}) (bool, error) {
+	items, er := p.Query(doc, vars)
+	return len(items) > 0, er
+}
+
+// Match returns the result of a predicate path (e.g. `$.a > 1`) against doc,
+// like PostgreSQL's jsonb_path_match. Unknown results are false.
+func (p *JSONPath) Match(doc interface{}, vars map[string]interface{}) (bool, error) {
+	if !jpIsPred(p.expr) {
+		return false, jpErrorf(p.expr.pos(), "expected a predicate")
+	}
+
+	items, er := p.Query(doc, vars)
+	if er != nil {
+		return false, er
+	}
+
+	b, _ := items[0].(bool)
+	return b, nil
+}
+
+// QueryPath evaluates p against the Table's document (see JSONPath.Query).
+func (t *Table) QueryPath(p *JSONPath, vars map[string]interface{}) ([]interface{}, error) {
+	dec, er := t.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	return p.Query(dec, vars)
+}
+
+// QueryPath evaluates p against the List's document (see JSONPath.Query).
+func (l *List) QueryPath(p *JSONPath, vars map[string]interface{}) ([]interface{}, error) {
+	dec, er := l.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	return p.Query(dec, vars)
+}
+
+func (ev *jpEval) value(n jpNode) ([]interface{}, error) {
+	switch n := n.(type) {
+	case *jpLiteral:
+		return []interface{}{n.val}, nil
+
+	case *jpVar:
+		return ev.variable(n)
+
+	case *jpUnary:
+		items, er := ev.value(n.x)
+		if er != nil {
+			return nil, er
+		}
+
+		items = ev.unwrap(items)
+		out := make([]interface{}, len(items))
+		for i, item := range items {
+			f, ok := toFloat64(item)
+			if !ok {
+				return nil, jpErrorf(n.pos(), "operand of unary %s is not a number", n.op)
+			}
+			if n.op == "-" {
+				f = -f
+			}
+			out[i] = f
+		}
+		return out, nil
+
+	case *jpArith:
+		return ev.arith(n)
+
+	case *jpChain:
+		items, er := ev.value(n.base)
+		if er != nil {
+			return nil, er
+		}
+
+		for _, acc := range n.accessors {
+			if items, er = ev.access(acc, items); er != nil {
+				return nil, er
+			}
+		}
+		return items, nil
+	}
+
+	// Predicates used as values produce a single bool (or null for
+	// unknown).
+	switch ev.pred(n) {
+	case jpTrue:
+		return []interface{}{true}, nil
+	case jpFalse:
+		return []interface{}{false}, nil
+	}
+	return []interface{}{nil}, nil
+}
+
+func (ev *jpEval) variable(n *jpVar) ([]interface{}, error) {
+	switch n.name {
+	case "$":
+		return []interface{}{ev.root}, nil
+
+	case "@":
+		if !ev.hasCurrent {
+			return nil, jpErrorf(n.pos(), "@ is only allowed in filters")
+		}
+		return []interface{}{ev.current}, nil
+
+	case "last":
+		if !ev.hasLast {
+			return nil, jpErrorf(n.pos(), "last is only allowed in array subscripts")
+		}
+		return []interface{}{float64(ev.last)}, nil
+	}
+
+	val, ok := ev.vars[n.name]
+	if !ok {
+		return nil, jpErrorf(n.pos(), "undefined variable $%s", n.name)
+	}
+
+	return []interface{}{val}, nil
+}
+
+// unwrap expands arrays in lax mode.
+func (ev *jpEval) unwrap(items []interface{}) []interface{} {
+	if ev.strict {
+		return items
+	}
+
+	var out []interface{}
+	for _, item := range items {
+		if l, ok := item.([]interface{}); ok {
+			out = append(out, l...)
+		} else {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+func (ev *jpEval) number(n jpNode) (float64, error) {
+	items, er := ev.value(n)
+	if er != nil {
+		return 0, er
+	}
+
+	items = ev.unwrap(items)
+	if len(items) != 1 {
+		return 0, jpErrorf(n.pos(), "operand is not a single number")
+	}
+
+	f, ok := toFloat64(items[0])
+	if !ok {
+		return 0, jpErrorf(n.pos(), "operand is not a number")
+	}
+
+	return f, nil
+}
+
+func (ev *jpEval) arith(n *jpArith) ([]interface{}, error) {
+	l, er := ev.number(n.l)
+	if er != nil {
+		return nil, er
+	}
+
+	r, er := ev.number(n.r)
+	if er != nil {
+		return nil, er
+	}
+
+	var out float64
+	switch n.op {
+	case "+":
+		out = l + r
+	case "-":
+		out = l - r
+	case "*":
+		out = l * r
+	case "/", "%":
+		if r == 0 {
+			return nil, jpErrorf(n.pos(), "division by zero")
+		}
+		if n.op == "/" {
+			out = l / r
+		} else {
+			out = math.Mod(l, r)
+		}
+	}
+
+	return []interface{}{out}, nil
+}
+
+// jpKeys returns the keys of a table in the order PostgreSQL stores them
+// (shorter keys first, then bytewise).
+func jpKeys(t map[string]interface{}) []string {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+func (ev *jpEval) access(acc jpAccessor, items []interface{}) ([]interface{}, error) {
+	var out []interface{}
+
+	for _, item := range items {
+		res, er := ev.accessOne(acc, item)
+		if er != nil {
+			return nil, er
+		}
+
+		out = append(out, res...)
+	}
+
+	return out, nil
+}
+
+func (ev *jpEval) accessOne(acc jpAccessor, item interface{}) ([]interface{}, error) {
+	// Lax mode automatically unwraps arrays for everything except array
+	// accessors and the type()/size() methods.
+	if l, ok := item.([]interface{}); ok && !ev.strict {
+		switch {
+		case acc.typ == jpMember, acc.typ == jpMemberWildcard, acc.typ == jpFilter,
+			acc.typ == jpMethod && acc.key != "type" && acc.key != "size":
+			return ev.access(acc, l)
+		}
+	}
+
+	switch acc.typ {
+	case jpMember:
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			return ev.structural(acc.pos, "member accessor can only be applied to an object")
+		}
+
+		v, ok := t[acc.key]
+		if !ok {
+			return ev.structural(acc.pos, "key %q not found", acc.key)
+		}
+		return []interface{}{v}, nil
+
+	case jpMemberWildcard:
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			return ev.structural(acc.pos, "wildcard member accessor can only be applied to an object")
+		}
+
+		var out []interface{}
+		for _, k := range jpKeys(t) {
+			out = append(out, t[k])
+		}
+		return out, nil
+
+	case jpArrayWildcard:
+		l, ok := item.([]interface{})
+		if !ok {
+			if ev.strict {
+				return nil, jpErrorf(acc.pos, "wildcard array accessor can only be applied to an array")
+			}
+			return []interface{}{item}, nil
+		}
+		return l, nil
+
+	case jpSubscripts:
+		return ev.subscripts(acc, item)
+
+	case jpFilter:
+		ev1 := *ev
+		ev1.current, ev1.hasCurrent = item, true
+		if ev1.pred(acc.filter) == jpTrue {
+			return []interface{}{item}, nil
+		}
+		return nil, nil
+
+	case jpMethod:
+		return ev.method(acc, item)
+
+	case jpRecursive:
+		var out []interface{}
+		jpDescend(item, 0, acc.minLevel, acc.maxLevel, &out)
+		return out, nil
+	}
+
+	panic("unreachable")
+}
+
+func (ev *jpEval) structural(pos int, format string, args ...interface{}) ([]interface{}, error) {
+	if ev.strict {
+		return nil, jpErrorf(pos, format, args...)
+	}
+
+	return nil, nil
+}
+
+func jpDescend(item interface{}, level, min, max int, out *[]interface{}) {
+	if max >= 0 && level > max {
+		return
+	}
+
+	if level >= min {
+		*out = append(*out, item)
+	}
+
+	switch v := item.(type) {
+	case map[string]interface{}:
+		for _, k := range jpKeys(v) {
+			jpDescend(v[k], level+1, min, max, out)
+		}
+	case []interface{}:
+		for _, v1 := range v {
+			jpDescend(v1, level+1, min, max, out)
+		}
+	}
+}
+
+func (ev *jpEval) subscripts(acc jpAccessor, item interface{}) ([]interface{}, error) {
+	l, ok := item.([]interface{})
+	if !ok {
+		if ev.strict {
+			return nil, jpErrorf(acc.pos, "array accessor can only be applied to an array")
+		}
+		l = []interface{}{item}
+	}
+
+	ev1 := *ev
+	ev1.last, ev1.hasLast = len(l)-1, true
+
+	var out []interface{}
+	for _, sub := range acc.subscripts {
+		from, er := ev1.index(sub.from)
+		if er != nil {
+			return nil, er
+		}
+
+		to := from
+		if sub.to != nil {
+			if to, er = ev1.index(sub.to); er != nil {
+				return nil, er
+			}
+		}
+
+		if from < 0 || to >= len(l) || from > to {
+			if ev.strict {
+				return nil, jpErrorf(acc.pos, "array subscript is out of bounds")
+			}
+
+			// Lax mode just clamps the range.
+			if from < 0 {
+				from = 0
+			}
+			if to >= len(l) {
+				to = len(l) - 1
+			}
+		}
+
+		for i := from; i <= to; i++ {
+			out = append(out, l[i])
+		}
+	}
+
+	return out, nil
+}
+
+func (ev *jpEval) index(n jpNode) (int, error) {
+	f, er := ev.number(n)
+	if er != nil {
+		return 0, er
+	}
+
+	return int(f), nil
+}
+
+func jpTypeName(val interface{}) string {
+	switch val.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+
+	if _, ok := toFloat64(val); ok {
+		return "number"
+	}
+
+	return "unknown"
+}
+
+func (ev *jpEval) method(acc jpAccessor, item interface{}) ([]interface{}, error) {
+	switch acc.key {
+	case "type":
+		return []interface{}{jpTypeName(item)}, nil
+
+	case "size":
+		l, ok := item.([]interface{})
+		if !ok {
+			if ev.strict {
+				return nil, jpErrorf(acc.pos, "size() can only be applied to an array")
+			}
+			return []interface{}{float64(1)}, nil
+		}
+		return []interface{}{float64(len(l))}, nil
+
+	case "keyvalue":
+		t, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, jpErrorf(acc.pos, "keyvalue() can only be applied to an object")
+		}
+
+		// NB: PostgreSQL derives "id" from the object's position in the
+		// document; there's no equivalent here, so it's always 0.
+		var out []interface{}
+		for _, k := range jpKeys(t) {
+			out = append(out, map[string]interface{}{
+				"key":   k,
+				"value": t[k],
+				"id":    float64(0),
+			})
+		}
+		return out, nil
+	}
+
+	f, ok := toFloat64(item)
+	if !ok {
+		if s, isStr := item.(string); isStr && acc.key == "double" {
+			if v, ok := coerceNumber(s); ok {
+				return []interface{}{v}, nil
+			}
+		}
+		return nil, jpErrorf(acc.pos, "%s() can only be applied to a number", acc.key)
+	}
+
+	switch acc.key {
+	case "abs":
+		f = math.Abs(f)
+	case "floor":
+		f = math.Floor(f)
+	case "ceiling":
+		f = math.Ceil(f)
+	}
+
+	return []interface{}{f}, nil
+}
+
+func jpAnd(l, r jpBool) jpBool {
+	switch {
+	case l == jpFalse || r == jpFalse:
+		return jpFalse
+	case l == jpUnknown || r == jpUnknown:
+		return jpUnknown
+	}
+	return jpTrue
+}
+
+func jpOr(l, r jpBool) jpBool {
+	switch {
+	case l == jpTrue || r == jpTrue:
+		return jpTrue
+	case l == jpUnknown || r == jpUnknown:
+		return jpUnknown
+	}
+	return jpFalse
+}
+
+func (ev *jpEval) pred(n jpNode) jpBool {
+	switch n := n.(type) {
+	case *jpLogic:
+		l := ev.pred(n.l)
+		if n.op == "&&" {
+			if l == jpFalse {
+				return jpFalse
+			}
+			return jpAnd(l, ev.pred(n.r))
+		}
+
+		if l == jpTrue {
+			return jpTrue
+		}
+		return jpOr(l, ev.pred(n.r))
+
+	case *jpNot:
+		switch ev.pred(n.x) {
+		case jpTrue:
+			return jpFalse
+		case jpFalse:
+			return jpTrue
+		}
+		return jpUnknown
+
+	case *jpIsUnknown:
+		if ev.pred(n.x) == jpUnknown {
+			return jpTrue
+		}
+		return jpFalse
+
+	case *jpExists:
+		items, er := ev.value(n.x)
+		if er != nil {
+			return jpUnknown
+		}
+		if len(items) > 0 {
+			return jpTrue
+		}
+		return jpFalse
+
+	case *jpCompare:
+		return ev.compare(n)
+
+	case *jpLikeRegex:
+		return ev.matchItems(n.x, func(item interface{}) jpBool {
+			s, ok := item.(string)
+			if !ok {
+				return jpUnknown
+			}
+			if n.re.MatchString(s) {
+				return jpTrue
+			}
+			return jpFalse
+		})
+
+	case *jpStartsWith:
+		prefixes, er := ev.value(n.prefix)
+		if er != nil || len(prefixes) != 1 {
+			return jpUnknown
+		}
+		prefix, ok := prefixes[0].(string)
+		if !ok {
+			return jpUnknown
+		}
+
+		return ev.matchItems(n.x, func(item interface{}) jpBool {
+			s, ok := item.(string)
+			if !ok {
+				return jpUnknown
+			}
+			if strings.HasPrefix(s, prefix) {
+				return jpTrue
+			}
+			return jpFalse
+		})
+	}
+
+	// Non-predicates can't appear here (the parser doesn't allow them).
+	panic("unreachable")
+}
+
+// matchItems applies test to every item of n. Like PostgreSQL, lax mode
+// returns true as soon as anything matches, while strict mode returns
+// unknown if any test errors.
+func (ev *jpEval) matchItems(n jpNode, test func(item interface{}) jpBool) jpBool {
+	items, er := ev.value(n)
+	if er != nil {
+		return jpUnknown
+	}
+
+	found, unknown := false, false
+	for _, item := range ev.unwrap(items) {
+		switch test(item) {
+		case jpTrue:
+			if !ev.strict {
+				return jpTrue
+			}
+			found = true
+		case jpUnknown:
+			if ev.strict {
+				return jpUnknown
+			}
+			unknown = true
+		}
+	}
+
+	switch {
+	case found:
+		return jpTrue
+	case unknown:
+		return jpUnknown
+	}
+	return jpFalse
+}
+
+func (ev *jpEval) compare(n *jpCompare) jpBool {
+	rs, er := ev.value(n.r)
+	if er != nil {
+		return jpUnknown
+	}
+	rs = ev.unwrap(rs)
+
+	return ev.matchItems(n.l, func(l interface{}) jpBool {
+		found, unknown := false, false
+		for _, r := range rs {
+			switch jpCompareItems(n.op, l, r) {
+			case jpTrue:
+				found = true
+			case jpUnknown:
+				unknown = true
+			}
+		}
+
+		switch {
+		case found && (!ev.strict || !unknown):
+			return jpTrue
+		case unknown:
+			return jpUnknown
+		}
+		return jpFalse
+	})
+}
+
+func jpCompareItems(op string, l, r interface{}) jpBool {
+	lt, rt := jpTypeName(l), jpTypeName(r)
+
+	if lt != rt {
+		// Comparing null with anything else is false, except for !=.
+		if lt == "null" || rt == "null" {
+			if op == "!=" {
+				return jpTrue
+			}
+			return jpFalse
+		}
+		return jpUnknown
+	}
+
+	var cmp int
+	switch lt {
+	case "null":
+		cmp = 0
+
+	case "boolean":
+		lb, rb := l.(bool), r.(bool)
+		switch {
+		case lb == rb:
+			cmp = 0
+		case !lb:
+			cmp = -1
+		default:
+			cmp = 1
+		}
+
+	case "number":
+		lf, _ := toFloat64(l)
+		rf, _ := toFloat64(r)
+		switch {
+		case lf < rf:
+			cmp = -1
+		case lf > rf:
+			cmp = 1
+		}
+
+	case "string":
+		cmp = strings.Compare(l.(string), r.(string))
+
+	default:
+		// Arrays and objects aren't comparable.
+		return jpUnknown
+	}
+
+	var res bool
+	switch op {
+	case "==":
+		res = cmp == 0
+	case "!=":
+		res = cmp != 0
+	case "<":
+		res = cmp < 0
+	case "<=":
+		res = cmp <= 0
+	case ">":
+		res = cmp > 0
+	case ">=":
+		res = cmp >= 0
+	}
+
+	if res {
+		return jpTrue
+	}
+	return jpFalse
+}
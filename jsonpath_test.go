@@ -0,0 +1,242 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testJSONPathDoc = `{
+	"name": "ada",
+	"age": 36,
+	"tags": ["admin", "ops"],
+	"address": {"zip": "12345"},
+	"items": [
+		{"sku": "a", "price": 5},
+		{"sku": "b", "price": 15},
+		{"sku": "c", "price": 25}
+	],
+	"extra": null
+}`
+
+func testJSONPathDecode(t *testing.T) interface{} {
+	var doc interface{}
+	if er := json.Unmarshal([]byte(testJSONPathDoc), &doc); er != nil {
+		t.Fatal(er)
+	}
+
+	return doc
+}
+
+func TestJSONPathParseBad(t *testing.T) {
+	paths := []string{
+		``,
+		`$.`,
+		`$[`,
+		`$ ? (@.a`,
+		`$.a +`,
+		`$."unterminated`,
+		`$.a like_regex "("`,
+		`$.a like_regex "x" flag "z"`,
+		`$.**{last to 2}`,
+		`$.nosuchmethod()`,
+		`strict`,
+		`$.a $.b`,
+	}
+
+	for _, src := range paths {
+		if _, er := ParseJSONPath(src); er == nil {
+			t.Errorf("%q: expected error", src)
+		} else if _, ok := er.(*JSONPathError); !ok {
+			t.Errorf("%q: expected *JSONPathError, got %T", src, er)
+		}
+	}
+}
+
+func TestJSONPathQuery(t *testing.T) {
+	doc := testJSONPathDecode(t)
+
+	tests := []struct {
+		path     string
+		expected []interface{}
+	}{
+		{`$.name`, []interface{}{"ada"}},
+		{`$."name"`, []interface{}{"ada"}},
+		{`$.nope`, nil},
+		{`$.tags[0]`, []interface{}{"admin"}},
+		{`$.tags[last]`, []interface{}{"ops"}},
+		{`$.tags[5]`, nil},
+		{`$.items[0 to 1].sku`, []interface{}{"a", "b"}},
+		{`$.items[*].sku`, []interface{}{"a", "b", "c"}},
+		{`$.items.sku`, []interface{}{"a", "b", "c"}},
+		{`$.items ? (@.price > 10).sku`, []interface{}{"b", "c"}},
+		{`$.items[*] ? (@.price > $min && @.sku != "c").sku`, []interface{}{"b"}},
+		{`$.age + 1`, []interface{}{float64(37)}},
+		{`-$.age`, []interface{}{float64(-36)}},
+		{`$.tags.size()`, []interface{}{float64(2)}},
+		{`$.address.type()`, []interface{}{"object"}},
+		{`$.address.keyvalue().key`, []interface{}{"zip"}},
+		{`$.address.*`, []interface{}{"12345"}},
+		{`$.**.zip`, []interface{}{"12345"}},
+		{`$.**{2}.sku`, []interface{}{"a", "b", "c"}},
+		{`$.tags ? (@ starts with "ad")`, []interface{}{"admin"}},
+		{`$.tags ? (@ like_regex "^O" flag "i")`, []interface{}{"ops"}},
+		{`$.extra == null`, []interface{}{true}},
+		{`$.age == "36"`, []interface{}{nil}},
+		{`exists($.nope)`, []interface{}{false}},
+		{`($.age == "36") is unknown`, []interface{}{true}},
+		{`$.items ? (exists(@.price ? (@ > 20))).sku`, []interface{}{"c"}},
+	}
+
+	vars := map[string]interface{}{"min": 10}
+
+	for _, test := range tests {
+		p, er := ParseJSONPath(test.path)
+		if er != nil {
+			t.Errorf("%s: %s", test.path, er)
+			continue
+		}
+
+		got, er := p.Query(doc, vars)
+		if er != nil {
+			t.Errorf("%s: %s", test.path, er)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: got %#v, expected %#v", test.path, got, test.expected)
+		}
+	}
+}
+
+func TestJSONPathStrict(t *testing.T) {
+	doc := testJSONPathDecode(t)
+
+	// Arithmetic on several values is an error even in lax mode.
+	if _, er := MustParseJSONPath(`$.items.price * 2`).Query(doc, nil); er == nil {
+		t.Errorf("expected error")
+	}
+
+	bad := []string{
+		`strict $.nope`,
+		`strict $.items.sku`,
+		`strict $.name[0]`,
+		`strict $.tags[5]`,
+		`strict $.name.size()`,
+	}
+
+	for _, src := range bad {
+		if _, er := MustParseJSONPath(src).Query(doc, nil); er == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+
+	// Errors inside filters are unknown rather than errors.
+	got, er := MustParseJSONPath(`strict $.items[*] ? (@.nope > 1)`).Query(doc, nil)
+	if er != nil || len(got) != 0 {
+		t.Errorf("got %v, %v", got, er)
+	}
+}
+
+func TestJSONPathMatch(t *testing.T) {
+	doc := testJSONPathDecode(t)
+
+	tests := map[string]bool{
+		`$.age > 30`:                      true,
+		`$.age > 40`:                      false,
+		`$.age == "36"`:                   false,
+		`$.items.price > 20`:              true,
+		`!($.tags == "admin")`:            false,
+		`$.nope == 1 || $.name == "ada"`:  true,
+		`$.extra != 1 && $.name != null`:  true,
+		`$.address.zip like_regex "^123"`: true,
+		`$.address.zip starts with "234"`: false,
+		`$.items.size() == 3`:             true,
+		`$.items[*].price.double() == 25`: true,
+	}
+
+	for src, expected := range tests {
+		got, er := MustParseJSONPath(src).Match(doc, nil)
+		if er != nil {
+			t.Errorf("%s: %s", src, er)
+		} else if got != expected {
+			t.Errorf("%s: got %v, expected %v", src, got, expected)
+		}
+	}
+
+	if _, er := MustParseJSONPath(`$.age`).Match(doc, nil); er == nil {
+		t.Errorf("expected error matching a non-predicate")
+	}
+}
+
+func TestJSONPathCheck(t *testing.T) {
+	tests := map[string]int{
+		`$.name`:                          0,
+		`$.items[*] ? (@.price > 10).sku`: 0,
+		`$.items.sku`:                     0,
+		`$.extra.whatever[3]`:             0,
+		`$.**.zip`:                        0,
+		`$.address.keyvalue() ? (@.key == "zip")`: 0,
+		`$.nope`:                               1,
+		`$.address.nope`:                       1,
+		`$.items ? (@.price == "x")`:           1,
+		`$.name.floor()`:                       1,
+		`$.age like_regex "x"`:                 1,
+		`$.age + $.name`:                       1,
+		`$.name == null`:                       1,
+		`$.name != null`:                       0,
+		`$.extra == null`:                      0,
+		`strict $.name[0]`:                     1,
+		`strict $.items.sku`:                   1,
+		`$.items ? (@.nope > 1 && @.sku == 2)`: 2,
+	}
+
+	for src, expected := range tests {
+		errs := MustParseJSONPath(src).Check(testQueryType)
+		if len(errs) != expected {
+			t.Errorf("%s: got %v, expected %d errors", src, errs, expected)
+		}
+	}
+}
+
+func TestJSONPathCheckRecursive(t *testing.T) {
+	// NB: Without memoizing, a bounded descent into a recursive Type takes
+	// time exponential in the bound.
+	r := NewRegistry()
+	r.Register("Node", NewTableType(TableDef{
+		"name":  TypeString,
+		"left":  r.Ref("Node"),
+		"right": r.Ref("Node"),
+	}))
+	ty := r.Ref("Node")
+
+	tests := map[string]int{
+		`$.**{2 to 60}.name`: 0,
+		`$.**{60}.name`:      0,
+		`$.**{2 to 60}.nope`: 1,
+		`$.**.nope`:          1,
+	}
+
+	for src, expected := range tests {
+		errs := MustParseJSONPath(src).Check(ty)
+		if len(errs) != expected {
+			t.Errorf("%s: got %v, expected %d errors", src, errs, expected)
+		}
+	}
+}
+
+func TestTableQueryPath(t *testing.T) {
+	var tab Table
+	if er := tab.Scan([]byte(testJSONPathDoc)); er != nil {
+		t.Fatal(er)
+	}
+
+	got, er := tab.QueryPath(MustParseJSONPath(`$.items[last].sku`), nil)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(got, []interface{}{"c"}) {
+		t.Errorf("got %#v", got)
+	}
+}
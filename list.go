@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"strconv"
 )
 
 // List is an abstraction around a JSON array. It provides read-only access
@@ -17,6 +18,18 @@ import (
 type List struct {
 	raw     json.RawMessage
 	decoded []interface{}
+
+	// dirty is set when the decoded value has been changed in a way that
+	// hasn't been written back to the database yet.
+	dirty bool
+
+	// hist is the undo/redo history, if it's been enabled.
+	hist *history
+
+	// obs, root and path are as for Table.
+	obs  *observers
+	root *MutableTable
+	path string
 }
 
 // MutableList is a type-checked list that can have values appended to it
@@ -31,15 +44,35 @@ var _ driver.Valuer = &List{}
 
 // NewList returns a newly constructed MutableList with the given type.
 func NewList(ty *Type) *MutableList {
-	return &MutableList{
-		ty: ty,
+	ml := &MutableList{
+		ty: ty.deref(),
 		List: List{
 			decoded: []interface{}{},
 		},
 	}
+
+	if er := ml.fillDefaults(); er != nil {
+		panic(er)
+	}
+
+	return ml
 }
 
 func (l *List) decode() ([]interface{}, error) {
+	if l.root != nil {
+		val, er := l.root.resolveView(l.path, []interface{}{})
+		if er != nil {
+			return nil, er
+		}
+
+		dec, ok := val.([]interface{})
+		if !ok {
+			return nil, ErrPatchPath
+		}
+
+		l.decoded = dec
+	}
+
 	if l.decoded == nil {
 		if er := json.Unmarshal(l.raw, &l.decoded); er != nil {
 			return nil, er
@@ -70,12 +103,13 @@ func (l *List) AsUnsafe(ty *Type) *MutableList {
 
 	return &MutableList{
 		List: *l,
-		ty:   ty,
+		ty:   ty.deref(),
 	}
 }
 
 // As creates a MutableList from a List, and type-checks every value to ensure
-// that it's what's expected.
+// that it's what's expected. Defaults of tables in the list are filled in as
+// for Table.As (marking the list dirty).
 func (l *List) As(ty *Type) (*MutableList, error) {
 	dec, er := l.decode()
 	if er != nil {
@@ -86,30 +120,90 @@ func (l *List) As(ty *Type) (*MutableList, error) {
 		return nil, ErrSchema
 	}
 
-	return l.AsUnsafe(ty), nil
+	ml := l.AsUnsafe(ty)
+	if er := ml.fillDefaults(); er != nil {
+		return nil, er
+	}
+
+	return ml, nil
 }
 
-func (l *List) Scan(src interface{}) error {
-	bs, ok := src.([]byte)
+// AsCoerce is like As, but values which don't match ty are converted to
+// the expected kind where possible (see Type.Coerce). The JSON Pointers of
+// every converted value are returned so they can be written back. If the
+// converted document breaks one of ty's Rules, the ValidationErrors are
+// returned.
+func (l *List) AsCoerce(ty *Type) (*MutableList, []string, error) {
+	dec, er := l.decode()
+	if er != nil {
+		return nil, nil, er
+	}
+
+	out, paths, ok := ty.Coerce(dec)
 	if !ok {
-		return ErrInvalidScanType
+		return nil, nil, ErrSchema
 	}
 
+	lst, ok := out.([]interface{})
+	if !ok {
+		return nil, nil, ErrSchema
+	}
+
+	// NB: Coerce only fixes up values, so the result may still break a
+	// Rule.
+	if er := ty.Validate(lst); er != nil {
+		return nil, nil, er
+	}
+
+	l.decoded = lst
+	if len(paths) > 0 {
+		l.dirty = true
+	}
+
+	ml := l.AsUnsafe(ty)
+	if er := ml.fillDefaults(); er != nil {
+		return nil, nil, er
+	}
+
+	return ml, paths, nil
+}
+
+func (l *List) Scan(src interface{}) error {
+	bs, er := scanBytes(src)
+	if er != nil {
+		return er
+	}
+
+	return l.scanRaw(bs)
+}
+
+// scanRaw sets the List to the JSON text bs (see Table.scanRaw).
+func (l *List) scanRaw(bs []byte) error {
 	if len(bs) == 0 || bs[0] != '[' {
 		// XXX: See note in Table.Scan.
 		return ErrInvalidJsonType
 	}
 
-	// NB: The buffer *MUST* be copied since it's re-used by pq
-	// and will be filled with garbage.
-	newSlice := make([]byte, len(bs))
-	copy(newSlice, bs)
-
-	l.raw = json.RawMessage(newSlice)
+	l.raw = json.RawMessage(bs)
 	l.decoded = nil
+	l.hist.reset()
+	l.MarkClean()
 	return nil
 }
 
+// Dirty returns true if the List has been modified (e.g. via Append) since
+// it was read.
+func (l *List) Dirty() bool {
+	return l.dirty
+}
+
+// MarkClean clears the dirty flag; call it once the List has been written
+// back to the database.
+func (l *List) MarkClean() {
+	l.dirty = false
+	l.hist.markClean()
+}
+
 func (l List) Value() (driver.Value, error) {
 	raw, er := l.encode()
 	return []byte(raw), er
@@ -131,6 +225,8 @@ func (l *List) UnmarshalJSON(bs []byte) error {
 	// efficient (by storing both until the next .decode is called) but
 	// realistically I doubt it'll matter.
 	l.decoded = val
+	l.hist.reset()
+	l.MarkClean()
 	return nil
 }
 
@@ -152,34 +248,90 @@ func (ml *MutableList) UnmarshalJSON(bs []byte) error {
 func (ml *MutableList) Append(val interface{}) error {
 	// NOTE: It could be an optimization here to serializing val and appending
 	// it directly to .raw if .decoded is nil. Seems like overkill.
-	if !ml.ty.ListType.IsValid(val) {
+	if !ml.ty.ListType.validTypes(val) {
 		return ErrSchema
 	}
 
-	_, er := ml.decode()
+	dec, er := ml.decode()
 	if er != nil {
 		return er
 	}
 
-	if len(ml.decoded) == ml.ty.MaxLen {
+	if len(dec) == ml.ty.MaxLen {
 		return ErrSchema
 	}
 
-	ml.decoded = append(ml.decoded, val)
-	return nil
+	ev := ChangeEvent{Path: pointerAppend("", strconv.Itoa(len(dec))), Op: ChangeAdd, New: val}
+	return ml.update(dec, append(dec, val), []ChangeEvent{ev},
+		func(dec []interface{}) []interface{} { return dec[:len(dec)-1] },
+		func(dec []interface{}) []interface{} { return append(dec, deepCopy(val)) },
+	)
+}
+
+// Set replaces the value at index i with val. It returns ErrIndexRange if i
+// is out of range, or ErrSchema if there's a type issue.
+func (ml *MutableList) Set(i int, val interface{}) error {
+	if !ml.ty.ListType.validTypes(val) {
+		return ErrSchema
+	}
+
+	dec, er := ml.decode()
+	if er != nil {
+		return er
+	}
+
+	if i < 0 || i >= len(dec) {
+		return ErrIndexRange
+	}
+
+	old := dec[i]
+	out := append([]interface{}(nil), dec...)
+	out[i] = val
+
+	ev := ChangeEvent{Path: pointerAppend("", strconv.Itoa(i)), Op: ChangeReplace, Old: old, New: val}
+	return ml.update(dec, out, []ChangeEvent{ev},
+		func(dec []interface{}) []interface{} { dec[i] = deepCopy(old); return dec },
+		func(dec []interface{}) []interface{} { dec[i] = deepCopy(val); return dec },
+	)
+}
+
+// Remove removes the value at index i. It returns ErrIndexRange if i is out
+// of range.
+func (ml *MutableList) Remove(i int) error {
+	dec, er := ml.decode()
+	if er != nil {
+		return er
+	}
+
+	if i < 0 || i >= len(dec) {
+		return ErrIndexRange
+	}
+
+	old := dec[i]
+	ev := ChangeEvent{Path: pointerAppend("", strconv.Itoa(i)), Op: ChangeRemove, Old: old}
+	return ml.update(dec, listRemove(dec, i), []ChangeEvent{ev},
+		func(dec []interface{}) []interface{} { return listInsert(dec, i, deepCopy(old)) },
+		func(dec []interface{}) []interface{} { return listRemove(dec, i) },
+	)
 }
 
 // Values returns the underlying Go values for the list as a []interface{}.
 // Note that, if the MutableList is created with AsUnsafe, the values may have
 // arbitrary types.
 func (ml *MutableList) Values() []interface{} {
+	// NB: Sub-views need to look the list up again.
+	if ml.root != nil {
+		dec, _ := ml.decode()
+		return dec
+	}
+
 	return ml.decoded
 }
 
 // Int64Values returns the list as an []int64. The list must only contain
 // numeric values. Non-integer numeric values are truncated.
 func (ml *MutableList) Int64Values() (out []int64, er error) {
-	for _, ival := range ml.decoded {
+	for _, ival := range ml.Values() {
 		switch val := ival.(type) {
 		case int:
 			out = append(out, int64(val))
@@ -200,7 +352,7 @@ func (ml *MutableList) Int64Values() (out []int64, er error) {
 
 // StringValues returns the list as a []string.
 func (ml *MutableList) StringValues() (out []string, er error) {
-	for _, ival := range ml.decoded {
+	for _, ival := range ml.Values() {
 		switch val := ival.(type) {
 		case string:
 			out = append(out, val)
@@ -0,0 +1,419 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// MergePrefer says how Merge resolves conflicts when there's no
+// MergeOptions.Resolve callback.
+type MergePrefer int
+
+const (
+	// MergeFail makes Merge fail with ErrConflict if there are conflicts.
+	MergeFail MergePrefer = iota
+
+	// MergeOurs and MergeTheirs resolve conflicts by taking the value
+	// from the respective side.
+	MergeOurs
+	MergeTheirs
+)
+
+// ListStrategy says how Merge combines lists changed on both sides.
+type ListStrategy int
+
+const (
+	// ListByIndex merges lists element by element. Lists whose lengths
+	// differ conflict as a whole.
+	ListByIndex ListStrategy = iota
+
+	// ListAppendUnion treats lists as sets: elements removed on either side
+	// are removed, and elements added on either side are added (ours
+	// first, then theirs), without duplicates.
+	ListAppendUnion
+
+	// ListByKey matches up list elements (which must be tables) by the
+	// value of ListMerge.KeyField, and merges matched elements.
+	ListByKey
+)
+
+// ListMerge configures how lists are merged.
+type ListMerge struct {
+	Strategy ListStrategy
+
+	// KeyField is the field identifying elements for ListByKey.
+	KeyField string
+}
+
+// MergeOptions configures Merge. The zero value fails on any conflict and
+// merges lists by index.
+type MergeOptions struct {
+	// Prefer resolves conflicts if Resolve isn't set.
+	Prefer MergePrefer
+
+	// Resolve, if set, is called for each conflict and returns the value to
+	// use. Returning nil removes the value from its table or list (later
+	// elements of a list move up, and the Paths of their conflicts are
+	// their positions in the merged list).
+	Resolve func(c MergeConflict) (interface{}, error)
+
+	// Lists is the strategy for lists, unless overridden for the list's
+	// path in ListPaths. Paths are the list's position in the Type, as JSON
+	// Pointers with list elements as "*" tokens (like SchemaChange.Path).
+	Lists     ListMerge
+	ListPaths map[string]ListMerge
+}
+
+// MergeConflict is a value which was changed differently on both sides.
+// Absent values are nil.
+type MergeConflict struct {
+	// Path is a JSON Pointer to the value in the merged document.
+	Path string
+
+	Base, Ours, Theirs interface{}
+}
+
+// mergeVal is a possibly absent value.
+type mergeVal struct {
+	val interface{}
+	ok  bool
+}
+
+type merger struct {
+	opts      *MergeOptions
+	conflicts []MergeConflict
+	er        error
+}
+
+// Merge does a three-way merge of ours and theirs, which were both derived
+// from base. Changes made on only one side are kept; values changed
+// differently on both sides (in tables and lists, recursively) are
+// conflicts, which are all returned and resolved according to opts (which
+// may be nil).
+//
+// ours and theirs must share the same Type, and the merged result must be
+// valid for it, or ErrSchema is returned. If conflicts aren't resolved,
+// ErrConflict is returned along with the conflicts.
+//
+// The merged MutableTable is a new document, marked dirty.
+func Merge(base *Table, ours, theirs *MutableTable, opts *MergeOptions) (*MutableTable, []MergeConflict, error) {
+	if ours.ty != theirs.ty {
+		return nil, nil, ErrSchema
+	}
+
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+
+	var decs [3]map[string]interface{}
+	for i, t := range []*Table{base, ours.Table, theirs.Table} {
+		dec, er := t.decode()
+		if er != nil {
+			return nil, nil, er
+		}
+		decs[i] = dec
+	}
+
+	m := &merger{opts: opts}
+	out := m.merge(ours.ty, "", "",
+		mergeVal{decs[0], true}, mergeVal{decs[1], true}, mergeVal{decs[2], true})
+
+	if m.er != nil {
+		return nil, m.conflicts, m.er
+	}
+
+	if len(m.conflicts) > 0 && opts.Resolve == nil && opts.Prefer == MergeFail {
+		return nil, m.conflicts, ErrConflict
+	}
+
+	tab, ok := deepCopy(out.val).(map[string]interface{})
+	if !ok || !ours.ty.IsValid(tab) {
+		return nil, m.conflicts, ErrSchema
+	}
+
+	t := &Table{decoded: tab}
+	t.markRewritten()
+	return t.AsUnsafe(ours.ty), m.conflicts, nil
+}
+
+// mergeEqual compares decoded values, treating all numeric types alike
+// (values that have been Set may be ints rather than float64s).
+func mergeEqual(a, b mergeVal) bool {
+	if a.ok != b.ok {
+		return false
+	}
+
+	return valueEqual(a.val, b.val)
+}
+
+func valueEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			v1, ok := bv[k]
+			if !ok || !valueEqual(v, v1) {
+				return false
+			}
+		}
+		return true
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valueEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if af, ok := toFloat64(a); ok {
+		bf, ok := toFloat64(b)
+		return ok && af == bf
+	}
+
+	return a == b
+}
+
+func (m *merger) merge(ty *Type, path, tyPath string, base, ours, theirs mergeVal) mergeVal {
+	ty = ty.deref()
+
+	switch {
+	case mergeEqual(ours, theirs), mergeEqual(base, theirs):
+		return ours
+	case mergeEqual(base, ours):
+		return theirs
+	}
+
+	// Both sides changed; see if the changes can be merged further down.
+	if base.ok && ours.ok && theirs.ok {
+		if ty.Kind == KindTable || ty.Kind == KindAny {
+			b, ok1 := base.val.(map[string]interface{})
+			o, ok2 := ours.val.(map[string]interface{})
+			t, ok3 := theirs.val.(map[string]interface{})
+			if ok1 && ok2 && ok3 {
+				return m.mergeTable(ty, path, tyPath, b, o, t)
+			}
+		}
+
+		if ty.Kind == KindList || ty.Kind == KindAny {
+			b, ok1 := base.val.([]interface{})
+			o, ok2 := ours.val.([]interface{})
+			t, ok3 := theirs.val.([]interface{})
+			if ok1 && ok2 && ok3 {
+				return m.mergeList(ty, path, tyPath, b, o, t)
+			}
+		}
+	}
+
+	return m.conflict(path, base, ours, theirs)
+}
+
+func (m *merger) conflict(path string, base, ours, theirs mergeVal) mergeVal {
+	c := MergeConflict{
+		Path:   path,
+		Base:   base.val,
+		Ours:   ours.val,
+		Theirs: theirs.val,
+	}
+	m.conflicts = append(m.conflicts, c)
+
+	if m.opts.Resolve != nil {
+		val, er := m.opts.Resolve(c)
+		if er != nil && m.er == nil {
+			m.er = er
+		}
+		return mergeVal{val, val != nil}
+	}
+
+	if m.opts.Prefer == MergeTheirs {
+		return theirs
+	}
+
+	return ours
+}
+
+func mergeField(ty *Type, key string) *Type {
+	if ty.Kind == KindTable {
+		if fty, ok := ty.Fields[key]; ok {
+			return fty
+		}
+	}
+
+	return TypeAny
+}
+
+func mergeElem(ty *Type) *Type {
+	if ty.Kind == KindList {
+		return ty.ListType
+	}
+
+	return TypeAny
+}
+
+func (m *merger) mergeTable(ty *Type, path, tyPath string, base, ours, theirs map[string]interface{}) mergeVal {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, t := range []map[string]interface{}{base, ours, theirs} {
+		for k := range t {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	out := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		var vals [3]mergeVal
+		for i, t := range []map[string]interface{}{base, ours, theirs} {
+			vals[i].val, vals[i].ok = t[k]
+		}
+
+		v := m.merge(mergeField(ty, k), pointerAppend(path, k), pointerAppend(tyPath, k), vals[0], vals[1], vals[2])
+		if v.ok {
+			out[k] = v.val
+		}
+	}
+
+	return mergeVal{out, true}
+}
+
+func (m *merger) listMerge(tyPath string) ListMerge {
+	if lm, ok := m.opts.ListPaths[tyPath]; ok {
+		return lm
+	}
+
+	return m.opts.Lists
+}
+
+func (m *merger) mergeList(ty *Type, path, tyPath string, base, ours, theirs []interface{}) mergeVal {
+	lm := m.listMerge(tyPath)
+	elemTy := mergeElem(ty)
+	elemPath := pointerAppend(tyPath, "*")
+
+	switch lm.Strategy {
+	case ListAppendUnion:
+		contains := func(l []interface{}, v interface{}) bool {
+			for _, v1 := range l {
+				if valueEqual(v, v1) {
+					return true
+				}
+			}
+			return false
+		}
+
+		var out []interface{}
+		for _, v := range ours {
+			// Drop elements they removed.
+			if contains(base, v) && !contains(theirs, v) {
+				continue
+			}
+			if !contains(out, v) {
+				out = append(out, v)
+			}
+		}
+		for _, v := range theirs {
+			if !contains(base, v) && !contains(out, v) {
+				out = append(out, v)
+			}
+		}
+		if out == nil {
+			out = []interface{}{}
+		}
+		return mergeVal{out, true}
+
+	case ListByKey:
+		return m.mergeListByKey(lm.KeyField, elemTy, path, elemPath, base, ours, theirs)
+	}
+
+	if len(base) != len(ours) || len(base) != len(theirs) {
+		return m.conflict(path, mergeVal{base, true}, mergeVal{ours, true}, mergeVal{theirs, true})
+	}
+
+	out := make([]interface{}, 0, len(base))
+	for i := range base {
+		v := m.merge(elemTy, pointerAppend(path, strconv.Itoa(len(out))), elemPath,
+			mergeVal{base[i], true}, mergeVal{ours[i], true}, mergeVal{theirs[i], true})
+		if v.ok {
+			out = append(out, v.val)
+		}
+	}
+
+	return mergeVal{out, true}
+}
+
+// mergeKeys indexes the elements of a list by key field. ok is false if any
+// element isn't a table with a unique key.
+func mergeKeys(field string, l []interface{}) (keys []string, byKey map[string]interface{}, ok bool) {
+	byKey = make(map[string]interface{}, len(l))
+	for _, v := range l {
+		t, isTable := v.(map[string]interface{})
+		if !isTable {
+			return nil, nil, false
+		}
+
+		kv, has := t[field]
+		if !has {
+			return nil, nil, false
+		}
+
+		bs, er := json.Marshal(kv)
+		if er != nil {
+			return nil, nil, false
+		}
+
+		k := string(bs)
+		if _, dup := byKey[k]; dup {
+			return nil, nil, false
+		}
+
+		keys = append(keys, k)
+		byKey[k] = v
+	}
+
+	return keys, byKey, true
+}
+
+func (m *merger) mergeListByKey(field string, elemTy *Type, path, elemPath string, base, ours, theirs []interface{}) mergeVal {
+	_, b, ok1 := mergeKeys(field, base)
+	oKeys, o, ok2 := mergeKeys(field, ours)
+	tKeys, t, ok3 := mergeKeys(field, theirs)
+	if !ok1 || !ok2 || !ok3 {
+		return m.conflict(path, mergeVal{base, true}, mergeVal{ours, true}, mergeVal{theirs, true})
+	}
+
+	// Our order, followed by elements only they have.
+	keys := oKeys
+	for _, k := range tKeys {
+		if _, ok := o[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	out := []interface{}{}
+	for _, k := range keys {
+		var vals [3]mergeVal
+		for i, l := range []map[string]interface{}{b, o, t} {
+			vals[i].val, vals[i].ok = l[k]
+		}
+
+		// Elements removed on both sides (or added on one and removed on
+		// the other) don't show up in keys.
+		v := m.merge(elemTy, pointerAppend(path, strconv.Itoa(len(out))), elemPath, vals[0], vals[1], vals[2])
+		if v.ok {
+			out = append(out, v.val)
+		}
+	}
+
+	return mergeVal{out, true}
+}
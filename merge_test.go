@@ -0,0 +1,195 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testMergeType = NewTableType(TableDef{
+	"name":  TypeString,
+	"age":   TypeNumber,
+	"tags":  TypeStringList,
+	"extra": TypeAny,
+	"items": NewListType(NewTableType(TableDef{
+		"id":  TypeNumber,
+		"qty": TypeNumber,
+	}), -1),
+})
+
+func testMergeTables(t *testing.T, base, ours, theirs string) (*Table, *MutableTable, *MutableTable) {
+	var tabs [3]Table
+	for i, src := range []string{base, ours, theirs} {
+		if er := tabs[i].Scan(src); er != nil {
+			t.Fatal(er)
+		}
+	}
+
+	o, er := tabs[1].As(testMergeType)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	th, er := tabs[2].As(testMergeType)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	return &tabs[0], o, th
+}
+
+func testMergeResult(t *testing.T, mt *MutableTable, expected string) {
+	var exp interface{}
+	if er := json.Unmarshal([]byte(expected), &exp); er != nil {
+		t.Fatal(er)
+	}
+
+	bs, er := mt.MarshalJSON()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var got interface{}
+	if er := json.Unmarshal(bs, &got); er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %s\nexpected %s", bs, expected)
+	}
+}
+
+func TestMergeClean(t *testing.T) {
+	base, ours, theirs := testMergeTables(t,
+		`{"name": "ada", "age": 36, "extra": {"a": 1, "b": 2}}`,
+		`{"name": "ada lovelace", "age": 36, "extra": {"a": 10, "b": 2}}`,
+		`{"name": "ada", "age": 37, "extra": {"a": 1}, "tags": ["x"]}`)
+
+	mt, conflicts, er := Merge(base, ours, theirs, nil)
+	if er != nil {
+		t.Fatal(er, conflicts)
+	}
+
+	testMergeResult(t, mt, `{"name": "ada lovelace", "age": 37, "extra": {"a": 10}, "tags": ["x"]}`)
+
+	if !mt.Dirty() {
+		t.Errorf("merged table isn't dirty")
+	}
+}
+
+func TestMergeConflicts(t *testing.T) {
+	base, ours, theirs := testMergeTables(t,
+		`{"name": "ada", "age": 36, "extra": {"a": 1}}`,
+		`{"name": "bob", "age": 37, "extra": {"a": 2}}`,
+		`{"name": "eve", "age": 37, "extra": {"a": 3}}`)
+
+	_, conflicts, er := Merge(base, ours, theirs, nil)
+	if er != ErrConflict {
+		t.Fatalf("got %v, expected ErrConflict", er)
+	}
+
+	expected := []MergeConflict{
+		{"/extra/a", float64(1), float64(2), float64(3)},
+		{"/name", "ada", "bob", "eve"},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("got %#v", conflicts)
+	}
+
+	mt, _, er := Merge(base, ours, theirs, &MergeOptions{Prefer: MergeTheirs})
+	if er != nil {
+		t.Fatal(er)
+	}
+	testMergeResult(t, mt, `{"name": "eve", "age": 37, "extra": {"a": 3}}`)
+
+	mt, _, er = Merge(base, ours, theirs, &MergeOptions{
+		Resolve: func(c MergeConflict) (interface{}, error) {
+			if c.Path == "/name" {
+				return "bob & eve", nil
+			}
+			return nil, nil
+		},
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+	testMergeResult(t, mt, `{"name": "bob & eve", "age": 37, "extra": {}}`)
+
+	// Resolutions still have to match the Type.
+	_, _, er = Merge(base, ours, theirs, &MergeOptions{
+		Resolve: func(c MergeConflict) (interface{}, error) {
+			return 1, nil
+		},
+	})
+	if er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	base, ours, theirs := testMergeTables(t,
+		`{"tags": ["a", "b", "c"], "items": [{"id": 1, "qty": 1}, {"id": 2, "qty": 1}, {"id": 3, "qty": 1}]}`,
+		`{"tags": ["a", "c", "d"], "items": [{"id": 2, "qty": 5}, {"id": 1, "qty": 1}, {"id": 3, "qty": 1}, {"id": 4, "qty": 1}]}`,
+		`{"tags": ["a", "b", "e"], "items": [{"id": 1, "qty": 1}, {"id": 2, "qty": 1}, {"id": 5, "qty": 1}]}`)
+
+	// By index, lists whose lengths changed conflict.
+	_, conflicts, er := Merge(base, ours, theirs, nil)
+	if er != ErrConflict || len(conflicts) != 2 || conflicts[0].Path != "/items" {
+		t.Fatalf("got %v, %#v", er, conflicts)
+	}
+
+	mt, _, er := Merge(base, ours, theirs, &MergeOptions{
+		Lists: ListMerge{Strategy: ListAppendUnion},
+		ListPaths: map[string]ListMerge{
+			"/items": {Strategy: ListByKey, KeyField: "id"},
+		},
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testMergeResult(t, mt, `{
+		"tags": ["a", "d", "e"],
+		"items": [{"id": 2, "qty": 5}, {"id": 1, "qty": 1}, {"id": 4, "qty": 1}, {"id": 5, "qty": 1}]
+	}`)
+}
+
+func TestMergeByIndex(t *testing.T) {
+	base, ours, theirs := testMergeTables(t,
+		`{"items": [{"id": 1, "qty": 1}, {"id": 2, "qty": 1}]}`,
+		`{"items": [{"id": 1, "qty": 2}, {"id": 2, "qty": 1}]}`,
+		`{"items": [{"id": 1, "qty": 1}, {"id": 2, "qty": 3}]}`)
+
+	mt, _, er := Merge(base, ours, theirs, nil)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testMergeResult(t, mt, `{"items": [{"id": 1, "qty": 2}, {"id": 2, "qty": 3}]}`)
+}
+
+func TestMergeByIndexRemove(t *testing.T) {
+	base, ours, theirs := testMergeTables(t,
+		`{"tags": ["a", "b", "c"]}`,
+		`{"tags": ["x", "b", "y"]}`,
+		`{"tags": ["z", "b", "w"]}`)
+
+	// Resolving an element to nil drops it from the list.
+	mt, conflicts, er := Merge(base, ours, theirs, &MergeOptions{
+		Resolve: func(c MergeConflict) (interface{}, error) {
+			if c.Base == "a" {
+				return nil, nil
+			}
+			return c.Ours, nil
+		},
+	})
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	testMergeResult(t, mt, `{"tags": ["b", "y"]}`)
+
+	if len(conflicts) != 2 || conflicts[0].Path != "/tags/0" || conflicts[1].Path != "/tags/1" {
+		t.Errorf("got %#v", conflicts)
+	}
+}
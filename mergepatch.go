@@ -0,0 +1,194 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// mergePatch applies an RFC 7386 merge patch to target (which is modified
+// in place where possible) and returns the result.
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return deepCopy(patch)
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+func decodeMergePatch(bs []byte) (map[string]interface{}, error) {
+	var patch interface{}
+	if er := json.Unmarshal(bs, &patch); er != nil {
+		return nil, er
+	}
+
+	// NB: Anything other than an object would replace the whole document,
+	// which can't be a table.
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, ErrSchema
+	}
+
+	return p, nil
+}
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch (in which objects are
+// merged recursively and null removes keys) to the MutableTable. If the
+// patched document isn't valid for the Table's Type, ErrSchema is returned
+// and the Table is left unchanged.
+func (mt *MutableTable) ApplyMergePatch(patch []byte) error {
+	p, er := decodeMergePatch(patch)
+	if er != nil {
+		return er
+	}
+
+	dec, er := mt.decode()
+	if er != nil {
+		return er
+	}
+
+	out := mergePatch(deepCopy(dec), p).(map[string]interface{})
+	if !mt.ty.validTypes(out) {
+		return ErrSchema
+	}
+
+	return mt.update(dec, out, diffEvents(dec, out))
+}
+
+// MergePatchSQL returns an SQL expression which applies an RFC 7386 JSON
+// Merge Patch to the jsonb column, for use as "SET column = expr", along
+// with its arguments (numbered from argOffset+1, as with Where.SQL).
+//
+// Top-level keys are merged with ||, removed with - and nested objects are
+// merged by rebuilding them with jsonb_build_object, so only the keys in
+// the patch are touched even if the document has changed concurrently. As
+// the document isn't known, the patch is checked against ty key by key:
+// ErrSchema is returned for keys or values ty doesn't allow.
+func (ty *Type) MergePatchSQL(column string, patch []byte, argOffset int) (string, []interface{}, error) {
+	p, er := decodeMergePatch(patch)
+	if er != nil {
+		return "", nil, er
+	}
+
+	if !ty.validMergePatch(p) {
+		return "", nil, ErrSchema
+	}
+
+	var args []interface{}
+	col := quoteIdent(column)
+	expr, er := mergePatchExpr(fmt.Sprintf("COALESCE(%s, '{}'::jsonb)", col), p, argOffset, &args)
+	if er != nil {
+		return "", nil, er
+	}
+
+	return expr, args, nil
+}
+
+// validMergePatch returns true if the object patch p can be applied to
+// values of type ty without making them invalid.
+func (ty *Type) validMergePatch(p map[string]interface{}) bool {
+	ty = ty.deref()
+
+	switch ty.Kind {
+	case KindAny:
+		return true
+	case KindTable:
+	default:
+		return false
+	}
+
+	for k, v := range p {
+		fty, ok := ty.Fields[k]
+		if !ok {
+			return false
+		}
+
+		switch v := v.(type) {
+		case nil:
+		case map[string]interface{}:
+			if !fty.validMergePatch(v) {
+				return false
+			}
+		default:
+			if !fty.IsValid(v) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func mergePatchExpr(target string, p map[string]interface{}, argOffset int, args *[]interface{}) (string, error) {
+	keys := make([]string, 0, len(p))
+	for k := range p {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var (
+		removes []string
+		nested  []string
+		sets    = make(map[string]interface{})
+	)
+
+	for _, k := range keys {
+		switch v := p[k].(type) {
+		case nil:
+			removes = append(removes, quoteLiteral(k))
+
+		case map[string]interface{}:
+			// RFC 7386 replaces non-objects with {} before merging.
+			sub := fmt.Sprintf("(%s -> %s)", target, quoteLiteral(k))
+			sub = fmt.Sprintf("CASE WHEN jsonb_typeof%s = 'object' THEN %s ELSE '{}'::jsonb END", sub, sub)
+
+			expr, er := mergePatchExpr(sub, v, argOffset, args)
+			if er != nil {
+				return "", er
+			}
+			nested = append(nested, quoteLiteral(k), expr)
+
+		default:
+			sets[k] = v
+		}
+	}
+
+	parts := []string{target}
+
+	if len(sets) > 0 {
+		bs, er := json.Marshal(sets)
+		if er != nil {
+			return "", er
+		}
+
+		*args = append(*args, string(bs))
+		parts = append(parts, "$"+strconv.Itoa(argOffset+len(*args))+"::jsonb")
+	}
+
+	if len(nested) > 0 {
+		parts = append(parts, "jsonb_build_object("+strings.Join(nested, ", ")+")")
+	}
+
+	expr := "(" + strings.Join(parts, " || ") + ")"
+	if len(removes) > 0 {
+		expr = fmt.Sprintf("(%s - ARRAY[%s]::text[])", expr, strings.Join(removes, ", "))
+	}
+
+	return expr, nil
+}
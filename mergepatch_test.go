@@ -0,0 +1,146 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergePatchRFC(t *testing.T) {
+	// From RFC 7386, appendix A.
+	tests := []struct{ target, patch, result string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		var target, patch, expected interface{}
+		json.Unmarshal([]byte(test.target), &target)
+		json.Unmarshal([]byte(test.patch), &patch)
+		json.Unmarshal([]byte(test.result), &expected)
+
+		if got := mergePatch(target, patch); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s + %s: got %#v, expected %s", test.target, test.patch, got, test.result)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada", "age": 36, "extra": {"a": 1, "b": 2}}`)
+
+	if er := mt.ApplyMergePatch([]byte(`{"nick": "al", "extra": {"a": null, "c": 3}}`)); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{
+		"name":  "ada",
+		"nick":  "al",
+		"age":   float64(36),
+		"extra": map[string]interface{}{"b": float64(2), "c": float64(3)},
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	if full, patch, _ := mt.changes(); full || len(patch) != 2 {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+
+	if er := mt.ApplyMergePatch([]byte(`{"age": null}`)); er != nil {
+		t.Fatal(er)
+	}
+
+	if full, _, _ := mt.changes(); !full {
+		t.Errorf("removing a top-level key should rewrite the document")
+	}
+}
+
+func TestApplyMergePatchErrors(t *testing.T) {
+	tests := []string{
+		`{"name": "eve", "age": "old"}`,
+		`{"name": "eve", "tags": [1]}`,
+		`{"name": "eve", "nope": 1}`,
+		`{"name": "eve", "tags": {"a": "b"}}`,
+		`["eve"]`,
+		`null`,
+	}
+
+	for _, test := range tests {
+		mt := testPatchTable(t, `{"name": "ada", "tags": ["a"]}`)
+
+		if er := mt.ApplyMergePatch([]byte(test)); er != ErrSchema {
+			t.Errorf("%s: got %v, expected ErrSchema", test, er)
+		}
+
+		if dec, _ := mt.decode(); dec["name"] != "ada" || mt.Dirty() {
+			t.Errorf("%s: table changed: %#v", test, dec)
+		}
+	}
+}
+
+func TestMergePatchSQL(t *testing.T) {
+	expr, args, er := testPatchType.MergePatchSQL("doc", []byte(`{"name": "ada", "age": null, "extra": {"a": {"b": 1}, "c": null}}`), 2)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	extra := `CASE WHEN jsonb_typeof(COALESCE("doc", '{}'::jsonb) -> 'extra') = 'object' THEN (COALESCE("doc", '{}'::jsonb) -> 'extra') ELSE '{}'::jsonb END`
+	a := `CASE WHEN jsonb_typeof(` + extra + ` -> 'a') = 'object' THEN (` + extra + ` -> 'a') ELSE '{}'::jsonb END`
+	expected := `((COALESCE("doc", '{}'::jsonb) || $4::jsonb || jsonb_build_object('extra', ((` + extra +
+		` || jsonb_build_object('a', (` + a + ` || $3::jsonb))) - ARRAY['c']::text[]))) - ARRAY['age']::text[])`
+	if expr != expected {
+		t.Errorf("got\n%s\nexpected\n%s", expr, expected)
+	}
+
+	if !reflect.DeepEqual(args, []interface{}{`{"b":1}`, `{"name":"ada"}`}) {
+		t.Errorf("got args %v", args)
+	}
+
+	for _, bad := range []string{`{"nope": 1}`, `{"age": "x"}`, `{"tags": {"a": 1}}`, `[]`} {
+		if _, _, er := testPatchType.MergePatchSQL("doc", []byte(bad), 0); er != ErrSchema {
+			t.Errorf("%s: got %v, expected ErrSchema", bad, er)
+		}
+	}
+}
+
+func TestMergePatchSQLDb(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+
+	src := `{"name": "ada", "age": 36, "extra": {"a": 1, "b": {"c": 2}, "d": "x"}}`
+	patch := []byte(`{"nick": "al", "age": null, "extra": {"a": null, "b": {"e": 3}, "d": {"f": true}}}`)
+
+	expr, args, er := testPatchType.MergePatchSQL("doc", patch, 1)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var got Table
+	args = append([]interface{}{src}, args...)
+	if er := db.QueryRow(`SELECT `+expr+` FROM (SELECT $1::jsonb AS doc) t`, args...).Scan(&got); er != nil {
+		t.Fatal(er)
+	}
+
+	mt := testPatchTable(t, src)
+	if er := mt.ApplyMergePatch(patch); er != nil {
+		t.Fatal(er)
+	}
+
+	dec, _ := got.decode()
+	exp, _ := mt.decode()
+	if !valueEqual(dec, exp) {
+		t.Errorf("got %#v, expected %#v", dec, exp)
+	}
+}
@@ -0,0 +1,118 @@
+package jsonb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+)
+
+// NullTable is a Table that may be SQL NULL, in the style of sql.NullString.
+// Valid is false for NULL.
+//
+// NOTE: SQL NULL isn't the same as the jsonb value 'null' (which isn't a
+// table, so scanning it is still an error) or '{}'. The distinction is lost
+// when marshaling to JSON, where an invalid NullTable is encoded as null.
+type NullTable struct {
+	Table Table
+	Valid bool
+}
+
+// NullList is the List equivalent of NullTable.
+type NullList struct {
+	List  List
+	Valid bool
+}
+
+var _ sql.Scanner = &NullTable{}
+var _ driver.Valuer = &NullTable{}
+var _ sql.Scanner = &NullList{}
+var _ driver.Valuer = NullList{}
+
+var jsonNull = []byte("null")
+
+func (nt *NullTable) Scan(src interface{}) error {
+	if src == nil {
+		nt.Table, nt.Valid = Table{}, false
+		return nil
+	}
+
+	if er := nt.Table.Scan(src); er != nil {
+		return er
+	}
+
+	nt.Valid = true
+	return nil
+}
+
+func (nt *NullTable) Value() (driver.Value, error) {
+	if !nt.Valid {
+		return nil, nil
+	}
+
+	return nt.Table.Value()
+}
+
+func (nt *NullTable) MarshalJSON() ([]byte, error) {
+	if !nt.Valid {
+		return jsonNull, nil
+	}
+
+	return nt.Table.MarshalJSON()
+}
+
+func (nt *NullTable) UnmarshalJSON(bs []byte) error {
+	if string(bs) == "null" {
+		nt.Table, nt.Valid = Table{}, false
+		return nil
+	}
+
+	if er := nt.Table.UnmarshalJSON(bs); er != nil {
+		return er
+	}
+
+	nt.Valid = true
+	return nil
+}
+
+func (nl *NullList) Scan(src interface{}) error {
+	if src == nil {
+		nl.List, nl.Valid = List{}, false
+		return nil
+	}
+
+	if er := nl.List.Scan(src); er != nil {
+		return er
+	}
+
+	nl.Valid = true
+	return nil
+}
+
+func (nl NullList) Value() (driver.Value, error) {
+	if !nl.Valid {
+		return nil, nil
+	}
+
+	return nl.List.Value()
+}
+
+func (nl *NullList) MarshalJSON() ([]byte, error) {
+	if !nl.Valid {
+		return jsonNull, nil
+	}
+
+	return nl.List.MarshalJSON()
+}
+
+func (nl *NullList) UnmarshalJSON(bs []byte) error {
+	if string(bs) == "null" {
+		nl.List, nl.Valid = List{}, false
+		return nil
+	}
+
+	if er := nl.List.UnmarshalJSON(bs); er != nil {
+		return er
+	}
+
+	nl.Valid = true
+	return nil
+}
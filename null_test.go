@@ -0,0 +1,108 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNullTableScan(t *testing.T) {
+	var nt NullTable
+
+	if er := nt.Scan([]byte(`{"a":1}`)); er != nil || !nt.Valid {
+		t.Fatalf("got %v, valid %v", er, nt.Valid)
+	}
+
+	if er := nt.Scan(nil); er != nil || nt.Valid {
+		t.Fatalf("got %v, valid %v", er, nt.Valid)
+	}
+
+	if val, er := nt.Value(); er != nil || val != nil {
+		t.Errorf("Value: got %v, %v", val, er)
+	}
+
+	// jsonb 'null' isn't SQL NULL.
+	if er := nt.Scan([]byte(`null`)); er != ErrInvalidJsonType {
+		t.Errorf("got %v, expected ErrInvalidJsonType", er)
+	}
+
+	if er := nt.Scan([]byte(`{}`)); er != nil || !nt.Valid {
+		t.Fatalf("got %v, valid %v", er, nt.Valid)
+	}
+
+	if val, er := nt.Value(); er != nil || string(val.([]byte)) != `{}` {
+		t.Errorf("Value: got %v, %v", val, er)
+	}
+}
+
+func TestNullListScan(t *testing.T) {
+	var nl NullList
+
+	if er := nl.Scan(`[]`); er != nil || !nl.Valid {
+		t.Fatalf("got %v, valid %v", er, nl.Valid)
+	}
+
+	if val, er := nl.Value(); er != nil || string(val.([]byte)) != `[]` {
+		t.Errorf("Value: got %v, %v", val, er)
+	}
+
+	if er := nl.Scan(nil); er != nil || nl.Valid {
+		t.Fatalf("got %v, valid %v", er, nl.Valid)
+	}
+
+	if val, er := nl.Value(); er != nil || val != nil {
+		t.Errorf("Value: got %v, %v", val, er)
+	}
+}
+
+func TestNullJSON(t *testing.T) {
+	var s struct {
+		T NullTable `json:"t"`
+		L NullList  `json:"l"`
+	}
+
+	if er := json.Unmarshal([]byte(`{"t":null,"l":[1]}`), &s); er != nil {
+		t.Fatal(er)
+	}
+
+	if s.T.Valid || !s.L.Valid {
+		t.Errorf("got %v, %v", s.T.Valid, s.L.Valid)
+	}
+
+	bs, er := json.Marshal(&s)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if string(bs) != `{"t":null,"l":[1]}` {
+		t.Errorf("got %s", bs)
+	}
+}
+
+func TestNullRoundTrip(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+
+	var (
+		null  NullTable
+		empty = NullTable{Valid: true}
+		nl    NullList
+	)
+	if er := empty.Table.Scan([]byte(`{}`)); er != nil {
+		t.Fatal(er)
+	}
+
+	var (
+		gotNull, gotEmpty NullTable
+		gotList           NullList
+	)
+
+	er := db.QueryRow(`SELECT $1::jsonb, $2::jsonb, $3::jsonb`, &null, &empty, nl).
+		Scan(&gotNull, &gotEmpty, &gotList)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if gotNull.Valid || !gotEmpty.Valid || gotList.Valid {
+		t.Errorf("got %v, %v, %v", gotNull.Valid, gotEmpty.Valid, gotList.Valid)
+	}
+}
@@ -0,0 +1,419 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is a single RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	// Op is one of add, remove, replace, move, copy or test.
+	Op string `json:"op"`
+
+	// Path, and From for move and copy, are JSON Pointers.
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+
+	// Value is used by add, replace and test.
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Patch is an RFC 6902 JSON Patch. It marshals to (and from) the standard
+// JSON representation.
+type Patch []PatchOp
+
+func (op PatchOp) MarshalJSON() ([]byte, error) {
+	// NB: value has to be present for add/replace/test even when it's null,
+	// which omitempty can't do.
+	type opNoValue struct {
+		Op   string `json:"op"`
+		Path string `json:"path"`
+		From string `json:"from,omitempty"`
+	}
+	type opValue struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		return json.Marshal(opValue{op.Op, op.Path, op.Value})
+	}
+
+	return json.Marshal(opNoValue{op.Op, op.Path, op.From})
+}
+
+// DiffTables returns a Patch which turns a into b.
+func DiffTables(a, b *Table) (Patch, error) {
+	ad, er := a.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	bd, er := b.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	var p Patch
+	diffValues("", ad, bd, &p)
+	return p, nil
+}
+
+// DiffLists returns a Patch which turns a into b.
+func DiffLists(a, b *List) (Patch, error) {
+	ad, er := a.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	bd, er := b.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	var p Patch
+	diffValues("", ad, bd, &p)
+	return p, nil
+}
+
+func diffValues(path string, a, b interface{}, p *Patch) {
+	if valueEqual(a, b) {
+		return
+	}
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			v1, ok1 := av[k]
+			v2, ok2 := bv[k]
+
+			switch {
+			case !ok2:
+				*p = append(*p, PatchOp{Op: "remove", Path: pointerAppend(path, k)})
+			case !ok1:
+				*p = append(*p, PatchOp{Op: "add", Path: pointerAppend(path, k), Value: deepCopy(v2)})
+			default:
+				diffValues(pointerAppend(path, k), v1, v2, p)
+			}
+		}
+		return
+
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+
+		n := len(av)
+		if len(bv) < n {
+			n = len(bv)
+		}
+
+		for i := 0; i < n; i++ {
+			diffValues(pointerAppend(path, strconv.Itoa(i)), av[i], bv[i], p)
+		}
+
+		// Removals go from the end so indices stay valid.
+		for i := len(av) - 1; i >= n; i-- {
+			*p = append(*p, PatchOp{Op: "remove", Path: pointerAppend(path, strconv.Itoa(i))})
+		}
+		for i := n; i < len(bv); i++ {
+			*p = append(*p, PatchOp{Op: "add", Path: pointerAppend(path, strconv.Itoa(i)), Value: deepCopy(bv[i])})
+		}
+		return
+	}
+
+	*p = append(*p, PatchOp{Op: "replace", Path: path, Value: deepCopy(b)})
+}
+
+// ApplyPatch applies p to the MutableTable. The document is validated
+// against the Table's Type after every operation; if any operation fails
+// (including a failed test), the Table is left unchanged.
+//
+// ErrPatchPath is returned for paths that don't exist, ErrPatchTest for
+// failed tests, ErrPatchOp for invalid operations and ErrSchema for
+// operations which leave the document invalid.
+func (mt *MutableTable) ApplyPatch(p Patch) error {
+	dec, er := mt.decode()
+	if er != nil {
+		return er
+	}
+
+	out, er := applyPatch(mt.ty, dec, p)
+	if er != nil {
+		return er
+	}
+
+	tab, ok := out.(map[string]interface{})
+	if !ok {
+		return ErrSchema
+	}
+
+	return mt.update(dec, tab, diffEvents(dec, tab))
+}
+
+// ApplyPatch applies p to the MutableList (see MutableTable.ApplyPatch).
+func (ml *MutableList) ApplyPatch(p Patch) error {
+	dec, er := ml.decode()
+	if er != nil {
+		return er
+	}
+
+	out, er := applyPatch(ml.ty, dec, p)
+	if er != nil {
+		return er
+	}
+
+	lst, ok := out.([]interface{})
+	if !ok {
+		return ErrSchema
+	}
+
+	return ml.update(dec, lst, diffEvents(dec, lst), nil, nil)
+}
+
+func applyPatch(ty *Type, doc interface{}, p Patch) (interface{}, error) {
+	doc = deepCopy(doc)
+
+	for _, op := range p {
+		var er error
+		if doc, er = applyPatchOp(doc, op); er != nil {
+			return nil, er
+		}
+
+		if !ty.validTypes(doc) {
+			return nil, ErrSchema
+		}
+	}
+
+	return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op PatchOp) (interface{}, error) {
+	toks, er := pointerTokens(op.Path)
+	if er != nil {
+		return nil, er
+	}
+
+	switch op.Op {
+	case "add":
+		return patchAdd(doc, toks, deepCopy(op.Value))
+
+	case "remove":
+		out, _, er := patchRemove(doc, toks)
+		return out, er
+
+	case "replace":
+		if len(toks) == 0 {
+			return deepCopy(op.Value), nil
+		}
+
+		return patchParent(doc, toks, func(parent interface{}, last string) (interface{}, error) {
+			switch p := parent.(type) {
+			case map[string]interface{}:
+				if _, ok := p[last]; !ok {
+					return nil, ErrPatchPath
+				}
+				p[last] = deepCopy(op.Value)
+				return p, nil
+
+			case []interface{}:
+				i, ok := listIndex(last)
+				if !ok || i >= len(p) {
+					return nil, ErrPatchPath
+				}
+				p[i] = deepCopy(op.Value)
+				return p, nil
+			}
+			return nil, ErrPatchPath
+		})
+
+	case "move", "copy":
+		from, er := pointerTokens(op.From)
+		if er != nil {
+			return nil, er
+		}
+
+		if op.Op == "copy" {
+			val, er := patchGet(doc, from)
+			if er != nil {
+				return nil, er
+			}
+			return patchAdd(doc, toks, deepCopy(val))
+		}
+
+		// A value can't be moved into itself.
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, ErrPatchOp
+		}
+
+		doc, val, er := patchRemove(doc, from)
+		if er != nil {
+			return nil, er
+		}
+		return patchAdd(doc, toks, val)
+
+	case "test":
+		val, er := patchGet(doc, toks)
+		if er != nil {
+			return nil, er
+		}
+
+		if !valueEqual(val, op.Value) {
+			return nil, ErrPatchTest
+		}
+		return doc, nil
+	}
+
+	return nil, ErrPatchOp
+}
+
+// patchParent calls fn on the parent of the value at toks (which mustn't be
+// empty), replacing the parent with its result.
+func patchParent(doc interface{}, toks []string, fn func(parent interface{}, last string) (interface{}, error)) (interface{}, error) {
+	if len(toks) == 1 {
+		return fn(doc, toks[0])
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		child, ok := d[toks[0]]
+		if !ok {
+			return nil, ErrPatchPath
+		}
+
+		child, er := patchParent(child, toks[1:], fn)
+		if er != nil {
+			return nil, er
+		}
+		d[toks[0]] = child
+		return d, nil
+
+	case []interface{}:
+		i, ok := listIndex(toks[0])
+		if !ok || i >= len(d) {
+			return nil, ErrPatchPath
+		}
+
+		child, er := patchParent(d[i], toks[1:], fn)
+		if er != nil {
+			return nil, er
+		}
+		d[i] = child
+		return d, nil
+	}
+
+	return nil, ErrPatchPath
+}
+
+func patchGet(doc interface{}, toks []string) (interface{}, error) {
+	for _, tok := range toks {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[tok]
+			if !ok {
+				return nil, ErrPatchPath
+			}
+			doc = v
+
+		case []interface{}:
+			i, ok := listIndex(tok)
+			if !ok || i >= len(d) {
+				return nil, ErrPatchPath
+			}
+			doc = d[i]
+
+		default:
+			return nil, ErrPatchPath
+		}
+	}
+
+	return doc, nil
+}
+
+func patchAdd(doc interface{}, toks []string, val interface{}) (interface{}, error) {
+	if len(toks) == 0 {
+		return val, nil
+	}
+
+	return patchParent(doc, toks, func(parent interface{}, last string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			p[last] = val
+			return p, nil
+
+		case []interface{}:
+			if last == "-" {
+				return append(p, val), nil
+			}
+
+			i, ok := listIndex(last)
+			if !ok || i > len(p) {
+				return nil, ErrPatchPath
+			}
+
+			out := make([]interface{}, 0, len(p)+1)
+			out = append(out, p[:i]...)
+			out = append(out, val)
+			return append(out, p[i:]...), nil
+		}
+
+		return nil, ErrPatchPath
+	})
+}
+
+// patchRemove removes the value at toks, returning the new document and
+// the removed value.
+func patchRemove(doc interface{}, toks []string) (out, removed interface{}, er error) {
+	if len(toks) == 0 {
+		return nil, nil, ErrPatchPath
+	}
+
+	out, er = patchParent(doc, toks, func(parent interface{}, last string) (interface{}, error) {
+		switch p := parent.(type) {
+		case map[string]interface{}:
+			v, ok := p[last]
+			if !ok {
+				return nil, ErrPatchPath
+			}
+			removed = v
+			delete(p, last)
+			return p, nil
+
+		case []interface{}:
+			i, ok := listIndex(last)
+			if !ok || i >= len(p) {
+				return nil, ErrPatchPath
+			}
+			removed = p[i]
+
+			out := make([]interface{}, 0, len(p)-1)
+			out = append(out, p[:i]...)
+			return append(out, p[i+1:]...), nil
+		}
+
+		return nil, ErrPatchPath
+	})
+
+	return out, removed, er
+}
@@ -0,0 +1,173 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testPatchType = NewTableType(TableDef{
+	"name":  TypeString,
+	"nick":  TypeString,
+	"age":   TypeNumber,
+	"tags":  TypeStringList,
+	"extra": TypeAny,
+})
+
+func testPatchTable(t *testing.T, src string) *MutableTable {
+	var tab Table
+	if er := tab.Scan(src); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(testPatchType)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	return mt
+}
+
+func TestDiffTables(t *testing.T) {
+	a := testPatchTable(t, `{"name": "ada", "age": 36, "tags": ["a", "b", "c"], "extra": {"x": 1}}`)
+	b := testPatchTable(t, `{"name": "ada", "nick": "al", "tags": ["a", "d"], "extra": {"x": 2, "y": null}}`)
+
+	p, er := DiffTables(a.Table, b.Table)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	bs, er := json.Marshal(p)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := `[{"op":"remove","path":"/age"},` +
+		`{"op":"replace","path":"/extra/x","value":2},` +
+		`{"op":"add","path":"/extra/y","value":null},` +
+		`{"op":"add","path":"/nick","value":"al"},` +
+		`{"op":"replace","path":"/tags/1","value":"d"},` +
+		`{"op":"remove","path":"/tags/2"}]`
+	if string(bs) != expected {
+		t.Errorf("got\n%s\nexpected\n%s", bs, expected)
+	}
+
+	// Applying the diff gets back to b.
+	if er := a.ApplyPatch(p); er != nil {
+		t.Fatal(er)
+	}
+
+	if p, _ := DiffTables(a.Table, b.Table); len(p) != 0 {
+		t.Errorf("still different: %v", p)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	var p Patch
+	er := json.Unmarshal([]byte(`[
+		{"op": "test", "path": "/name", "value": "ada"},
+		{"op": "add", "path": "/tags/-", "value": "c"},
+		{"op": "add", "path": "/tags/0", "value": "z"},
+		{"op": "copy", "from": "/name", "path": "/nick"},
+		{"op": "move", "from": "/extra/a", "path": "/extra/b"},
+		{"op": "replace", "path": "/age", "value": 37}
+	]`), &p)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	mt := testPatchTable(t, `{"name": "ada", "age": 36, "tags": ["a", "b"], "extra": {"a": 1}}`)
+	if er := mt.ApplyPatch(p); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{
+		"name":  "ada",
+		"nick":  "ada",
+		"age":   float64(37),
+		"tags":  []interface{}{"z", "a", "b", "c"},
+		"extra": map[string]interface{}{"b": float64(1)},
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+
+	full, patch, _ := mt.changes()
+	if full || len(patch) != 4 {
+		t.Errorf("got full %v, patch %v", full, patch)
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	src := `{"name": "ada", "tags": ["a"]}`
+
+	tests := []struct {
+		op PatchOp
+		er error
+	}{
+		{PatchOp{Op: "test", Path: "/name", Value: "bob"}, ErrPatchTest},
+		{PatchOp{Op: "remove", Path: "/age"}, ErrPatchPath},
+		{PatchOp{Op: "replace", Path: "/tags/1", Value: "b"}, ErrPatchPath},
+		{PatchOp{Op: "add", Path: "/tags/2", Value: "b"}, ErrPatchPath},
+		{PatchOp{Op: "add", Path: "/tags/0", Value: 1}, ErrSchema},
+		{PatchOp{Op: "add", Path: "/nope", Value: 1}, ErrSchema},
+		{PatchOp{Op: "move", From: "/tags", Path: "/tags/0"}, ErrPatchOp},
+		{PatchOp{Op: "frob", Path: "/name"}, ErrPatchOp},
+		{PatchOp{Op: "add", Path: "name", Value: "x"}, ErrInvalidPointer},
+	}
+
+	for _, test := range tests {
+		mt := testPatchTable(t, src)
+
+		// The first op succeeds, but the Table is unchanged if a later one
+		// fails.
+		p := Patch{{Op: "replace", Path: "/name", Value: "eve"}, test.op}
+		if er := mt.ApplyPatch(p); er != test.er {
+			t.Errorf("%v: got %v, expected %v", test.op, er, test.er)
+		}
+
+		if dec, _ := mt.decode(); dec["name"] != "ada" || mt.Dirty() {
+			t.Errorf("%v: table changed: %#v", test.op, dec)
+		}
+	}
+}
+
+func TestApplyPatchRemoveRewrites(t *testing.T) {
+	mt := testPatchTable(t, `{"name": "ada", "age": 36}`)
+
+	if er := mt.ApplyPatch(Patch{{Op: "remove", Path: "/age"}}); er != nil {
+		t.Fatal(er)
+	}
+
+	if full, _, _ := mt.changes(); !full {
+		t.Errorf("removing a top-level key should rewrite the document")
+	}
+}
+
+func TestListPatch(t *testing.T) {
+	var a, b List
+	if er := a.Scan(`[1, 2, 3]`); er != nil {
+		t.Fatal(er)
+	}
+	if er := b.Scan(`[1, 5]`); er != nil {
+		t.Fatal(er)
+	}
+
+	p, er := DiffLists(&a, &b)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	ml, er := a.As(TypeNumberList)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := ml.ApplyPatch(p); er != nil {
+		t.Fatal(er)
+	}
+
+	if dec, _ := ml.decode(); !reflect.DeepEqual(dec, []interface{}{float64(1), float64(5)}) || !ml.Dirty() {
+		t.Errorf("got %#v", dec)
+	}
+}
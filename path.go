@@ -0,0 +1,87 @@
+package jsonb
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Paths into documents are reported as RFC 6901 JSON Pointers (e.g.
+// "/items/2/price"). The root of a document is the empty string.
+
+var (
+	pointerEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// pointerAppend returns ptr with an additional reference token.
+func pointerAppend(ptr, token string) string {
+	return ptr + "/" + pointerEscaper.Replace(token)
+}
+
+// pointerTokens splits a JSON Pointer into its unescaped reference tokens.
+func pointerTokens(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+
+	if ptr[0] != '/' {
+		return nil, ErrInvalidPointer
+	}
+
+	toks := strings.Split(ptr[1:], "/")
+	for i, tok := range toks {
+		toks[i] = pointerUnescaper.Replace(tok)
+	}
+
+	return toks, nil
+}
+
+// listIndex parses a JSON Pointer token as a list index.
+func listIndex(tok string) (int, bool) {
+	// RFC 6901 doesn't allow leading zeros (or signs).
+	if tok == "" || (len(tok) > 1 && tok[0] == '0') || tok[0] == '+' || tok[0] == '-' {
+		return 0, false
+	}
+
+	i, er := strconv.Atoi(tok)
+	return i, er == nil
+}
+
+// Lookup returns the Type of the value at the given JSON Pointer within
+// documents of type ty. Tokens within lists must be indices. ErrSchema is
+// returned if ty doesn't allow anything at that path; the path is also
+// allowed to descend into KindAny values, in which case TypeAny is returned.
+func (ty *Type) Lookup(ptr string) (*Type, error) {
+	toks, er := pointerTokens(ptr)
+	if er != nil {
+		return nil, er
+	}
+
+	for _, tok := range toks {
+		ty = ty.deref()
+
+		switch ty.Kind {
+		case KindTable:
+			sty, ok := ty.Fields[tok]
+			if !ok {
+				return nil, ErrSchema
+			}
+			ty = sty
+
+		case KindList:
+			i, ok := listIndex(tok)
+			if !ok || (ty.MaxLen > 0 && i >= ty.MaxLen) {
+				return nil, ErrSchema
+			}
+			ty = ty.ListType
+
+		case KindAny:
+			return TypeAny, nil
+
+		default:
+			return nil, ErrSchema
+		}
+	}
+
+	return ty.deref(), nil
+}
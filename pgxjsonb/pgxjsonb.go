@@ -0,0 +1,48 @@
+// Package pgxjsonb registers the jsonb types with pgx (v5), so they can be
+// used with native pgx connections and pools as well as through
+// database/sql.
+//
+// Table and List already work with pgx as sql.Scanners/driver.Valuers when
+// the column's OID is known (pgx's jsonb codec deals with the binary
+// format's version byte). Registering them maps the Go types to jsonb for
+// the cases where it isn't, e.g. query arguments under the simple protocol
+// or QueryExecModeExec, which would otherwise be sent as bytea.
+package pgxjsonb
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/lye/jsonb"
+)
+
+// Register maps the jsonb package's types to PostgreSQL's jsonb in m.
+func Register(m *pgtype.Map) {
+	for _, v := range []interface{}{
+		jsonb.Table{},
+		&jsonb.Table{},
+		jsonb.MutableTable{},
+		&jsonb.MutableTable{},
+		jsonb.List{},
+		&jsonb.List{},
+		jsonb.MutableList{},
+		&jsonb.MutableList{},
+		jsonb.NullTable{},
+		&jsonb.NullTable{},
+		jsonb.NullList{},
+		&jsonb.NullList{},
+		jsonb.Document{},
+		&jsonb.Document{},
+	} {
+		m.RegisterDefaultPgType(v, "jsonb")
+	}
+}
+
+// AfterConnect registers the types on a new connection. It can be used
+// directly as pgxpool.Config.AfterConnect.
+func AfterConnect(ctx context.Context, conn *pgx.Conn) error {
+	Register(conn.TypeMap())
+	return nil
+}
@@ -0,0 +1,61 @@
+package pgxjsonb
+
+import (
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"github.com/lye/jsonb"
+)
+
+func TestRegister(t *testing.T) {
+	m := pgtype.NewMap()
+	Register(m)
+
+	for _, v := range []interface{}{&jsonb.Table{}, jsonb.List{}, &jsonb.MutableTable{}} {
+		dt, ok := m.TypeForValue(v)
+		if !ok || dt.OID != pgtype.JSONBOID {
+			t.Errorf("%T: got %v, expected jsonb", v, dt)
+		}
+	}
+}
+
+func TestScanBinary(t *testing.T) {
+	m := pgtype.NewMap()
+	Register(m)
+
+	var tab jsonb.Table
+	src := append([]byte{1}, `{"a":1}`...)
+
+	if er := m.PlanScan(pgtype.JSONBOID, pgtype.BinaryFormatCode, &tab).Scan(src, &tab); er != nil {
+		t.Fatal(er)
+	}
+
+	if bs, er := tab.MarshalJSON(); er != nil || string(bs) != `{"a":1}` {
+		t.Errorf("got %s, %v", bs, er)
+	}
+
+	var lst jsonb.List
+	if er := m.PlanScan(pgtype.JSONBOID, pgtype.TextFormatCode, &lst).Scan([]byte(`[1,2]`), &lst); er != nil {
+		t.Fatal(er)
+	}
+}
+
+func TestEncodeBinary(t *testing.T) {
+	m := pgtype.NewMap()
+	Register(m)
+
+	var tab jsonb.Table
+	if er := tab.Scan(`{"a":1}`); er != nil {
+		t.Fatal(er)
+	}
+
+	buf, er := m.Encode(pgtype.JSONBOID, pgtype.BinaryFormatCode, &tab, nil)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if string(buf) != "\x01{\"a\":1}" {
+		t.Errorf("got %q", buf)
+	}
+}
@@ -0,0 +1,259 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Where builds an SQL WHERE fragment over a jsonb column. Every condition's
+// path (a JSON Pointer) and value are checked against the column's Type, so
+// queries that can never match (or that would fail at runtime, e.g. casting
+// a string to numeric) are rejected up front with ErrSchema.
+//
+// Conditions are ANDed together. Values are passed as positional arguments
+// ($1, $2, ...) as understood by lib/pq.
+//
+// The generated expressions mirror the ones in IndexDDL so that expression
+// indexes get used, and containment tests are done at the root of the
+// column where possible so that GIN indexes on the column get used.
+type Where struct {
+	ty     *Type
+	column string
+	conds  []whereCond
+}
+
+type whereCond struct {
+	// format contains one %s for each argument's placeholder.
+	format string
+	args   []interface{}
+}
+
+// NewWhere returns an empty Where for the given column, whose documents are
+// of type ty.
+func NewWhere(ty *Type, column string) *Where {
+	return &Where{
+		ty:     ty.deref(),
+		column: column,
+	}
+}
+
+// wherePath is a resolved JSON Pointer.
+type wherePath struct {
+	ty       *Type
+	toks     []string
+	operands []string
+
+	// inList is set if the path goes through a list element.
+	inList bool
+}
+
+func (w *Where) resolve(ptr string) (*wherePath, error) {
+	toks, er := pointerTokens(ptr)
+	if er != nil {
+		return nil, er
+	}
+
+	p := &wherePath{
+		ty:       w.ty,
+		toks:     toks,
+		operands: make([]string, len(toks)),
+	}
+
+	for i, tok := range toks {
+		if p.ty.Kind == KindList {
+			// NB: Lookup has already made sure this is an index.
+			p.operands[i] = tok
+			p.inList = true
+		} else {
+			p.operands[i] = quoteLiteral(tok)
+		}
+
+		if p.ty, er = p.ty.Lookup(pointerAppend("", tok)); er != nil {
+			return nil, er
+		}
+	}
+
+	return p, nil
+}
+
+// expr returns the SQL expression for the path, escaped for use in a
+// whereCond format.
+func (p *wherePath) expr(column string, text bool) string {
+	return strings.Replace(jsonbPath(quoteIdent(column), p.operands, text), "%", "%%", -1)
+}
+
+// wrap nests val inside objects for each token of the path, so that a
+// containment test can be done at the root.
+func (p *wherePath) wrap(val interface{}) interface{} {
+	for i := len(p.toks) - 1; i >= 0; i-- {
+		val = map[string]interface{}{p.toks[i]: val}
+	}
+
+	return val
+}
+
+func (w *Where) add(format string, args ...interface{}) {
+	w.conds = append(w.conds, whereCond{format, args})
+}
+
+func jsonArg(val interface{}) (string, error) {
+	bs, er := json.Marshal(val)
+	return string(bs), er
+}
+
+// Eq adds a condition that the value at path equals val.
+func (w *Where) Eq(path string, val interface{}) error {
+	p, er := w.resolve(path)
+	if er != nil {
+		return er
+	}
+
+	if !p.ty.IsValid(val) {
+		return ErrSchema
+	}
+
+	arg, er := jsonArg(val)
+	if er != nil {
+		return er
+	}
+
+	w.add(p.expr(w.column, false)+" = %s::jsonb", arg)
+	return nil
+}
+
+// Contains adds a condition that the value at path contains val, in the
+// sense of the @> operator (e.g. a table containing a subset of its fields).
+func (w *Where) Contains(path string, val interface{}) error {
+	p, er := w.resolve(path)
+	if er != nil {
+		return er
+	}
+
+	if !p.ty.IsValid(val) {
+		return ErrSchema
+	}
+
+	return w.contains(p, val)
+}
+
+func (w *Where) contains(p *wherePath, val interface{}) error {
+	// Containment doesn't care about list positions, so paths through lists
+	// have to be tested in place.
+	if p.inList {
+		arg, er := jsonArg(val)
+		if er != nil {
+			return er
+		}
+
+		w.add(p.expr(w.column, false)+" @> %s::jsonb", arg)
+		return nil
+	}
+
+	arg, er := jsonArg(p.wrap(val))
+	if er != nil {
+		return er
+	}
+
+	w.add(strings.Replace(quoteIdent(w.column), "%", "%%", -1)+" @> %s::jsonb", arg)
+	return nil
+}
+
+// HasKey adds a condition that the table at path has the given key.
+func (w *Where) HasKey(path, key string) error {
+	p, er := w.resolve(path)
+	if er != nil {
+		return er
+	}
+
+	if p.ty.Kind == KindTable {
+		if _, ok := p.ty.Fields[key]; !ok {
+			return ErrSchema
+		}
+	} else if p.ty.Kind != KindAny {
+		return ErrSchema
+	}
+
+	w.add(p.expr(w.column, false)+" ? %s", key)
+	return nil
+}
+
+// ArrayContains adds a condition that the list at path contains val.
+func (w *Where) ArrayContains(path string, val interface{}) error {
+	p, er := w.resolve(path)
+	if er != nil {
+		return er
+	}
+
+	if p.ty.Kind != KindList || !p.ty.ListType.IsValid(val) {
+		return ErrSchema
+	}
+
+	return w.contains(p, []interface{}{val})
+}
+
+var whereOps = map[string]bool{
+	"=":  true,
+	"<>": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+// Compare adds a numeric comparison between the number at path and val. op
+// is one of =, <>, !=, <, <=, > or >=.
+func (w *Where) Compare(path, op string, val interface{}) error {
+	if !whereOps[op] {
+		return ErrSchema
+	}
+
+	p, er := w.resolve(path)
+	if er != nil {
+		return er
+	}
+
+	if p.ty.Kind != KindNumber || !p.ty.IsValid(val) {
+		return ErrSchema
+	}
+
+	f, _ := toFloat64(val)
+	w.add("("+p.expr(w.column, true)+")::numeric "+op+" %s::numeric",
+		strconv.FormatFloat(f, 'g', -1, 64))
+	return nil
+}
+
+// Lt, Lte, Gt and Gte are shorthand for Compare.
+func (w *Where) Lt(path string, val interface{}) error  { return w.Compare(path, "<", val) }
+func (w *Where) Lte(path string, val interface{}) error { return w.Compare(path, "<=", val) }
+func (w *Where) Gt(path string, val interface{}) error  { return w.Compare(path, ">", val) }
+func (w *Where) Gte(path string, val interface{}) error { return w.Compare(path, ">=", val) }
+
+// SQL returns the WHERE fragment (without the WHERE keyword) and its
+// arguments. Placeholders are numbered from argOffset+1, so the fragment can
+// be combined with other arguments. If there are no conditions, "true" is
+// returned.
+func (w *Where) SQL(argOffset int) (string, []interface{}) {
+	if len(w.conds) == 0 {
+		return "true", nil
+	}
+
+	var (
+		parts = make([]string, len(w.conds))
+		args  []interface{}
+	)
+
+	for i, c := range w.conds {
+		placeholders := make([]interface{}, len(c.args))
+		for j := range c.args {
+			placeholders[j] = "$" + strconv.Itoa(argOffset+len(args)+j+1)
+		}
+
+		parts[i] = fmt.Sprintf(c.format, placeholders...)
+		args = append(args, c.args...)
+	}
+
+	return strings.Join(parts, " AND "), args
+}
@@ -0,0 +1,139 @@
+package jsonb
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testQueryType = NewTableType(TableDef{
+	"name": TypeString,
+	"age":  TypeNumber,
+	"tags": TypeStringList,
+	"50%":  TypeBool,
+	"address": NewTableType(TableDef{
+		"zip": TypeString,
+	}),
+	"items": NewListType(NewTableType(TableDef{
+		"sku":   TypeString,
+		"price": TypeNumber,
+	}), -1),
+	"extra": TypeAny,
+})
+
+func TestWhere(t *testing.T) {
+	w := NewWhere(testQueryType, "doc")
+
+	steps := []error{
+		w.Eq("/name", "ada"),
+		w.Gte("/age", 18),
+		w.ArrayContains("/tags", "admin"),
+		w.Contains("/address", map[string]interface{}{"zip": "12345"}),
+		w.HasKey("", "50%"),
+		w.Contains("/items/0", map[string]interface{}{"sku": "x"}),
+		w.Lt("/items/1/price", 2.5),
+		w.Eq("/extra/whatever", []interface{}{1}),
+	}
+	for i, er := range steps {
+		if er != nil {
+			t.Fatalf("step %d: %s", i, er)
+		}
+	}
+
+	sql, args := w.SQL(1)
+
+	expected := `"doc" -> 'name' = $2::jsonb` +
+		` AND ("doc" ->> 'age')::numeric >= $3::numeric` +
+		` AND "doc" @> $4::jsonb` +
+		` AND "doc" @> $5::jsonb` +
+		` AND "doc" ? $6` +
+		` AND "doc" -> 'items' -> 0 @> $7::jsonb` +
+		` AND ("doc" -> 'items' -> 1 ->> 'price')::numeric < $8::numeric` +
+		` AND "doc" -> 'extra' -> 'whatever' = $9::jsonb`
+	if sql != expected {
+		t.Errorf("got\n%s\nexpected\n%s", sql, expected)
+	}
+
+	expectedArgs := []interface{}{
+		`"ada"`,
+		"18",
+		`{"tags":["admin"]}`,
+		`{"address":{"zip":"12345"}}`,
+		"50%",
+		`{"sku":"x"}`,
+		"2.5",
+		`[1]`,
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Errorf("wrong args %#v", args)
+	}
+}
+
+func TestWhereEmpty(t *testing.T) {
+	sql, args := NewWhere(testQueryType, "doc").SQL(0)
+	if sql != "true" || len(args) != 0 {
+		t.Errorf("wrong empty where %s %v", sql, args)
+	}
+}
+
+func TestWhereRejects(t *testing.T) {
+	w := NewWhere(testQueryType, "doc")
+
+	cases := []error{
+		w.Eq("/nope", 1),
+		w.Eq("/name", 1),
+		w.Eq("name", "ada"),
+		w.Gt("/name", 1),
+		w.Gt("/age", "1"),
+		w.Compare("/age", "; DROP TABLE", 1),
+		w.ArrayContains("/tags", 1),
+		w.ArrayContains("/name", "a"),
+		w.HasKey("", "nope"),
+		w.HasKey("/name", "a"),
+		w.Contains("/address", map[string]interface{}{"street": "x"}),
+		w.Eq("/items/x/sku", "a"),
+	}
+
+	for i, er := range cases {
+		if er == nil {
+			t.Errorf("case %d should have failed", i)
+		}
+	}
+
+	if len(w.conds) != 0 {
+		t.Error("rejected conditions were added")
+	}
+}
+
+func TestWhereQuery(t *testing.T) {
+	db := testGetDb(t)
+	defer db.Close()
+
+	w := NewWhere(testQueryType, "doc")
+	if er := w.ArrayContains("/tags", "a"); er != nil {
+		t.Fatal(er)
+	}
+	if er := w.Gt("/age", 10); er != nil {
+		t.Fatal(er)
+	}
+
+	sql, args := w.SQL(0)
+	rows, er := db.Query(`SELECT count(*) FROM (VALUES
+		('{"tags":["a"],"age":11}'::jsonb),
+		('{"tags":["a"],"age":9}'::jsonb),
+		('{"tags":["b"],"age":11}'::jsonb)) AS t(doc) WHERE `+sql, args...)
+	if er != nil {
+		t.Fatal(er)
+	}
+	defer rows.Close()
+
+	var n int
+	if !rows.Next() {
+		t.Fatal("no rows")
+	}
+	if er := rows.Scan(&n); er != nil {
+		t.Fatal(er)
+	}
+	if n != 1 {
+		t.Errorf("wrong count %d", n)
+	}
+}
@@ -0,0 +1,162 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Registry is a set of named Types. Types can refer to registered Types by
+// name with Registry.Ref, which makes it possible to declare recursive
+// structures (e.g. comments with replies) and to share definitions.
+//
+// References are resolved when they're used, so Types can refer to names
+// which are registered later. Registries aren't safe for concurrent
+// registration; register everything up front.
+type Registry struct {
+	types map[string]*Type
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		types: make(map[string]*Type),
+	}
+}
+
+// Register adds ty under name. ErrSchema is returned if the name is already
+// taken.
+func (r *Registry) Register(name string, ty *Type) error {
+	if _, ok := r.types[name]; ok {
+		return ErrSchema
+	}
+
+	r.types[name] = ty
+	return nil
+}
+
+// Ref returns a Type which refers to the Type registered as name.
+func (r *Registry) Ref(name string) *Type {
+	return &Type{
+		Kind:     KindRef,
+		Ref:      name,
+		registry: r,
+	}
+}
+
+// Lookup returns the Type registered as name, with references to other
+// Types left as they are.
+func (r *Registry) Lookup(name string) (*Type, bool) {
+	ty, ok := r.types[name]
+	return ty, ok
+}
+
+// Names returns the registered names in order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// Check returns ErrUnresolvedRef if any registered Type refers to a name
+// that isn't registered.
+func (r *Registry) Check() error {
+	seen := make(map[*Type]bool)
+	for _, name := range r.Names() {
+		if er := r.check(r.types[name], seen); er != nil {
+			return er
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) check(ty *Type, seen map[*Type]bool) error {
+	if ty == nil || seen[ty] {
+		return nil
+	}
+	seen[ty] = true
+
+	switch ty.Kind {
+	case KindRef:
+		if ty.deref().Kind == KindRef {
+			return ErrUnresolvedRef
+		}
+
+	case KindList:
+		return r.check(ty.ListType, seen)
+
+	case KindTable:
+		for _, k := range sortedKeys(ty.Fields) {
+			if er := r.check(ty.Fields[k], seen); er != nil {
+				return er
+			}
+		}
+	}
+
+	return nil
+}
+
+// MarshalJSON encodes the Registry as an object of named Types. References
+// are encoded by name, so recursive Types are fine.
+func (r *Registry) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.types)
+}
+
+// UnmarshalJSON decodes a Registry encoded by MarshalJSON, binding the
+// references in its Types to it.
+func (r *Registry) UnmarshalJSON(bs []byte) error {
+	var types map[string]*Type
+	if er := json.Unmarshal(bs, &types); er != nil {
+		return er
+	}
+
+	r.types = types
+	for _, ty := range types {
+		r.bind(ty)
+	}
+
+	return nil
+}
+
+func (r *Registry) bind(ty *Type) {
+	if ty == nil {
+		return
+	}
+
+	switch ty.Kind {
+	case KindRef:
+		ty.registry = r
+
+	case KindList:
+		r.bind(ty.ListType)
+
+	case KindTable:
+		for _, fty := range ty.Fields {
+			r.bind(fty)
+		}
+	}
+}
+
+// deref returns the Type ty refers to, following references, or ty itself
+// if it isn't a reference. Unresolvable references (including ones that
+// only refer to each other) are returned as they are; they don't accept any
+// values.
+func (ty *Type) deref() *Type {
+	for i := 0; ty.Kind == KindRef; i++ {
+		if ty.registry == nil {
+			return ty
+		}
+
+		next, ok := ty.registry.types[ty.Ref]
+		if !ok || i > len(ty.registry.types) {
+			return ty
+		}
+		ty = next
+	}
+
+	return ty
+}
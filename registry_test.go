@@ -0,0 +1,145 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testRegistry(t *testing.T) *Registry {
+	r := NewRegistry()
+
+	if er := r.Register("Comment", NewTableType(TableDef{
+		"text":    TypeString,
+		"author":  r.Ref("User"),
+		"replies": NewListType(r.Ref("Comment"), -1),
+	})); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := r.Register("User", NewTableType(TableDef{
+		"name": TypeString,
+	})); er != nil {
+		t.Fatal(er)
+	}
+
+	return r
+}
+
+func TestRegistryRecursive(t *testing.T) {
+	r := testRegistry(t)
+	if er := r.Check(); er != nil {
+		t.Fatal(er)
+	}
+
+	var tab Table
+	if er := tab.Scan(`{"text": "a", "replies": [{"text": "b", "replies": [{"text": "c", "author": {"name": "ada"}}]}]}`); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(r.Ref("Comment"))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := mt.ApplyPatch(Patch{{Op: "add", Path: "/replies/0/replies/0/replies", Value: []interface{}{map[string]interface{}{"text": "d"}}}}); er != nil {
+		t.Error(er)
+	}
+
+	if er := mt.ApplyPatch(Patch{{Op: "add", Path: "/replies/0/replies/0/replies/-", Value: map[string]interface{}{"text": float64(1)}}}); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	var bad Table
+	if er := bad.Scan(`{"text": "a", "replies": [{"replies": [{"nope": true}]}]}`); er != nil {
+		t.Fatal(er)
+	}
+	dec, _ := bad.decode()
+
+	var errs ValidationErrors
+	if er := r.Ref("Comment").Validate(dec); !errors.As(er, &errs) || len(errs) != 1 || errs[0].Path != "/replies/0/replies/0/nope" {
+		t.Errorf("got %v", er)
+	}
+
+	if ty, er := r.Ref("Comment").Lookup("/replies/0/replies/0/author/name"); er != nil || ty != TypeString {
+		t.Errorf("got %v, %v", ty, er)
+	}
+}
+
+func TestRegistryUnresolved(t *testing.T) {
+	r := NewRegistry()
+	if er := r.Register("Post", NewTableType(TableDef{
+		"author": r.Ref("User"),
+	})); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := r.Check(); er != ErrUnresolvedRef {
+		t.Errorf("got %v, expected ErrUnresolvedRef", er)
+	}
+
+	if r.Ref("User").IsValid(map[string]interface{}{}) {
+		t.Errorf("unresolved references shouldn't accept anything")
+	}
+
+	if er := r.Register("Post", TypeAny); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	// Registering the missing Type later resolves the reference.
+	if er := r.Register("User", TypeString); er != nil {
+		t.Fatal(er)
+	}
+	if er := r.Check(); er != nil {
+		t.Error(er)
+	}
+
+	// References which only refer to each other never resolve.
+	r.Register("A", r.Ref("B"))
+	r.Register("B", r.Ref("A"))
+	if er := r.Check(); er != ErrUnresolvedRef {
+		t.Errorf("got %v, expected ErrUnresolvedRef", er)
+	}
+}
+
+func TestRegistryJSON(t *testing.T) {
+	r := testRegistry(t)
+
+	bs, er := json.Marshal(r)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	r2 := NewRegistry()
+	if er := json.Unmarshal(bs, r2); er != nil {
+		t.Fatal(er)
+	}
+
+	if !reflect.DeepEqual(r2.Names(), []string{"Comment", "User"}) {
+		t.Errorf("got %v", r2.Names())
+	}
+
+	if er := r2.Check(); er != nil {
+		t.Error(er)
+	}
+
+	val := map[string]interface{}{
+		"text": "a",
+		"replies": []interface{}{
+			map[string]interface{}{"text": "b", "author": map[string]interface{}{"name": "ada"}},
+		},
+	}
+	if !r2.Ref("Comment").IsValid(val) {
+		t.Errorf("decoded registry rejects a valid value")
+	}
+
+	ty, ok := r2.Lookup("Comment")
+	if !ok || ty.Fields["replies"].ListType.Kind != KindRef || ty.Fields["replies"].ListType.Ref != "Comment" {
+		t.Errorf("got %#v", ty)
+	}
+
+	if _, ok := r2.Lookup("Nope"); ok {
+		t.Errorf("found an unregistered name")
+	}
+}
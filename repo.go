@@ -0,0 +1,404 @@
+package jsonb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Querier is the part of *sql.DB, *sql.Tx and *sql.Conn used by
+// Repository.
+type Querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Repository loads and saves the jsonb columns of rows in a table, checking
+// them against their Types.
+//
+// Save only writes the columns which have changed; when only some top-level
+// keys of a column were Set, just those keys are sent (with the || operator)
+// so that concurrent writers touching other keys aren't clobbered.
+type Repository struct {
+	DB Querier
+
+	// Table is the table name (which may be schema-qualified), Keys its
+	// key columns and Columns the Type of each jsonb column. Every Type
+	// must be a table type.
+	Table   string
+	Keys    []string
+	Columns map[string]*Type
+
+	// VersionField, if set, enables optimistic concurrency using a numeric
+	// top-level field of each column, which is checked and incremented by
+	// every Save. A missing field counts as version 0.
+	VersionField string
+
+	// CheckHash enables optimistic concurrency by comparing an md5 of each
+	// column with the one it had when it was loaded. Unlike VersionField,
+	// this also catches writers that don't use Repository.
+	CheckHash bool
+
+	// Retries is the number of times Save rebases its changes onto the
+	// current row and tries again after a conflict.
+	Retries int
+}
+
+// Row holds the jsonb columns of a row, by column name.
+type Row map[string]*MutableTable
+
+func (r *Repository) where(key interface{}, argOffset int) (string, []interface{}, error) {
+	// NB: Without any key columns, there's nothing to pick out the row.
+	if len(r.Keys) == 0 {
+		return "", nil, ErrInvalidKey
+	}
+
+	args := []interface{}{key}
+	if len(r.Keys) != 1 {
+		var ok bool
+		if args, ok = key.([]interface{}); !ok || len(args) != len(r.Keys) {
+			return "", nil, ErrInvalidKey
+		}
+	}
+
+	conds := make([]string, len(r.Keys))
+	for i, k := range r.Keys {
+		conds[i] = quoteIdent(k) + " = $" + strconv.Itoa(argOffset+i+1)
+	}
+
+	return strings.Join(conds, " AND "), args, nil
+}
+
+func (r *Repository) columns() []string {
+	cols := make([]string, 0, len(r.Columns))
+	for col := range r.Columns {
+		cols = append(cols, col)
+	}
+
+	sort.Strings(cols)
+	return cols
+}
+
+// Load reads the row with the given key (a []interface{} with a value for
+// each key column, or just the value if there's only one) and returns its
+// jsonb columns. NULL columns are returned as empty tables. sql.ErrNoRows is
+// returned if there's no such row, and ErrSchema if a column isn't valid.
+func (r *Repository) Load(ctx context.Context, key interface{}) (Row, error) {
+	where, args, er := r.where(key, 0)
+	if er != nil {
+		return nil, er
+	}
+
+	cols := r.columns()
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteIdent(col)
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s",
+		strings.Join(quoted, ", "), quoteName(r.Table), where)
+
+	vals := make([]NullTable, len(cols))
+	dests := make([]interface{}, len(cols))
+	for i := range vals {
+		dests[i] = &vals[i]
+	}
+
+	if er := r.DB.QueryRowContext(ctx, query, args...).Scan(dests...); er != nil {
+		return nil, er
+	}
+
+	row := make(Row, len(cols))
+	for i, col := range cols {
+		ty := r.Columns[col]
+		if !vals[i].Valid {
+			row[col] = NewTable(ty)
+			continue
+		}
+
+		if row[col], er = vals[i].Table.As(ty); er != nil {
+			return nil, er
+		}
+	}
+
+	return row, nil
+}
+
+// Save writes back the columns of row that have changed since they were
+// loaded, and marks them clean. Nothing is executed if nothing has changed.
+// sql.ErrNoRows is returned if there's no row with the given key.
+//
+// If VersionField or CheckHash are set and the row was changed by someone
+// else since it was loaded, a *ConflictError is returned. If Retries is
+// set, the changes are first rebased onto the current row (replacing the
+// MutableTables in row) and saved again, up to Retries times.
+func (r *Repository) Save(ctx context.Context, key interface{}, row Row) error {
+	if _, _, er := r.where(key, 0); er != nil {
+		return er
+	}
+
+	for attempt := 0; ; attempt++ {
+		er := r.save(ctx, key, row)
+		if _, ok := er.(*ConflictError); !ok || attempt >= r.Retries {
+			return er
+		}
+
+		if er := r.rebase(ctx, key, row, er); er != nil {
+			return er
+		}
+	}
+}
+
+// repoSave is a column being saved.
+type repoSave struct {
+	col string
+	mt  *MutableTable
+
+	// version is the document's version before the save, if VersionField
+	// is set.
+	version float64
+}
+
+func (r *Repository) save(ctx context.Context, key interface{}, row Row) error {
+	var (
+		sets  []string
+		conds []string
+		args  []interface{}
+		saves []repoSave
+	)
+
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		if _, ok := r.Columns[col]; !ok {
+			return ErrSchema
+		}
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	arg := func(val interface{}) string {
+		args = append(args, val)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	for _, col := range cols {
+		mt := row[col]
+		qcol := quoteIdent(col)
+
+		full, patch, er := mt.changes()
+		if er != nil {
+			return er
+		}
+
+		if !full && patch == nil {
+			continue
+		}
+
+		sv := repoSave{col: col, mt: mt}
+
+		var doc interface{} = patch
+		if full {
+			dec, er := mt.decode()
+			if er != nil {
+				return er
+			}
+			doc = dec
+		}
+
+		if r.VersionField != "" {
+			dec, er := mt.decode()
+			if er != nil {
+				return er
+			}
+
+			sv.version, _ = toFloat64(dec[r.VersionField])
+			if fty, ok := mt.ty.Fields[r.VersionField]; !ok || !fty.IsValid(sv.version+1) {
+				return ErrSchema
+			}
+
+			// NB: The bumped version is only written to the MutableTable
+			// once the save succeeds.
+			bumped := make(map[string]interface{}, len(doc.(map[string]interface{}))+1)
+			for k, v := range doc.(map[string]interface{}) {
+				bumped[k] = v
+			}
+			bumped[r.VersionField] = sv.version + 1
+			doc = bumped
+
+			conds = append(conds, fmt.Sprintf("COALESCE(%s -> %s, '0'::jsonb) = %s::jsonb",
+				qcol, quoteLiteral(r.VersionField), arg(strconv.FormatFloat(sv.version, 'g', -1, 64))))
+		}
+
+		if r.CheckHash {
+			if hash := mt.origHash(); hash == "" {
+				conds = append(conds, qcol+" IS NULL")
+			} else {
+				conds = append(conds, fmt.Sprintf("md5(%s::text) = %s", qcol, arg(hash)))
+			}
+		}
+
+		bs, er := json.Marshal(doc)
+		if er != nil {
+			return er
+		}
+
+		if full {
+			sets = append(sets, qcol+" = "+arg(string(bs))+"::jsonb")
+		} else {
+			sets = append(sets, fmt.Sprintf("%s = COALESCE(%s, '{}'::jsonb) || %s::jsonb",
+				qcol, qcol, arg(string(bs))))
+		}
+
+		saves = append(saves, sv)
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	where, keyArgs, er := r.where(key, len(args))
+	if er != nil {
+		return er
+	}
+	args = append(args, keyArgs...)
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		quoteName(r.Table), strings.Join(sets, ", "), strings.Join(append([]string{where}, conds...), " AND "))
+
+	hashes := make([]string, len(saves))
+
+	if r.CheckHash {
+		// The new hashes are needed for the next save.
+		rets := make([]string, len(saves))
+		dests := make([]interface{}, len(saves))
+		for i, sv := range saves {
+			rets[i] = fmt.Sprintf("md5(%s::text)", quoteIdent(sv.col))
+			dests[i] = &hashes[i]
+		}
+		query += " RETURNING " + strings.Join(rets, ", ")
+
+		if er := r.DB.QueryRowContext(ctx, query, args...).Scan(dests...); er == sql.ErrNoRows {
+			return r.conflict(ctx, key, saves)
+		} else if er != nil {
+			return er
+		}
+	} else {
+		res, er := r.DB.ExecContext(ctx, query, args...)
+		if er != nil {
+			return er
+		}
+
+		if n, er := res.RowsAffected(); er != nil {
+			return er
+		} else if n == 0 && len(conds) > 0 {
+			return r.conflict(ctx, key, saves)
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+	}
+
+	for i, sv := range saves {
+		if r.VersionField != "" {
+			dec, er := sv.mt.decode()
+			if er != nil {
+				return er
+			}
+			dec[r.VersionField] = sv.version + 1
+		}
+		if r.CheckHash {
+			sv.mt.orig, sv.mt.hash = nil, hashes[i]
+		}
+		sv.mt.MarkClean()
+	}
+
+	return nil
+}
+
+// conflict returns the error for an update that matched nothing because
+// of its conditions: a *ConflictError, or sql.ErrNoRows if the row isn't
+// there at all.
+func (r *Repository) conflict(ctx context.Context, key interface{}, saves []repoSave) error {
+	where, args, er := r.where(key, 0)
+	if er != nil {
+		return er
+	}
+
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE %s)", quoteName(r.Table), where)
+	if er := r.DB.QueryRowContext(ctx, query, args...).Scan(&exists); er != nil {
+		return er
+	} else if !exists {
+		return sql.ErrNoRows
+	}
+
+	cols := make([]string, len(saves))
+	for i, sv := range saves {
+		cols[i] = sv.col
+	}
+
+	return &ConflictError{
+		Table:   r.Table,
+		Key:     key,
+		Columns: cols,
+	}
+}
+
+// rebase replaces the tables in row with the current ones from the
+// database, with the top-level keys that were Set re-applied. Rewritten
+// documents can't be rebased, so conflict is returned for them.
+func (r *Repository) rebase(ctx context.Context, key interface{}, row Row, conflict error) error {
+	fresh, er := r.Load(ctx, key)
+	if er != nil {
+		return er
+	}
+
+	for col, mt := range row {
+		full, patch, er := mt.changes()
+		if er != nil {
+			return er
+		}
+
+		if full {
+			return conflict
+		}
+
+		keys := make([]string, 0, len(patch))
+		for k := range patch {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if er := fresh[col].Set(k, patch[k]); er != nil {
+				return er
+			}
+		}
+	}
+
+	for col := range row {
+		row[col] = fresh[col]
+	}
+
+	return nil
+}
+
+// ConflictError is returned by Repository.Save when the row was changed by
+// someone else since it was loaded. It wraps ErrConflict.
+type ConflictError struct {
+	Table   string
+	Key     interface{}
+	Columns []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s (key %v, columns %s)",
+		ErrConflict, e.Table, e.Key, strings.Join(e.Columns, ", "))
+}
+
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
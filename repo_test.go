@@ -0,0 +1,423 @@
+package jsonb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver which records statements and hands back
+// canned results, for testing generated SQL without a server.
+type fakeDB struct {
+	mu    sync.Mutex
+	execs []fakeStmt
+
+	// results holds the rows returned by each of the following queries;
+	// affected is returned by every exec.
+	results  [][][]driver.Value
+	affected int64
+}
+
+// queue adds the result of a query.
+func (db *fakeDB) queue(rows ...[]driver.Value) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.results = append(db.results, rows)
+}
+
+type fakeStmt struct {
+	query string
+	args  []interface{}
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("jsonb_fake", fakeDriver{})
+}
+
+func testFakeDb(t *testing.T) (*sql.DB, *fakeDB) {
+	fake := &fakeDB{affected: 1}
+
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = fake
+	fakeDBsMu.Unlock()
+
+	db, er := sql.Open("jsonb_fake", t.Name())
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	return db, fake
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+
+	return &fakeConn{fakeDBs[name]}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake: prepare not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("fake: transactions not supported")
+}
+
+func fakeArgs(args []driver.NamedValue) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		out[i] = arg.Value
+	}
+
+	return out
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.execs = append(c.db.execs, fakeStmt{query, fakeArgs(args)})
+
+	rows := &fakeRows{}
+	if len(c.db.results) > 0 {
+		rows.rows, c.db.results = c.db.results[0], c.db.results[1:]
+	}
+	return rows, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	c.db.execs = append(c.db.execs, fakeStmt{query, fakeArgs(args)})
+	return driver.RowsAffected(c.db.affected), nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+var testRepoTypes = map[string]*Type{
+	"profile": NewTableType(TableDef{
+		"name": TypeString,
+		"age":  TypeNumber,
+	}),
+	"prefs": NewTableType(TableDef{
+		"theme": TypeString,
+	}),
+}
+
+func TestRepositoryLoad(t *testing.T) {
+	db, fake := testFakeDb(t)
+	defer db.Close()
+
+	repo := &Repository{
+		DB:      db,
+		Table:   "app.users",
+		Keys:    []string{"id"},
+		Columns: testRepoTypes,
+	}
+
+	fake.queue([]driver.Value{nil, []byte(`{"name":"ada","age":36}`)})
+
+	row, er := repo.Load(context.Background(), 7)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := fakeStmt{
+		query: `SELECT "prefs", "profile" FROM "app"."users" WHERE "id" = $1`,
+		args:  []interface{}{int64(7)},
+	}
+	if !reflect.DeepEqual(fake.execs[0], expected) {
+		t.Errorf("got %#v", fake.execs[0])
+	}
+
+	if dec, _ := row["profile"].decode(); dec["name"] != "ada" {
+		t.Errorf("got %#v", dec)
+	}
+
+	if dec, _ := row["prefs"].decode(); len(dec) != 0 {
+		t.Errorf("NULL: got %#v", dec)
+	}
+
+	// Rows that don't match their Type are rejected.
+	fake.queue([]driver.Value{nil, []byte(`{"name":1}`)})
+	if _, er := repo.Load(context.Background(), 7); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	if _, er := repo.Load(context.Background(), 7); er != sql.ErrNoRows {
+		t.Errorf("got %v, expected sql.ErrNoRows", er)
+	}
+}
+
+func TestRepositoryNoKeys(t *testing.T) {
+	db, fake := testFakeDb(t)
+	defer db.Close()
+
+	repo := &Repository{
+		DB:      db,
+		Table:   "users",
+		Columns: testRepoTypes,
+	}
+
+	if _, er := repo.Load(context.Background(), []interface{}{}); er != ErrInvalidKey {
+		t.Errorf("got %v, expected ErrInvalidKey", er)
+	}
+
+	row := Row{"prefs": NewTable(testRepoTypes["prefs"])}
+	if er := repo.Save(context.Background(), []interface{}{}, row); er != ErrInvalidKey {
+		t.Errorf("got %v, expected ErrInvalidKey", er)
+	}
+
+	if len(fake.execs) != 0 {
+		t.Errorf("got %#v", fake.execs)
+	}
+}
+
+func TestRepositorySave(t *testing.T) {
+	db, fake := testFakeDb(t)
+	defer db.Close()
+
+	repo := &Repository{
+		DB:      db,
+		Table:   "users",
+		Keys:    []string{"org", "id"},
+		Columns: testRepoTypes,
+	}
+	key := []interface{}{"acme", 7}
+
+	fake.queue([]driver.Value{[]byte(`{"theme":"dark"}`), []byte(`{"name":"ada","age":36}`)})
+
+	row, er := repo.Load(context.Background(), key)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	// Nothing changed, so nothing is written.
+	if er := repo.Save(context.Background(), key, row); er != nil {
+		t.Fatal(er)
+	}
+	if len(fake.execs) != 1 {
+		t.Fatalf("got %d statements", len(fake.execs))
+	}
+
+	if er := row["profile"].Set("age", 37); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := repo.Save(context.Background(), key, row); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := fakeStmt{
+		query: `UPDATE "users" SET "profile" = COALESCE("profile", '{}'::jsonb) || $1::jsonb WHERE "org" = $2 AND "id" = $3`,
+		args:  []interface{}{`{"age":37}`, "acme", int64(7)},
+	}
+	if !reflect.DeepEqual(fake.execs[1], expected) {
+		t.Errorf("got %#v", fake.execs[1])
+	}
+
+	if row["profile"].Dirty() {
+		t.Errorf("still dirty after Save")
+	}
+
+	// Rewritten documents (e.g. by a schema upgrade) are written in full.
+	row["prefs"].markRewritten()
+
+	fake.affected = 0
+	if er := repo.Save(context.Background(), key, row); er != sql.ErrNoRows {
+		t.Errorf("got %v, expected sql.ErrNoRows", er)
+	}
+
+	expected = fakeStmt{
+		query: `UPDATE "users" SET "prefs" = $1::jsonb WHERE "org" = $2 AND "id" = $3`,
+		args:  []interface{}{`{"theme":"dark"}`, "acme", int64(7)},
+	}
+	if !reflect.DeepEqual(fake.execs[2], expected) {
+		t.Errorf("got %#v", fake.execs[2])
+	}
+
+	if er := repo.Save(context.Background(), "acme", row); er != ErrInvalidKey {
+		t.Errorf("got %v, expected ErrInvalidKey", er)
+	}
+}
+
+func TestRepositoryVersion(t *testing.T) {
+	db, fake := testFakeDb(t)
+	defer db.Close()
+
+	repo := &Repository{
+		DB:    db,
+		Table: "docs",
+		Keys:  []string{"id"},
+		Columns: map[string]*Type{
+			"doc": NewTableType(TableDef{
+				"rev":  TypeNumber,
+				"body": TypeString,
+			}),
+		},
+		VersionField: "rev",
+	}
+
+	fake.queue([]driver.Value{[]byte(`{"rev":3,"body":"x"}`)})
+
+	row, er := repo.Load(context.Background(), 1)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := row["doc"].Set("body", "y"); er != nil {
+		t.Fatal(er)
+	}
+
+	if er := repo.Save(context.Background(), 1, row); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := fakeStmt{
+		query: `UPDATE "docs" SET "doc" = COALESCE("doc", '{}'::jsonb) || $2::jsonb WHERE "id" = $3 AND COALESCE("doc" -> 'rev', '0'::jsonb) = $1::jsonb`,
+		args:  []interface{}{"3", `{"body":"y","rev":4}`, int64(1)},
+	}
+	if !reflect.DeepEqual(fake.execs[1], expected) {
+		t.Errorf("got %#v", fake.execs[1])
+	}
+
+	if dec, _ := row["doc"].decode(); dec["rev"] != float64(4) {
+		t.Errorf("version not bumped: %#v", dec)
+	}
+
+	// Someone else got there first.
+	if er := row["doc"].Set("body", "z"); er != nil {
+		t.Fatal(er)
+	}
+
+	fake.affected = 0
+	fake.queue([]driver.Value{true})
+	er = repo.Save(context.Background(), 1, row)
+	if ce, ok := er.(*ConflictError); !ok || !errors.Is(er, ErrConflict) || ce.Columns[0] != "doc" {
+		t.Fatalf("got %v, expected a ConflictError", er)
+	}
+
+	// The failed save didn't bump the version.
+	if dec, _ := row["doc"].decode(); dec["rev"] != float64(4) || !row["doc"].Dirty() {
+		t.Errorf("got %#v", dec)
+	}
+
+	expected = fakeStmt{
+		query: `SELECT EXISTS (SELECT 1 FROM "docs" WHERE "id" = $1)`,
+		args:  []interface{}{int64(1)},
+	}
+	if !reflect.DeepEqual(fake.execs[3], expected) {
+		t.Errorf("got %#v", fake.execs[3])
+	}
+
+	// The row is gone, which isn't a conflict.
+	fake.queue([]driver.Value{false})
+	if er := repo.Save(context.Background(), 1, row); er != sql.ErrNoRows {
+		t.Errorf("got %v, expected sql.ErrNoRows", er)
+	}
+}
+
+func TestRepositoryRebase(t *testing.T) {
+	db, fake := testFakeDb(t)
+	defer db.Close()
+
+	repo := &Repository{
+		DB:        db,
+		Table:     "users",
+		Keys:      []string{"id"},
+		Columns:   map[string]*Type{"profile": testRepoTypes["profile"]},
+		CheckHash: true,
+		Retries:   1,
+	}
+
+	orig := `{"age": 36, "name": "ada"}`
+	fake.queue([]driver.Value{[]byte(orig)})
+
+	row, er := repo.Load(context.Background(), 1)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if er := row["profile"].Set("age", 37); er != nil {
+		t.Fatal(er)
+	}
+
+	// The first update matches nothing, but the row is still there, so the
+	// fresh row is loaded and the update is retried.
+	fake.queue()
+	fake.queue([]driver.Value{true})
+	fake.queue([]driver.Value{[]byte(`{"age": 36, "name": "lovelace"}`)})
+	fake.queue([]driver.Value{"0123456789abcdef0123456789abcdef"})
+
+	if er := repo.Save(context.Background(), 1, row); er != nil {
+		t.Fatal(er)
+	}
+
+	expected := fakeStmt{
+		query: `UPDATE "users" SET "profile" = COALESCE("profile", '{}'::jsonb) || $2::jsonb WHERE "id" = $3 AND md5("profile"::text) = $1 RETURNING md5("profile"::text)`,
+		args:  []interface{}{"855b9b1f04b73bc3be344066a27ccbe1", `{"age":37}`, int64(1)},
+	}
+	if !reflect.DeepEqual(fake.execs[1], expected) {
+		t.Errorf("got %#v", fake.execs[1])
+	}
+
+	if fake.execs[1].args[0] == fake.execs[4].args[0] {
+		t.Errorf("retry used the stale hash")
+	}
+
+	dec, _ := row["profile"].decode()
+	if dec["name"] != "lovelace" || dec["age"] != 37 || row["profile"].Dirty() {
+		t.Errorf("got %#v", dec)
+	}
+
+	if row["profile"].origHash() != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("hash not updated: %s", row["profile"].origHash())
+	}
+}
@@ -0,0 +1,322 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ValidationError is a single problem found by Validate.
+type ValidationError struct {
+	// Path is a JSON Pointer to the offending value (or to the table, for
+	// rules which aren't about a single field).
+	Path string
+
+	// Rule is the name of the Rule that was broken, or "" if the value
+	// doesn't match its Type.
+	Rule    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return "jsonb: " + e.Message
+	}
+
+	return fmt.Sprintf("jsonb: %s: %s", e.Path, e.Message)
+}
+
+// Is makes errors.Is(er, ErrSchema) true for ValidationErrors.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrSchema
+}
+
+// ValidationErrors is the error returned by Validate, and by mutators when
+// a change would break a Rule.
+type ValidationErrors []*ValidationError
+
+func (es ValidationErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+func (es ValidationErrors) Is(target error) bool {
+	return target == ErrSchema
+}
+
+func (es *ValidationErrors) add(path, rule, msg string) {
+	*es = append(*es, &ValidationError{Path: path, Rule: rule, Message: msg})
+}
+
+// Rule is a constraint on a table which spans its fields, such as one field
+// requiring another. Rules are added to table Types with WithRules, and are
+// checked by IsValid, Validate and mutators.
+type Rule struct {
+	name string
+
+	// fields are the fields the rule was made with, if it can be written
+	// in the schema language (see FormatType), and value RequiredIf's
+	// value.
+	fields []string
+	value  interface{}
+
+	// fn returns the table's violations, with paths relative to it.
+	fn func(t map[string]interface{}) ValidationErrors
+}
+
+// Name returns the name of the rule (e.g. "requires").
+func (r Rule) Name() string {
+	return r.name
+}
+
+// WithRules returns a copy of the table Type ty with rules added.
+func (ty *Type) WithRules(rules ...Rule) *Type {
+	out := *ty
+	out.Rules = append(append([]Rule(nil), ty.Rules...), rules...)
+	return &out
+}
+
+func quoteFields(fields []string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = strconv.Quote(f)
+	}
+
+	return strings.Join(quoted, ", ")
+}
+
+// Required makes fields required.
+func Required(fields ...string) Rule {
+	return Rule{name: "required", fields: fields, fn: func(t map[string]interface{}) (errs ValidationErrors) {
+		for _, f := range fields {
+			if _, ok := t[f]; !ok {
+				errs.add(pointerAppend("", f), "required", "required")
+			}
+		}
+		return
+	}}
+}
+
+// Requires makes the fields in required required whenever field is set.
+func Requires(field string, required ...string) Rule {
+	return Rule{name: "requires", fields: append([]string{field}, required...), fn: func(t map[string]interface{}) (errs ValidationErrors) {
+		if _, ok := t[field]; !ok {
+			return nil
+		}
+
+		for _, f := range required {
+			if _, ok := t[f]; !ok {
+				errs.add(pointerAppend("", f), "requires", fmt.Sprintf("required when %q is set", field))
+			}
+		}
+		return
+	}}
+}
+
+// RequiredIf makes field required whenever the field cond is set to value.
+func RequiredIf(field, cond string, value interface{}) Rule {
+	return Rule{name: "required_if", fields: []string{field, cond}, value: value, fn: func(t map[string]interface{}) (errs ValidationErrors) {
+		if v, ok := t[cond]; !ok || !valueEqual(v, value) {
+			return nil
+		}
+
+		if _, ok := t[field]; !ok {
+			bs, _ := json.Marshal(value)
+			errs.add(pointerAppend("", field), "required_if", fmt.Sprintf("required when %q is %s", cond, bs))
+		}
+		return
+	}}
+}
+
+// MutuallyExclusive allows at most one of fields to be set.
+func MutuallyExclusive(fields ...string) Rule {
+	return Rule{name: "mutually_exclusive", fields: fields, fn: func(t map[string]interface{}) (errs ValidationErrors) {
+		first := ""
+		for _, f := range fields {
+			if _, ok := t[f]; !ok {
+				continue
+			}
+
+			if first == "" {
+				first = f
+			} else {
+				errs.add(pointerAppend("", f), "mutually_exclusive", fmt.Sprintf("can't be set with %q", first))
+			}
+		}
+		return
+	}}
+}
+
+// ExactlyOne requires exactly one of fields to be set.
+func ExactlyOne(fields ...string) Rule {
+	return Rule{name: "exactly_one", fields: fields, fn: func(t map[string]interface{}) (errs ValidationErrors) {
+		first := ""
+		for _, f := range fields {
+			if _, ok := t[f]; !ok {
+				continue
+			}
+
+			if first == "" {
+				first = f
+			} else {
+				errs.add(pointerAppend("", f), "exactly_one", fmt.Sprintf("can't be set with %q", first))
+			}
+		}
+
+		if first == "" {
+			errs.add("", "exactly_one", "one of "+quoteFields(fields)+" is required")
+		}
+		return
+	}}
+}
+
+// RuleFunc makes a Rule from a function, which is called with the table
+// and returns an error if it's invalid. The error may be a
+// *ValidationError or ValidationErrors, with paths relative to the table,
+// to point at particular fields; any other error is reported for the table
+// as a whole.
+func RuleFunc(name string, fn func(t map[string]interface{}) error) Rule {
+	return Rule{name: name, fn: func(t map[string]interface{}) ValidationErrors {
+		var errs ValidationErrors
+
+		switch er := fn(t).(type) {
+		case nil:
+			return nil
+		case *ValidationError:
+			errs = ValidationErrors{er}
+		case ValidationErrors:
+			errs = er
+		default:
+			errs.add("", name, er.Error())
+			return errs
+		}
+
+		// Copy, so the paths can be changed.
+		out := make(ValidationErrors, len(errs))
+		for i, e := range errs {
+			e1 := *e
+			if e1.Rule == "" {
+				e1.Rule = name
+			}
+			out[i] = &e1
+		}
+		return out
+	}}
+}
+
+// Validate checks val against the Type like IsValid, but returns every
+// problem it finds (as ValidationErrors), or nil if val is valid.
+func (ty *Type) Validate(val interface{}) error {
+	var errs ValidationErrors
+	ty.validate(val, "", &errs)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+// newViolations returns the problems Validate finds in out which weren't
+// already in old, so that documents which were read with AsUnsafe (or
+// before a Rule was added) can still be changed, as long as the changes
+// don't make things worse.
+func newViolations(ty *Type, old, out interface{}) error {
+	var errs ValidationErrors
+	ty.validate(out, "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	var prev ValidationErrors
+	ty.validate(old, "", &prev)
+
+	seen := make(map[ValidationError]bool, len(prev))
+	for _, e := range prev {
+		seen[*e] = true
+	}
+
+	var fresh ValidationErrors
+	for _, e := range errs {
+		if !seen[*e] {
+			fresh = append(fresh, e)
+		}
+	}
+
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	return fresh
+}
+
+func (ty *Type) validate(val interface{}, path string, errs *ValidationErrors) {
+	ty = ty.deref()
+
+	switch ty.Kind {
+	case KindTable:
+		t, ok := val.(map[string]interface{})
+		if !ok {
+			errs.add(path, "", "expected table")
+			return
+		}
+
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			fty, ok := ty.Fields[k]
+			if !ok {
+				errs.add(pointerAppend(path, k), "", "unknown field")
+				continue
+			}
+
+			fty.validate(t[k], pointerAppend(path, k), errs)
+		}
+
+		for _, r := range ty.Rules {
+			for _, e := range r.fn(t) {
+				e.Path = path + e.Path
+				*errs = append(*errs, e)
+			}
+		}
+
+	case KindList:
+		l, ok := val.([]interface{})
+		if !ok {
+			errs.add(path, "", "expected list")
+			return
+		}
+
+		if ty.MaxLen > 0 && ty.MaxLen < len(l) {
+			errs.add(path, "", fmt.Sprintf("more than %d elements", ty.MaxLen))
+		}
+
+		for i, v := range l {
+			ty.ListType.validate(v, pointerAppend(path, strconv.Itoa(i)), errs)
+		}
+
+	case KindRef:
+		errs.add(path, "", fmt.Sprintf("unresolved reference to %q", ty.Ref))
+
+	default:
+		if ty.IsValid(val) {
+			return
+		}
+
+		if _, ok := val.(string); ok && ty.Kind == KindString {
+			errs.add(path, "", fmt.Sprintf("longer than %d bytes", ty.MaxLen))
+		} else {
+			errs.add(path, "", "expected "+strings.Trim(kindStrings[ty.Kind], `"`))
+		}
+	}
+}
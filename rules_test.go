@@ -0,0 +1,160 @@
+package jsonb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testRuleType = NewTableType(TableDef{
+	"email": TypeString,
+	"phone": TypeString,
+	"start": TypeNumber,
+	"end":   TypeNumber,
+	"kind":  TypeString,
+	"vat":   TypeString,
+	"addr": NewTableType(TableDef{
+		"city": TypeString,
+		"zip":  TypeString,
+	}).WithRules(Requires("city", "zip")),
+}).WithRules(
+	ExactlyOne("email", "phone"),
+	Requires("end", "start"),
+	RequiredIf("vat", "kind", "business"),
+	RuleFunc("end_after_start", func(t map[string]interface{}) error {
+		start, ok1 := toFloat64(t["start"])
+		end, ok2 := toFloat64(t["end"])
+		if ok1 && ok2 && end < start {
+			return &ValidationError{Path: "/end", Message: "before start"}
+		}
+		return nil
+	}),
+)
+
+func testRuleErrors(er error) []string {
+	var errs ValidationErrors
+	if !errors.As(er, &errs) {
+		return nil
+	}
+
+	out := make([]string, len(errs))
+	for i, e := range errs {
+		out[i] = e.Path + " " + e.Rule
+	}
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src  string
+		errs []string
+	}{
+		{`{"email": "a@b"}`, nil},
+		{`{}`, []string{" exactly_one"}},
+		{`{"email": "a@b", "phone": "1"}`, []string{"/phone exactly_one"}},
+		{`{"phone": "1", "end": 1}`, []string{"/start requires"}},
+		{`{"phone": "1", "start": 2, "end": 1}`, []string{"/end end_after_start"}},
+		{`{"phone": "1", "kind": "business"}`, []string{"/vat required_if"}},
+		{`{"phone": "1", "kind": "person"}`, nil},
+		{`{"phone": "1", "addr": {"city": "x"}}`, []string{"/addr/zip requires"}},
+		{`{"phone": 1, "nope": true}`, []string{"/nope ", "/phone "}},
+	}
+
+	for _, test := range tests {
+		var tab Table
+		if er := tab.Scan(test.src); er != nil {
+			t.Fatal(er)
+		}
+		dec, _ := tab.decode()
+
+		er := testRuleType.Validate(dec)
+		if errs := testRuleErrors(er); !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("%s: got %v (%v), expected %v", test.src, errs, er, test.errs)
+		}
+
+		if testRuleType.IsValid(dec) != (test.errs == nil) {
+			t.Errorf("%s: IsValid disagrees", test.src)
+		}
+
+		if er != nil && !errors.Is(er, ErrSchema) {
+			t.Errorf("%s: %v isn't ErrSchema", test.src, er)
+		}
+	}
+}
+
+func TestRulesMutators(t *testing.T) {
+	var tab Table
+	if er := tab.Scan(`{"email": "a@b", "start": 1}`); er != nil {
+		t.Fatal(er)
+	}
+
+	mt, er := tab.As(testRuleType)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	er = mt.Set("phone", "1")
+	if errs := testRuleErrors(er); !reflect.DeepEqual(errs, []string{"/phone exactly_one"}) {
+		t.Errorf("got %v", er)
+	}
+
+	er = mt.Set("end", 0)
+	if errs := testRuleErrors(er); !reflect.DeepEqual(errs, []string{"/end end_after_start"}) {
+		t.Errorf("got %v", er)
+	}
+
+	if er := mt.Delete("email"); er == nil {
+		t.Errorf("deleting the only contact should fail")
+	}
+
+	// Swapping email for phone is fine as a batch.
+	if er := mt.Batch().Delete("email").Set("phone", "1").Commit(); er != nil {
+		t.Error(er)
+	}
+
+	// Rules in sub-views are checked too.
+	addr, er := mt.Sub("addr")
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	er = addr.Set("city", "x")
+	if errs := testRuleErrors(er); !reflect.DeepEqual(errs, []string{"/addr/zip requires"}) {
+		t.Errorf("got %v", er)
+	}
+
+	if er := mt.ApplyMergePatch([]byte(`{"addr": {"city": "x", "zip": "1"}}`)); er != nil {
+		t.Error(er)
+	}
+
+	expected := map[string]interface{}{
+		"phone": "1",
+		"start": float64(1),
+		"addr":  map[string]interface{}{"city": "x", "zip": "1"},
+	}
+	if dec, _ := mt.decode(); !reflect.DeepEqual(dec, expected) {
+		t.Errorf("got %#v", dec)
+	}
+}
+
+func TestRulesExistingViolations(t *testing.T) {
+	var tab Table
+	if er := tab.Scan(`{"email": "a@b", "phone": "1"}`); er != nil {
+		t.Fatal(er)
+	}
+
+	if _, er := tab.As(testRuleType); er != ErrSchema {
+		t.Errorf("got %v, expected ErrSchema", er)
+	}
+
+	// Old violations don't stop other changes...
+	mt := tab.AsUnsafe(testRuleType)
+	if er := mt.Set("start", 1); er != nil {
+		t.Error(er)
+	}
+
+	// ...but new ones do.
+	if er := mt.Set("kind", "business"); er == nil {
+		t.Errorf("expected a required_if violation")
+	}
+}
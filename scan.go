@@ -0,0 +1,92 @@
+package jsonb
+
+// jsonbVersion is the version header PostgreSQL puts in front of jsonb's
+// binary format (which is otherwise just the text format).
+const jsonbVersion = 1
+
+// scanBytes returns a copy of the raw JSON in an SQL source value. lib/pq
+// and pgx's stdlib hand over []byte, while some drivers (and pgx's simple
+// protocol) hand over strings. Values in the binary format have their
+// version header stripped.
+func scanBytes(src interface{}) ([]byte, error) {
+	var bs []byte
+
+	switch v := src.(type) {
+	case []byte:
+		bs = v
+	case string:
+		bs = []byte(v)
+	default:
+		return nil, ErrInvalidScanType
+	}
+
+	// NB: JSON text can't start with a control character other than
+	// whitespace, so anything else is a binary format header.
+	if len(bs) > 0 && bs[0] < ' ' && bs[0] != '\t' && bs[0] != '\n' && bs[0] != '\r' {
+		if bs[0] != jsonbVersion {
+			return nil, ErrUnknownJsonbVersion
+		}
+		bs = bs[1:]
+	}
+
+	// NB: The buffer *MUST* be copied since it's re-used by pq
+	// and will be filled with garbage.
+	newSlice := make([]byte, len(bs))
+	copy(newSlice, bs)
+	return newSlice, nil
+}
+
+// binaryBytes checks and strips the version header of a value in jsonb's
+// binary format, returning a copy of the rest.
+func binaryBytes(bs []byte) ([]byte, error) {
+	if len(bs) == 0 || bs[0] != jsonbVersion {
+		return nil, ErrUnknownJsonbVersion
+	}
+
+	out := make([]byte, len(bs)-1)
+	copy(out, bs[1:])
+	return out, nil
+}
+
+// MarshalBinary encodes the Table in jsonb's binary wire format (version 1).
+// Value always produces the text format, since that's what database/sql
+// drivers expect.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	raw, er := t.encode()
+	if er != nil {
+		return nil, er
+	}
+
+	return append([]byte{jsonbVersion}, raw...), nil
+}
+
+// UnmarshalBinary decodes a Table from jsonb's binary wire format.
+func (t *Table) UnmarshalBinary(bs []byte) error {
+	bs, er := binaryBytes(bs)
+	if er != nil {
+		return er
+	}
+
+	// NB: Not Scan, which would strip a second header.
+	return t.scanRaw(bs)
+}
+
+// MarshalBinary encodes the List in jsonb's binary wire format (version 1).
+func (l *List) MarshalBinary() ([]byte, error) {
+	raw, er := l.encode()
+	if er != nil {
+		return nil, er
+	}
+
+	return append([]byte{jsonbVersion}, raw...), nil
+}
+
+// UnmarshalBinary decodes a List from jsonb's binary wire format.
+func (l *List) UnmarshalBinary(bs []byte) error {
+	bs, er := binaryBytes(bs)
+	if er != nil {
+		return er
+	}
+
+	return l.scanRaw(bs)
+}
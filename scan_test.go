@@ -0,0 +1,163 @@
+package jsonb
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDataRow reads a hex dump of a DataRow message captured from the
+// binary protocol and returns its column values.
+func testDataRow(t *testing.T, name string) [][]byte {
+	dump, er := ioutil.ReadFile(filepath.Join("testdata", "binary", name))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	msg, er := hex.DecodeString(strings.Join(strings.Fields(string(dump)), ""))
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if len(msg) < 7 || msg[0] != 'D' || int(binary.BigEndian.Uint32(msg[1:])) != len(msg)-1 {
+		t.Fatalf("%s: not a DataRow message", name)
+	}
+
+	ncols := int(binary.BigEndian.Uint16(msg[5:]))
+	msg = msg[7:]
+
+	cols := make([][]byte, ncols)
+	for i := range cols {
+		n := int(binary.BigEndian.Uint32(msg))
+		cols[i], msg = msg[4:4+n], msg[4+n:]
+	}
+
+	return cols
+}
+
+func TestScanBinaryTable(t *testing.T) {
+	cols := testDataRow(t, "table.hex")
+
+	var tab Table
+	if er := tab.Scan(cols[0]); er != nil {
+		t.Fatal(er)
+	}
+
+	got, er := tab.decode()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := map[string]interface{}{
+		"a": float64(1),
+		"b": "x\ty",
+		"c": map[string]interface{}{
+			"d": []interface{}{true, nil},
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v", got)
+	}
+
+	// The binary encoding is the version followed by the text.
+	bs, er := tab.MarshalBinary()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	var tab2 Table
+	if er := tab2.UnmarshalBinary(bs); er != nil {
+		t.Fatal(er)
+	}
+
+	if got2, _ := tab2.decode(); !reflect.DeepEqual(got2, expected) {
+		t.Errorf("round trip: got %#v", got2)
+	}
+
+	// Value stays in the text format.
+	val, er := tab2.Value()
+	if er != nil {
+		t.Fatal(er)
+	}
+	if bs := val.([]byte); len(bs) == 0 || bs[0] != '{' {
+		t.Errorf("Value: got %q", bs)
+	}
+}
+
+func TestScanBinaryList(t *testing.T) {
+	cols := testDataRow(t, "list.hex")
+
+	var l List
+	if er := l.Scan(cols[0]); er != nil {
+		t.Fatal(er)
+	}
+
+	got, er := l.decode()
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	expected := []interface{}{float64(1), "two", map[string]interface{}{"three": float64(3)}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v", got)
+	}
+
+	bs, er := l.MarshalBinary()
+	if er != nil {
+		t.Fatal(er)
+	}
+	if bs[0] != jsonbVersion || bs[1] != '[' {
+		t.Errorf("MarshalBinary: got %q", bs)
+	}
+}
+
+func TestScanBinaryEmpty(t *testing.T) {
+	cols := testDataRow(t, "empty.hex")
+
+	var (
+		tab Table
+		l   List
+	)
+
+	if er := tab.Scan(cols[0]); er != nil {
+		t.Fatal(er)
+	}
+	if er := l.Scan(cols[1]); er != nil {
+		t.Fatal(er)
+	}
+
+	// Scanning a List as a Table (and vice versa) still fails.
+	if er := tab.Scan(cols[1]); er != ErrInvalidJsonType {
+		t.Errorf("got %v, expected ErrInvalidJsonType", er)
+	}
+}
+
+func TestScanBinaryBadVersion(t *testing.T) {
+	var tab Table
+
+	if er := tab.Scan([]byte("\x02{}")); er != ErrUnknownJsonbVersion {
+		t.Errorf("got %v, expected ErrUnknownJsonbVersion", er)
+	}
+
+	if er := tab.UnmarshalBinary([]byte("{}")); er != ErrUnknownJsonbVersion {
+		t.Errorf("got %v, expected ErrUnknownJsonbVersion", er)
+	}
+
+	// Only one header is stripped.
+	if er := tab.UnmarshalBinary([]byte("\x01\x01{}")); er != ErrInvalidJsonType {
+		t.Errorf("got %v, expected ErrInvalidJsonType", er)
+	}
+
+	var l List
+	if er := l.UnmarshalBinary([]byte("\x01\x01[]")); er != ErrInvalidJsonType {
+		t.Errorf("got %v, expected ErrInvalidJsonType", er)
+	}
+
+	if er := tab.Scan([]byte("\n{}")); er != ErrInvalidJsonType {
+		t.Errorf("got %v, expected ErrInvalidJsonType", er)
+	}
+}
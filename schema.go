@@ -0,0 +1,206 @@
+package jsonb
+
+import (
+	"sort"
+)
+
+// DefaultVersionField is the field name used by NewSchema when no version
+// field is given.
+const DefaultVersionField = "_version"
+
+// Migration upgrades a decoded document in-place from the previous
+// registered version of a Schema to the version it was registered with.
+// Migrations don't need to update the version field; that's done by the
+// Schema after the migration returns.
+type Migration func(doc map[string]interface{}) error
+
+type schemaVersion struct {
+	version int
+	ty      *Type
+	migrate Migration
+}
+
+// Schema is a registry of versioned table Types. Each document stores the
+// version it was written with in a number field (VersionField); when an old
+// document is read via Table.AsSchema, the migrations between its version
+// and the latest one are run in order.
+//
+// Documents without a version field are assumed to be the oldest registered
+// version.
+type Schema struct {
+	// VersionField is the name of the table field holding the version.
+	// Every registered Type must declare it (typically as TypeNumber).
+	VersionField string
+
+	versions []schemaVersion
+}
+
+// NewSchema returns an empty Schema which keeps the document version in the
+// given field. If versionField is empty, DefaultVersionField is used.
+func NewSchema(versionField string) *Schema {
+	if versionField == "" {
+		versionField = DefaultVersionField
+	}
+
+	return &Schema{
+		VersionField: versionField,
+	}
+}
+
+// Register adds a version of the schema. migrate upgrades a document from the
+// next-lowest registered version to this one; it's ignored for the oldest
+// version and may be nil if the upgrade only requires bumping the version
+// field. ErrSchema is returned if ty isn't a table type declaring the version
+// field, or if the version is already registered.
+func (s *Schema) Register(version int, ty *Type, migrate Migration) error {
+	ty = ty.deref()
+	if ty.Kind != KindTable {
+		return ErrSchema
+	}
+
+	if _, ok := ty.Fields[s.VersionField]; !ok {
+		return ErrSchema
+	}
+
+	i := sort.Search(len(s.versions), func(i int) bool {
+		return s.versions[i].version >= version
+	})
+	if i < len(s.versions) && s.versions[i].version == version {
+		return ErrSchema
+	}
+
+	s.versions = append(s.versions, schemaVersion{})
+	copy(s.versions[i+1:], s.versions[i:])
+	s.versions[i] = schemaVersion{
+		version: version,
+		ty:      ty,
+		migrate: migrate,
+	}
+
+	return nil
+}
+
+// Latest returns the newest registered version and its Type. If nothing has
+// been registered, the Type is nil.
+func (s *Schema) Latest() (int, *Type) {
+	if len(s.versions) == 0 {
+		return 0, nil
+	}
+
+	v := s.versions[len(s.versions)-1]
+	return v.version, v.ty
+}
+
+// Type returns the Type registered for the given version, or nil.
+func (s *Schema) Type(version int) *Type {
+	if i := s.index(version); i >= 0 {
+		return s.versions[i].ty
+	}
+
+	return nil
+}
+
+func (s *Schema) index(version int) int {
+	for i, v := range s.versions {
+		if v.version == version {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Version returns the version a document was written with. ErrUnknownVersion
+// is returned if the version field isn't an integer or isn't registered.
+func (s *Schema) Version(doc map[string]interface{}) (int, error) {
+	if len(s.versions) == 0 {
+		return 0, ErrUnknownVersion
+	}
+
+	ival, ok := doc[s.VersionField]
+	if !ok {
+		return s.versions[0].version, nil
+	}
+
+	f, ok := toFloat64(ival)
+	if !ok || f != float64(int(f)) || s.index(int(f)) < 0 {
+		return 0, ErrUnknownVersion
+	}
+
+	return int(f), nil
+}
+
+// Upgrade validates doc against the Type of the version it was written with,
+// then migrates it to the latest version. The upgraded document is returned
+// along with whether any migrations were run; doc itself is not modified.
+func (s *Schema) Upgrade(doc map[string]interface{}) (map[string]interface{}, bool, error) {
+	version, er := s.Version(doc)
+	if er != nil {
+		return nil, false, er
+	}
+
+	i := s.index(version)
+	if !s.versions[i].ty.IsValid(doc) {
+		return nil, false, ErrSchema
+	}
+
+	if i == len(s.versions)-1 {
+		return doc, false, nil
+	}
+
+	out := deepCopy(doc).(map[string]interface{})
+	for _, v := range s.versions[i+1:] {
+		if v.migrate != nil {
+			if er := v.migrate(out); er != nil {
+				return nil, false, er
+			}
+		}
+
+		out[s.VersionField] = float64(v.version)
+
+		// Checking each step (instead of just the final result) makes it
+		// much easier to tell which migration is broken.
+		if !v.ty.IsValid(out) {
+			return nil, false, ErrSchema
+		}
+	}
+
+	return out, true, nil
+}
+
+// NewTable returns an empty MutableTable of the latest version, with the
+// version field already filled in.
+func (s *Schema) NewTable() *MutableTable {
+	version, ty := s.Latest()
+	mt := NewTable(ty)
+	mt.decoded[s.VersionField] = float64(version)
+	return mt
+}
+
+// AsSchema is like As, but the Table is first upgraded to the latest version
+// of the Schema. If any migrations were run, the resulting MutableTable is
+// marked dirty so the upgraded document can be written back.
+func (t *Table) AsSchema(s *Schema) (*MutableTable, error) {
+	dec, er := t.decode()
+	if er != nil {
+		return nil, er
+	}
+
+	out, upgraded, er := s.Upgrade(dec)
+	if er != nil {
+		return nil, er
+	}
+
+	if upgraded {
+		t.decoded = out
+		t.markRewritten()
+	}
+
+	_, ty := s.Latest()
+	mt := t.AsUnsafe(ty)
+	if er := mt.fillDefaults(); er != nil {
+		return nil, er
+	}
+
+	return mt, nil
+}
@@ -0,0 +1,159 @@
+package jsonb
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func testSchema(t *testing.T) *Schema {
+	s := NewSchema("")
+
+	v1 := NewTableType(TableDef{
+		DefaultVersionField: TypeNumber,
+		"name":              TypeString,
+	})
+	v2 := NewTableType(TableDef{
+		DefaultVersionField: TypeNumber,
+		"first":             TypeString,
+		"last":              TypeString,
+	})
+	v3 := NewTableType(TableDef{
+		DefaultVersionField: TypeNumber,
+		"first":             TypeString,
+		"last":              TypeString,
+		"tags":              TypeStringList,
+	})
+
+	// Registered out of order on purpose.
+	if er := s.Register(3, v3, nil); er != nil {
+		t.Fatal(er)
+	}
+	if er := s.Register(1, v1, nil); er != nil {
+		t.Fatal(er)
+	}
+	if er := s.Register(2, v2, func(doc map[string]interface{}) error {
+		name, _ := doc["name"].(string)
+		parts := strings.SplitN(name, " ", 2)
+		delete(doc, "name")
+
+		doc["first"] = parts[0]
+		if len(parts) > 1 {
+			doc["last"] = parts[1]
+		}
+		return nil
+	}); er != nil {
+		t.Fatal(er)
+	}
+
+	return s
+}
+
+func TestSchemaRegister(t *testing.T) {
+	s := testSchema(t)
+
+	if er := s.Register(2, s.Type(2), nil); er != ErrSchema {
+		t.Error("duplicate version should fail")
+	}
+	if er := s.Register(4, NewTableType(TableDef{}), nil); er != ErrSchema {
+		t.Error("missing version field should fail")
+	}
+	if er := s.Register(4, TypeNumber, nil); er != ErrSchema {
+		t.Error("non-table type should fail")
+	}
+
+	if v, ty := s.Latest(); v != 3 || ty != s.Type(3) {
+		t.Errorf("wrong latest version %d", v)
+	}
+}
+
+func TestSchemaUpgrade(t *testing.T) {
+	s := testSchema(t)
+	tb := Table{
+		raw: json.RawMessage(`{"_version":1,"name":"Ada Lovelace"}`),
+	}
+
+	mt, er := tb.AsSchema(s)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if !mt.Dirty() {
+		t.Error("upgraded table should be dirty")
+	}
+
+	bs, er := json.Marshal(mt)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if string(bs) != `{"_version":3,"first":"Ada","last":"Lovelace"}` {
+		t.Errorf("wrong serialization %s", bs)
+	}
+}
+
+func TestSchemaMissingVersion(t *testing.T) {
+	s := testSchema(t)
+	tb := Table{
+		raw: json.RawMessage(`{"name":"Ada"}`),
+	}
+
+	mt, er := tb.AsSchema(s)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if v, er := s.Version(mt.decoded); er != nil || v != 3 {
+		t.Errorf("wrong version %d (%v)", v, er)
+	}
+}
+
+func TestSchemaCurrent(t *testing.T) {
+	s := testSchema(t)
+	tb := Table{
+		raw: json.RawMessage(`{"_version":3,"first":"Ada"}`),
+	}
+
+	mt, er := tb.AsSchema(s)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if mt.Dirty() {
+		t.Error("current table should not be dirty")
+	}
+}
+
+func TestSchemaBad(t *testing.T) {
+	s := testSchema(t)
+
+	for _, raw := range []string{
+		`{"_version":4}`,
+		`{"_version":1.5}`,
+		`{"_version":"1"}`,
+	} {
+		tb := Table{raw: json.RawMessage(raw)}
+		if _, er := tb.AsSchema(s); er != ErrUnknownVersion {
+			t.Errorf("%s: expected ErrUnknownVersion, got %v", raw, er)
+		}
+	}
+
+	// Valid version, but the document doesn't match that version.
+	tb := Table{raw: json.RawMessage(`{"_version":1,"first":"Ada"}`)}
+	if _, er := tb.AsSchema(s); er != ErrSchema {
+		t.Errorf("expected ErrSchema, got %v", er)
+	}
+}
+
+func TestSchemaNewTable(t *testing.T) {
+	s := testSchema(t)
+	mt := s.NewTable()
+
+	if er := mt.Set("first", "Ada"); er != nil {
+		t.Fatal(er)
+	}
+
+	bs, er := json.Marshal(mt)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if string(bs) != `{"_version":3,"first":"Ada"}` {
+		t.Errorf("wrong serialization %s", bs)
+	}
+}
@@ -0,0 +1,63 @@
+package jsonb
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quoteIdent quotes a single SQL identifier (e.g. a column name).
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// quoteName quotes a possibly schema-qualified name (e.g. "public.users").
+func quoteName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteIdent(p)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// quoteLiteral quotes a string as an SQL literal. It assumes
+// standard_conforming_strings is on (the default since PostgreSQL 9.1).
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// quotePathString quotes a string as a jsonpath string literal.
+func quotePathString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r < 0x20:
+			fmt.Fprintf(&buf, "\\u%04x", r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// jsonbPath appends a chain of -> operators to the jsonb expression expr.
+// The operands must already be quoted (see quoteLiteral). If text is set, the
+// final operator is ->> instead.
+func jsonbPath(expr string, operands []string, text bool) string {
+	for i, op := range operands {
+		if text && i == len(operands)-1 {
+			expr += " ->> " + op
+		} else {
+			expr += " -> " + op
+		}
+	}
+
+	return expr
+}
@@ -1,14 +1,46 @@
 package jsonb
 
 import (
+	"crypto/md5"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"strings"
 )
 
 type Table struct {
 	raw     json.RawMessage
 	decoded map[string]interface{}
+
+	// dirty is set when the decoded value has been changed in a way that
+	// hasn't been written back to the database yet.
+	dirty bool
+
+	// changed holds the top-level keys that have been set since the Table
+	// was read, so it can be written back with a partial update. It's nil
+	// (while dirty is set) when the whole document needs to be rewritten.
+	changed map[string]bool
+
+	// paths holds the JSON Pointers of the values that have been changed
+	// (see Changed). It's nil (while dirty is set) when they aren't known,
+	// e.g. after a migration.
+	paths map[string]bool
+
+	// orig is the document as it was scanned, and hash its md5 once it's
+	// been computed (or once it's been saved by a Repository). Both are
+	// empty if the Table didn't come from the database.
+	orig json.RawMessage
+	hash string
+
+	// hist is the undo/redo history, if it's been enabled.
+	hist *history
+
+	// obs holds the change hooks. For sub-views, root is the MutableTable
+	// holding the document and path the view's JSON Pointer within it.
+	obs  *observers
+	root *MutableTable
+	path string
 }
 
 type MutableTable struct {
@@ -19,16 +51,39 @@ type MutableTable struct {
 var _ sql.Scanner = &Table{}
 var _ driver.Valuer = &Table{}
 
+// NewTable returns a new, empty MutableTable with the given type. If ty
+// uses DefaultsMaterialize, its defaults are filled in (and it panics if a
+// DefaultFunc makes an invalid value, or the defaults break a Rule).
 func NewTable(ty *Type) *MutableTable {
-	return &MutableTable{
-		ty: ty,
+	mt := &MutableTable{
+		ty: ty.deref(),
 		Table: &Table{
 			decoded: make(map[string]interface{}),
 		},
 	}
+
+	if er := mt.fillDefaults(); er != nil {
+		panic(er)
+	}
+
+	return mt
 }
 
 func (t *Table) decode() (map[string]interface{}, error) {
+	if t.root != nil {
+		val, er := t.root.resolveView(t.path, map[string]interface{}{})
+		if er != nil {
+			return nil, er
+		}
+
+		dec, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, ErrPatchPath
+		}
+
+		t.decoded = dec
+	}
+
 	if t.decoded == nil {
 		if er := json.Unmarshal(t.raw, &t.decoded); er != nil {
 			return nil, er
@@ -58,10 +113,14 @@ func (t *Table) AsUnsafe(ty *Type) *MutableTable {
 
 	return &MutableTable{
 		Table: t,
-		ty:    ty,
+		ty:    ty.deref(),
 	}
 }
 
+// As returns the Table as a MutableTable of the given type, or ErrSchema if
+// it isn't valid for it. If ty uses DefaultsMaterialize, missing fields'
+// defaults are filled in (and marked as changed), unless that would break a
+// Rule, in which case the ValidationErrors are returned.
 func (t *Table) As(ty *Type) (*MutableTable, error) {
 	dec, er := t.decode()
 	if er != nil {
@@ -72,15 +131,67 @@ func (t *Table) As(ty *Type) (*MutableTable, error) {
 		return nil, ErrSchema
 	}
 
-	return t.AsUnsafe(ty), nil
+	mt := t.AsUnsafe(ty)
+	if er := mt.fillDefaults(); er != nil {
+		return nil, er
+	}
+
+	return mt, nil
 }
 
-func (t *Table) Scan(src interface{}) error {
-	bs, ok := src.([]byte)
+// AsCoerce is like As, but values which don't match ty are converted to
+// the expected kind where possible (see Type.Coerce). The JSON Pointers of
+// every converted value are returned so they can be written back. If the
+// converted document breaks one of ty's Rules, the ValidationErrors are
+// returned.
+func (t *Table) AsCoerce(ty *Type) (*MutableTable, []string, error) {
+	dec, er := t.decode()
+	if er != nil {
+		return nil, nil, er
+	}
+
+	out, paths, ok := ty.Coerce(dec)
 	if !ok {
-		return ErrInvalidScanType
+		return nil, nil, ErrSchema
 	}
 
+	// NB: If ty isn't a table type, Coerce may hand back something that
+	// isn't a map (e.g. KindAny).
+	tab, ok := out.(map[string]interface{})
+	if !ok {
+		return nil, nil, ErrSchema
+	}
+
+	// NB: Coerce only fixes up values, so the result may still break a
+	// Rule.
+	if er := ty.Validate(tab); er != nil {
+		return nil, nil, er
+	}
+
+	t.decoded = tab
+	if len(paths) > 0 {
+		t.markRewritten()
+	}
+
+	mt := t.AsUnsafe(ty)
+	if er := mt.fillDefaults(); er != nil {
+		return nil, nil, er
+	}
+
+	return mt, paths, nil
+}
+
+func (t *Table) Scan(src interface{}) error {
+	bs, er := scanBytes(src)
+	if er != nil {
+		return er
+	}
+
+	return t.scanRaw(bs)
+}
+
+// scanRaw sets the Table to the JSON text bs, which it takes ownership of.
+func (t *Table) scanRaw(bs []byte) error {
 	if len(bs) == 0 || bs[0] != '{' {
 		// XXX: This might cause some horrible things to happen (e.g. data
 		// gets locked in the database and can't be fixed). It makes sense
@@ -90,16 +201,128 @@ func (t *Table) Scan(src interface{}) error {
 		return ErrInvalidJsonType
 	}
 
-	// NB: The buffer *MUST* be copied since it's re-used by pq
-	// and will be filled with garbage.
-	newSlice := make([]byte, len(bs))
-	copy(newSlice, bs)
-
-	t.raw = json.RawMessage(newSlice)
+	t.raw = json.RawMessage(bs)
 	t.decoded = nil
+	t.orig, t.hash = t.raw, ""
+	t.hist.reset()
+	t.MarkClean()
 	return nil
 }
 
+// Dirty returns true if the Table has been modified (e.g. via Set or by a
+// migration) since it was read.
+func (t *Table) Dirty() bool {
+	return t.dirty
+}
+
+// MarkClean clears the dirty flag; call it once the Table has been written
+// back to the database.
+func (t *Table) MarkClean() {
+	t.dirty = false
+	t.changed, t.paths = nil, nil
+	t.hist.markClean()
+}
+
+// Changed returns true if key has been changed since the Table was read (or
+// marked clean), i.e. if it's part of the next write. Every key counts as
+// changed when the document was rewritten as a whole (e.g. by a migration or
+// coercion).
+//
+// For sub-views (see Sub), it's whether key within the view has changed,
+// which includes the view itself (or anything containing it) being replaced.
+func (t *Table) Changed(key string) bool {
+	if t.root != nil {
+		return t.root.changedAt(pointerAppend(t.path, key))
+	}
+
+	return t.changedAt(pointerAppend("", key))
+}
+
+// changedAt returns true if the value at path, something inside it or
+// something containing it has changed.
+func (t *Table) changedAt(path string) bool {
+	if !t.dirty {
+		return false
+	}
+
+	if t.paths == nil {
+		return true
+	}
+
+	for p := range t.paths {
+		if p == path || strings.HasPrefix(path, p+"/") || strings.HasPrefix(p, path+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *Table) markRewritten() {
+	t.dirty = true
+	t.changed = nil
+	t.paths = nil
+}
+
+// markChanged records a change to the value at path (which is within a
+// top-level key). removed is set when the top-level key was removed, which
+// can't be written back with a partial update.
+func (t *Table) markChanged(path string, removed bool) {
+	if !t.dirty {
+		t.dirty = true
+		t.changed = make(map[string]bool)
+		t.paths = make(map[string]bool)
+	}
+
+	toks, _ := pointerTokens(path)
+	if removed {
+		t.changed = nil
+	} else if t.changed != nil {
+		t.changed[toks[0]] = true
+	}
+
+	if t.paths != nil {
+		t.paths[path] = true
+	}
+}
+
+// origHash returns the md5 (in hex) of the document as it was scanned,
+// which matches PostgreSQL's md5(column::text), or "" if it wasn't scanned.
+func (t *Table) origHash() string {
+	if t.hash == "" && t.orig != nil {
+		sum := md5.Sum(t.orig)
+		t.hash = hex.EncodeToString(sum[:])
+	}
+
+	return t.hash
+}
+
+// changes returns what needs to be written back to the database: either
+// the whole document (full is true), or just the top-level keys in patch
+// (which can be applied with the || operator). Both are zero if the Table
+// isn't dirty.
+func (t *Table) changes() (full bool, patch map[string]interface{}, er error) {
+	if !t.dirty {
+		return false, nil, nil
+	}
+
+	if t.changed == nil {
+		return true, nil, nil
+	}
+
+	dec, er := t.decode()
+	if er != nil {
+		return false, nil, er
+	}
+
+	patch = make(map[string]interface{}, len(t.changed))
+	for k := range t.changed {
+		patch[k] = dec[k]
+	}
+
+	return false, patch, nil
+}
+
 func (t *Table) Value() (driver.Value, error) {
 	raw, er := t.encode()
 	return []byte(raw), er
@@ -118,6 +341,9 @@ func (t *Table) UnmarshalJSON(bs []byte) error {
 
 	// NOTE: See notes in List.UnmarshalJSON.
 	t.decoded = val
+	t.orig, t.hash = nil, ""
+	t.hist.reset()
+	t.MarkClean()
 	return nil
 }
 
@@ -136,7 +362,7 @@ func (mt *MutableTable) UnmarshalJSON(bs []byte) error {
 
 func (mt *MutableTable) Set(key string, val interface{}) error {
 	ty, ok := mt.ty.Fields[key]
-	if !ok || !ty.IsValid(val) {
+	if !ok || !ty.validTypes(val) {
 		return ErrSchema
 	}
 
@@ -145,6 +371,41 @@ func (mt *MutableTable) Set(key string, val interface{}) error {
 		return er
 	}
 
-	dec[key] = val
-	return nil
+	old, ok := dec[key]
+	out := make(map[string]interface{}, len(dec)+1)
+	for k, v := range dec {
+		out[k] = v
+	}
+	out[key] = val
+
+	ev := keyEvent(pointerAppend("", key), old, ok, val, true)
+	return mt.update(dec, out, []ChangeEvent{ev})
+}
+
+// Delete removes key from the MutableTable. It returns ErrSchema if key
+// isn't a field of the Table's Type.
+func (mt *MutableTable) Delete(key string) error {
+	if _, ok := mt.ty.Fields[key]; !ok {
+		return ErrSchema
+	}
+
+	dec, er := mt.decode()
+	if er != nil {
+		return er
+	}
+
+	old, ok := dec[key]
+	if !ok {
+		return nil
+	}
+
+	out := make(map[string]interface{}, len(dec))
+	for k, v := range dec {
+		if k != key {
+			out[k] = v
+		}
+	}
+
+	ev := keyEvent(pointerAppend("", key), old, true, nil, false)
+	return mt.update(dec, out, []ChangeEvent{ev})
 }
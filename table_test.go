@@ -145,3 +145,48 @@ func TestTableCoerceBad(t *testing.T) {
 		t.Fatal(er)
 	}
 }
+
+func TestTableDirty(t *testing.T) {
+	tb := Table{
+		raw: json.RawMessage(`{"one":1}`),
+	}
+	ty := NewTableType(TableDef{
+		"one": TypeNumber,
+		"two": TypeNumber,
+	})
+
+	mt, er := tb.As(ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+	if mt.Dirty() || mt.Changed("one") {
+		t.Error("should be clean")
+	}
+
+	if er := mt.Set("one", 2); er != nil {
+		t.Fatal(er)
+	}
+	if !mt.Dirty() || !mt.Changed("one") || mt.Changed("two") {
+		t.Error("should be dirty")
+	}
+
+	mt.MarkClean()
+	if mt.Dirty() || mt.Changed("one") {
+		t.Error("should be clean")
+	}
+}
+
+func TestTableScanString(t *testing.T) {
+	var tab Table
+	if er := tab.Scan(`{"a":1}`); er != nil {
+		t.Fatal(er)
+	}
+
+	if bs, er := tab.MarshalJSON(); er != nil || string(bs) != `{"a":1}` {
+		t.Errorf("got %s, %v", bs, er)
+	}
+
+	if er := tab.Scan(1); er != ErrInvalidScanType {
+		t.Errorf("got %v, expected ErrInvalidScanType", er)
+	}
+}
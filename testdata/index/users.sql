@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS "public_users_doc_idx_aa49b61f" ON "public"."Users" USING gin ("doc" jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS "public_users_doc_active_idx_d1280c21" ON "public"."Users" ((("doc" ->> 'active')::boolean));
+CREATE INDEX IF NOT EXISTS "public_users_doc_address_geo_idx_e34d2796" ON "public"."Users" (("doc" -> 'address' -> 'geo'));
+CREATE INDEX IF NOT EXISTS "public_users_doc_address_zip_idx_9c9b2090" ON "public"."Users" (("doc" -> 'address' ->> 'zip'));
+CREATE INDEX IF NOT EXISTS "adults" ON "public"."Users" ((("doc" ->> 'age')::numeric)) WHERE ("doc" ->> 'age')::numeric >= 18;
+CREATE UNIQUE INDEX IF NOT EXISTS "public_users_doc_email_idx_90211b87" ON "public"."Users" (("doc" ->> 'email'));
+CREATE INDEX IF NOT EXISTS "public_users_doc_tags_idx_15f70ada" ON "public"."Users" USING gin (("doc" -> 'tags') jsonb_ops);
@@ -1,5 +1,9 @@
 package jsonb
 
+import (
+	"sort"
+)
+
 type Kind int
 
 const (
@@ -9,6 +13,9 @@ const (
 	KindString
 	KindBool
 	KindAny
+
+	// KindRef is a reference to a Type in a Registry (see Registry.Ref).
+	KindRef
 )
 
 var kindStrings = map[Kind]string{
@@ -18,6 +25,7 @@ var kindStrings = map[Kind]string{
 	KindString: `"string"`,
 	KindBool:   `"bool"`,
 	KindAny:    `"any"`,
+	KindRef:    `"ref"`,
 }
 
 func (k Kind) MarshalJSON() ([]byte, error) {
@@ -46,6 +54,18 @@ func (k *Kind) UnmarshalJSON(bs []byte) error {
 // an object's field types statically.
 type TableDef map[string]*Type
 
+// sortedKeys returns the field names of a TableDef in order, for when the
+// output needs to be deterministic.
+func sortedKeys(fields TableDef) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
 // Type is a static type definition that declares the expected types encoded
 // by a JSON blob. Types should be statically constructed and just used via
 // pointer. There are a handful of common pre-defined types.
@@ -64,6 +84,28 @@ type Type struct {
 	// Set only when Kind or ListKind is KindTable. References the underlying
 	// TableDef which is used for object validation.
 	Fields TableDef
+
+	// Indexes annotates the value with the database indexes it should
+	// have. See IndexDDL.
+	Indexes []Index `json:",omitempty"`
+
+	// Default is the value of the field when it's missing from its table.
+	// If DefaultFunc is set, it's called to make each default value
+	// instead. See WithDefault.
+	Default     interface{}        `json:",omitempty"`
+	DefaultFunc func() interface{} `json:"-"`
+
+	// Defaults says how the defaults of a table's fields are applied.
+	Defaults DefaultMode `json:",omitempty"`
+
+	// Rules are constraints on a table beyond its fields' types. See
+	// WithRules.
+	Rules []Rule `json:"-"`
+
+	// Ref is the name of the referenced Type when Kind is KindRef, and
+	// registry is where it's looked up.
+	Ref      string `json:",omitempty"`
+	registry *Registry
 }
 
 // NewStringType is a helper method that returns a Type for a string with
@@ -109,7 +151,7 @@ var (
 	TypeAnyList    = NewListType(TypeAny, -1)
 )
 
-func (ty *Type) isValidList(val interface{}) bool {
+func (ty *Type) isValidList(val interface{}, rules bool) bool {
 	l, ok := val.([]interface{})
 	if !ok {
 		return false
@@ -120,7 +162,7 @@ func (ty *Type) isValidList(val interface{}) bool {
 	}
 
 	for _, v := range l {
-		if !ty.ListType.IsValid(v) {
+		if !ty.ListType.isValid(v, rules) {
 			return false
 		}
 	}
@@ -128,7 +170,7 @@ func (ty *Type) isValidList(val interface{}) bool {
 	return true
 }
 
-func (ty *Type) isValidTable(val interface{}) bool {
+func (ty *Type) isValidTable(val interface{}, rules bool) bool {
 	t, ok := val.(map[string]interface{})
 	if !ok {
 		return false
@@ -140,21 +182,43 @@ func (ty *Type) isValidTable(val interface{}) bool {
 			return false
 		}
 
-		if !sty.IsValid(v) {
+		if !sty.isValid(v, rules) {
 			return false
 		}
 	}
 
+	if rules {
+		for _, r := range ty.Rules {
+			if len(r.fn(t)) > 0 {
+				return false
+			}
+		}
+	}
+
 	return true
 }
 
+// IsValid returns true if val matches the Type, including its tables'
+// Rules.
 func (ty *Type) IsValid(val interface{}) bool {
+	return ty.isValid(val, true)
+}
+
+// validTypes is like IsValid, but ignores Rules (e.g. for intermediate
+// states, where only the end result has to follow them).
+func (ty *Type) validTypes(val interface{}) bool {
+	return ty.isValid(val, false)
+}
+
+func (ty *Type) isValid(val interface{}, rules bool) bool {
+	ty = ty.deref()
+
 	switch ty.Kind {
 	case KindTable:
-		return ty.isValidTable(val)
+		return ty.isValidTable(val, rules)
 
 	case KindList:
-		return ty.isValidList(val)
+		return ty.isValidList(val, rules)
 
 	case KindNumber:
 		if _, ok := val.(float64); ok {
@@ -187,6 +251,10 @@ func (ty *Type) IsValid(val interface{}) bool {
 
 	case KindAny:
 		return true
+
+	case KindRef:
+		// Unresolved.
+		return false
 	}
 
 	panic("unreachable")
@@ -38,6 +38,30 @@ func TestKindMarshal(t *testing.T) {
 	}
 }
 
+func TestTypeMarshal(t *testing.T) {
+	// Types serialized before any of the annotations existed still decode.
+	src := `{"Kind":"table","ListType":null,"MaxLen":0,"Fields":{"tags":{"Kind":"list","ListType":{"Kind":"string","ListType":null,"MaxLen":8,"Fields":null},"MaxLen":2,"Fields":null}}}`
+
+	var ty Type
+	if er := json.Unmarshal([]byte(src), &ty); er != nil {
+		t.Fatal(er)
+	}
+
+	tags := ty.Fields["tags"]
+	if ty.Kind != KindTable || tags.Kind != KindList || tags.MaxLen != 2 || tags.ListType.MaxLen != 8 {
+		t.Errorf("got %#v", ty)
+	}
+
+	bs, er := json.Marshal(&ty)
+	if er != nil {
+		t.Fatal(er)
+	}
+
+	if string(bs) != src {
+		t.Errorf("got %s", bs)
+	}
+}
+
 func TestValidListNumber(t *testing.T) {
 	v := rtJSON(t, []int{1, 2, 3, 4})
 	ty := NewListType(TypeNumber, 4)
@@ -130,3 +154,38 @@ func TestListTable(t *testing.T) {
 		t.Error("should be invalid")
 	}
 }
+
+func TestTypeLookup(t *testing.T) {
+	item := NewTableType(TableDef{
+		"a/b": TypeNumber,
+	})
+	ty := NewTableType(TableDef{
+		"items": NewListType(item, 2),
+		"any":   TypeAny,
+	})
+
+	cases := []struct {
+		ptr string
+		ty  *Type
+		er  error
+	}{
+		{"", ty, nil},
+		{"/items", ty.Fields["items"], nil},
+		{"/items/1", item, nil},
+		{"/items/1/a~1b", TypeNumber, nil},
+		{"/items/2", nil, ErrSchema},
+		{"/items/01", nil, ErrSchema},
+		{"/items/x", nil, ErrSchema},
+		{"/items/0/a~1b/c", nil, ErrSchema},
+		{"/nope", nil, ErrSchema},
+		{"/any/deep/er", TypeAny, nil},
+		{"items", nil, ErrInvalidPointer},
+	}
+
+	for _, c := range cases {
+		ty1, er := ty.Lookup(c.ptr)
+		if ty1 != c.ty || er != c.er {
+			t.Errorf("%q: got %v/%v", c.ptr, ty1, er)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package jsonb
+
+// toFloat64 converts any of the numeric types accepted by KindNumber to a
+// float64.
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	}
+
+	return 0, false
+}
+
+// deepCopy returns a copy of a decoded JSON value which shares no tables or
+// lists with the original.
+func deepCopy(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, v1 := range v {
+			out[k] = deepCopy(v1)
+		}
+		return out
+
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, v1 := range v {
+			out[i] = deepCopy(v1)
+		}
+		return out
+	}
+
+	return val
+}